@@ -5,13 +5,18 @@ import (
 	"net/http"
 
 	"github.com/abdelrahman/expense-manager/internal/config"
+	"github.com/abdelrahman/expense-manager/internal/currency"
 	"github.com/abdelrahman/expense-manager/internal/database"
 	"github.com/abdelrahman/expense-manager/internal/handlers"
+	"github.com/abdelrahman/expense-manager/internal/jobs"
+	"github.com/abdelrahman/expense-manager/internal/mail"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/passwordpolicy"
 	"github.com/abdelrahman/expense-manager/internal/utils"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -19,7 +24,12 @@ func main() {
 	cfg := config.Load()
 
 	// Initialize JWT
-	utils.InitJWT(cfg.JWTSecret)
+	utils.InitJWT(cfg.JWTSecret, cfg.AccessTokenTTL)
+
+	// Trust the client addresses the reverse proxies in front of the API forward
+	if err := middleware.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
 
 	// Connect to database
 	if err := database.Connect(cfg.GetDSN()); err != nil {
@@ -32,22 +42,116 @@ func main() {
 		&models.User{},
 		&models.Category{},
 		&models.DailyExpense{},
+		&models.ExpenseTag{},
 		&models.MonthlyPlan{},
 		&models.BankAccount{},
 		&models.BankAccountTransaction{},
+		&models.BankAccountSnapshot{},
+		&models.BankAccountReconciliation{},
+		&models.Loan{},
+		&models.LoanInstallment{},
+		&models.ZakatSettings{},
+		&models.ZakatPayment{},
+		&models.BudgetPeriod{},
+		&models.RecurringItem{},
+		&models.Notification{},
+		&models.MonthlyCategoryTotal{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.APIToken{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.LoginAttempt{},
+		&models.LoginThrottle{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Plans used to be unique per year and month alone, when Gregorian and Hijri years could not overlap
+	if db.Migrator().HasIndex(&models.MonthlyPlan{}, "idx_user_month_category") {
+		if err := db.Migrator().DropIndex(&models.MonthlyPlan{}, "idx_user_month_category"); err != nil {
+			log.Fatalf("Failed to drop the old monthly plan index: %v", err)
+		}
+	}
+
+	// Transactions recorded before value dates existed moved money on their booking date
+	if err := db.Model(&models.BankAccountTransaction{}).
+		Where("value_date IS NULL").
+		Update("value_date", gorm.Expr("DATE(created_at)")).Error; err != nil {
+		log.Fatalf("Failed to backfill transaction value dates: %v", err)
+	}
+
+	// Account types used to be free text; store them in their canonical spelling
+	for alias, accountType := range models.AccountTypeAliases() {
+		if err := db.Model(&models.BankAccount{}).
+			Where("LOWER(account_type) = ? AND account_type <> ?", alias, accountType).
+			Update("account_type", accountType).Error; err != nil {
+			log.Fatalf("Failed to normalize account types: %v", err)
+		}
+	}
+
+	// Monthly rollups are maintained as expenses change; build them once for existing expenses
+	var rollupCount, expenseCount int64
+	db.Model(&models.MonthlyCategoryTotal{}).Count(&rollupCount)
+	db.Model(&models.DailyExpense{}).Count(&expenseCount)
+	if rollupCount == 0 && expenseCount > 0 {
+		if err := models.RebuildMonthlyCategoryTotals(db, 0); err != nil {
+			log.Fatalf("Failed to build monthly category totals: %v", err)
+		}
+	}
+
 	log.Println("Database migration completed successfully")
 
+	// Currency conversion for multi-currency reports
+	rates, err := currency.ParseRates(cfg.ExchangeRates)
+	if err != nil {
+		log.Fatalf("Invalid exchange rates: %v", err)
+	}
+	converter := currency.NewConverter(cfg.BaseCurrency, rates)
+
+	// Password policy for new passwords
+	passwordPolicy := passwordpolicy.New(
+		passwordpolicy.MinLength(cfg.PasswordMinLength),
+		passwordpolicy.MaxBytes(72),
+		passwordpolicy.CharacterClasses(cfg.PasswordMinClasses),
+	)
+	if cfg.PasswordRejectPersonal {
+		passwordPolicy.Add(passwordpolicy.NoPersonalInfo())
+	}
+	if cfg.BreachedPasswordsPath != "" {
+		breached, err := passwordpolicy.LoadBreachedList(cfg.BreachedPasswordsPath)
+		if err != nil {
+			log.Fatalf("Failed to load breached password list: %v", err)
+		}
+		passwordPolicy.Add(breached)
+	}
+
+	// Background jobs
+	jobs.StartBalanceSnapshots(db)
+	jobs.StartAuthCleanup(db)
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler()
+	mailer := mail.NewSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	authHandler := handlers.NewAuthHandler(cfg, mailer, passwordPolicy)
 	categoryHandler := handlers.NewCategoryHandler()
 	expenseHandler := handlers.NewExpenseHandler()
 	monthlyPlanHandler := handlers.NewMonthlyPlanHandler()
-	reportHandler := handlers.NewReportHandler()
+	reportHandler := handlers.NewReportHandler(converter)
 	bankAccountHandler := handlers.NewBankAccountHandler()
+	reconciliationHandler := handlers.NewReconciliationHandler()
+	creditCardHandler := handlers.NewCreditCardHandler()
+	loanHandler := handlers.NewLoanHandler()
+	zakatHandler := handlers.NewZakatHandler(converter)
+	budgetPeriodHandler := handlers.NewBudgetPeriodHandler()
+	recurringItemHandler := handlers.NewRecurringItemHandler()
+	forecastHandler := handlers.NewForecastHandler(converter)
+	anomalyHandler := handlers.NewAnomalyHandler()
+	notificationHandler := handlers.NewNotificationHandler()
+	analyticsHandler := handlers.NewAnalyticsHandler()
+	apiTokenHandler := handlers.NewAPITokenHandler()
 
 	// Setup router
 	router := mux.NewRouter()
@@ -56,14 +160,41 @@ func main() {
 	publicAPI := router.PathPrefix("/api/auth").Subrouter()
 	publicAPI.HandleFunc("/register", authHandler.Register).Methods("POST")
 	publicAPI.HandleFunc("/login", authHandler.Login).Methods("POST")
+	publicAPI.HandleFunc("/login/2fa", authHandler.LoginTwoFactor).Methods("POST")
+	publicAPI.HandleFunc("/oidc/providers", authHandler.GetOIDCProviders).Methods("GET")
+	publicAPI.HandleFunc("/oidc/{provider}/start", authHandler.StartOIDCLogin).Methods("POST")
+	publicAPI.HandleFunc("/oidc/{provider}/callback", authHandler.FinishOIDCLogin).Methods("POST")
+	publicAPI.HandleFunc("/refresh", authHandler.Refresh).Methods("POST")
+	publicAPI.HandleFunc("/logout", authHandler.Logout).Methods("POST")
+	publicAPI.HandleFunc("/forgot-password", authHandler.ForgotPassword).Methods("POST")
+	publicAPI.HandleFunc("/reset-password", authHandler.ResetPassword).Methods("POST")
+	publicAPI.HandleFunc("/verify-email", authHandler.VerifyEmail).Methods("POST")
 
 	// Protected routes (authentication required)
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(middleware.Auth)
+	api.Use(middleware.RequireScope)
+	if cfg.RequireVerifiedEmail {
+		api.Use(middleware.VerifiedEmail)
+	}
 
 	// Auth routes (protected)
 	api.HandleFunc("/auth/me", authHandler.GetCurrentUser).Methods("GET")
 	api.HandleFunc("/auth/profile", authHandler.UpdateProfile).Methods("PUT")
+	api.HandleFunc("/auth/password", authHandler.ChangePassword).Methods("PUT")
+	api.HandleFunc("/auth/email", authHandler.ChangeEmail).Methods("PUT")
+	api.HandleFunc("/auth/verify-email/resend", authHandler.ResendEmailVerification).Methods("POST")
+	api.HandleFunc("/auth/2fa", authHandler.GetTwoFactor).Methods("GET")
+	api.HandleFunc("/auth/2fa/setup", authHandler.SetupTwoFactor).Methods("POST")
+	api.HandleFunc("/auth/2fa/enable", authHandler.EnableTwoFactor).Methods("POST")
+	api.HandleFunc("/auth/2fa/disable", authHandler.DisableTwoFactor).Methods("POST")
+	api.HandleFunc("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes).Methods("POST")
+	api.HandleFunc("/auth/tokens", apiTokenHandler.GetAPITokens).Methods("GET")
+	api.HandleFunc("/auth/tokens", apiTokenHandler.CreateAPIToken).Methods("POST")
+	api.HandleFunc("/auth/tokens/{id}", apiTokenHandler.DeleteAPIToken).Methods("DELETE")
+	api.HandleFunc("/auth/login-attempts", authHandler.GetLoginAttempts).Methods("GET")
+	api.HandleFunc("/auth/sessions", authHandler.GetSessions).Methods("GET")
+	api.HandleFunc("/auth/sessions/{id}", authHandler.DeleteSession).Methods("DELETE")
 
 	// Category routes
 	api.HandleFunc("/categories", categoryHandler.GetCategories).Methods("GET")
@@ -83,14 +214,22 @@ func main() {
 	// Monthly plan routes
 	api.HandleFunc("/monthly-plans", monthlyPlanHandler.GetMonthlyPlans).Methods("GET")
 	api.HandleFunc("/monthly-plans", monthlyPlanHandler.CreateMonthlyPlan).Methods("POST")
+	api.HandleFunc("/monthly-plans/period", monthlyPlanHandler.GetPeriodPlans).Methods("GET")
 	api.HandleFunc("/monthly-plans/{id}", monthlyPlanHandler.GetMonthlyPlan).Methods("GET")
 	api.HandleFunc("/monthly-plans/{id}", monthlyPlanHandler.UpdateMonthlyPlan).Methods("PUT")
 	api.HandleFunc("/monthly-plans/{id}", monthlyPlanHandler.DeleteMonthlyPlan).Methods("DELETE")
 	api.HandleFunc("/monthly-plans/{year}/{month}", monthlyPlanHandler.GetMonthlyPlanByYearMonth).Methods("GET")
+	api.HandleFunc("/monthly-plans/hijri/{year}/{month}", monthlyPlanHandler.GetHijriMonthlyPlans).Methods("GET")
+
+	// Budget period routes
+	api.HandleFunc("/budget-period", budgetPeriodHandler.GetBudgetPeriod).Methods("GET")
+	api.HandleFunc("/budget-period", budgetPeriodHandler.UpdateBudgetPeriod).Methods("PUT")
+	api.HandleFunc("/budget-period/periods", budgetPeriodHandler.GetPeriods).Methods("GET")
 
 	// Bank Account routes
 	api.HandleFunc("/bank-accounts", bankAccountHandler.GetBankAccounts).Methods("GET")
 	api.HandleFunc("/bank-accounts", bankAccountHandler.CreateBankAccount).Methods("POST")
+	api.HandleFunc("/bank-accounts/upcoming-payments", creditCardHandler.GetUpcomingPayments).Methods("GET")
 	api.HandleFunc("/bank-accounts/{id}", bankAccountHandler.GetBankAccount).Methods("GET")
 	api.HandleFunc("/bank-accounts/{id}", bankAccountHandler.UpdateBankAccount).Methods("PUT")
 	api.HandleFunc("/bank-accounts/{id}", bankAccountHandler.DeleteBankAccount).Methods("DELETE")
@@ -98,13 +237,64 @@ func main() {
 	api.HandleFunc("/bank-accounts/{id}/balance", bankAccountHandler.UpdateBankAccountBalance).Methods("PUT")
 	api.HandleFunc("/bank-accounts/{id}/transactions", bankAccountHandler.GetBankAccountTransactions).Methods("GET")
 	api.HandleFunc("/bank-accounts/{id}/transactions", bankAccountHandler.CreateBankAccountTransaction).Methods("POST")
+	api.HandleFunc("/bank-accounts/{id}/statements", creditCardHandler.GetStatements).Methods("GET")
+
+	// Bank Account reconciliation routes
+	api.HandleFunc("/bank-accounts/{id}/reconciliations", reconciliationHandler.GetReconciliations).Methods("GET")
+	api.HandleFunc("/bank-accounts/{id}/reconciliations", reconciliationHandler.StartReconciliation).Methods("POST")
+	api.HandleFunc("/bank-accounts/{id}/reconciliations/{reconciliationId}", reconciliationHandler.GetReconciliation).Methods("GET")
+	api.HandleFunc("/bank-accounts/{id}/reconciliations/{reconciliationId}", reconciliationHandler.CancelReconciliation).Methods("DELETE")
+	api.HandleFunc("/bank-accounts/{id}/reconciliations/{reconciliationId}/transactions", reconciliationHandler.UpdateReconciliationTransactions).Methods("PUT")
+	api.HandleFunc("/bank-accounts/{id}/reconciliations/{reconciliationId}/complete", reconciliationHandler.CompleteReconciliation).Methods("POST")
+
+	// Loan and installment plan routes
+	api.HandleFunc("/loans", loanHandler.GetLoans).Methods("GET")
+	api.HandleFunc("/loans", loanHandler.CreateLoan).Methods("POST")
+	api.HandleFunc("/loans/installments/upcoming", loanHandler.GetUpcomingInstallments).Methods("GET")
+	api.HandleFunc("/loans/{id}", loanHandler.GetLoan).Methods("GET")
+	api.HandleFunc("/loans/{id}", loanHandler.UpdateLoan).Methods("PUT")
+	api.HandleFunc("/loans/{id}", loanHandler.DeleteLoan).Methods("DELETE")
+	api.HandleFunc("/loans/{id}/installments/{installmentId}/pay", loanHandler.PayInstallment).Methods("POST")
+
+	// Recurring income and expense routes
+	api.HandleFunc("/recurring-items", recurringItemHandler.GetRecurringItems).Methods("GET")
+	api.HandleFunc("/recurring-items", recurringItemHandler.CreateRecurringItem).Methods("POST")
+	api.HandleFunc("/recurring-items/{id}", recurringItemHandler.UpdateRecurringItem).Methods("PUT")
+	api.HandleFunc("/recurring-items/{id}", recurringItemHandler.DeleteRecurringItem).Methods("DELETE")
+
+	// Zakat routes
+	api.HandleFunc("/zakat/settings", zakatHandler.GetSettings).Methods("GET")
+	api.HandleFunc("/zakat/settings", zakatHandler.UpdateSettings).Methods("PUT")
+	api.HandleFunc("/zakat/calculation", zakatHandler.GetCalculation).Methods("GET")
+	api.HandleFunc("/zakat/payments", zakatHandler.GetPayments).Methods("GET")
+	api.HandleFunc("/zakat/payments", zakatHandler.CreatePayment).Methods("POST")
+
+	// Spending anomaly routes
+	api.HandleFunc("/anomalies", anomalyHandler.GetAnomalies).Methods("GET")
+	api.HandleFunc("/anomalies/baselines", anomalyHandler.GetBaselines).Methods("GET")
+
+	// Notification routes
+	api.HandleFunc("/notifications", notificationHandler.GetNotifications).Methods("GET")
+	api.HandleFunc("/notifications/read-all", notificationHandler.MarkAllNotificationsRead).Methods("PUT")
+	api.HandleFunc("/notifications/{id}/read", notificationHandler.MarkNotificationRead).Methods("PUT")
+	api.HandleFunc("/notifications/{id}", notificationHandler.DeleteNotification).Methods("DELETE")
 
 	//
 	// Report routes
 	api.HandleFunc("/reports/monthly/{year}/{month}", reportHandler.GetMonthlyReport).Methods("GET")
+	api.HandleFunc("/reports/monthly/hijri/{year}/{month}", reportHandler.GetHijriMonthlyReport).Methods("GET")
+	api.HandleFunc("/reports/period", reportHandler.GetPeriodReport).Methods("GET")
+	api.HandleFunc("/reports/summary", reportHandler.GetSummaryReport).Methods("GET")
+	api.HandleFunc("/reports/vat/{year}/{quarter}", reportHandler.GetVATSummary).Methods("GET")
 	api.HandleFunc("/reports/category/{year}/{month}", reportHandler.GetCategoryReport).Methods("GET")
 	api.HandleFunc("/reports/comparison", reportHandler.GetMonthComparison).Methods("GET")
+	api.HandleFunc("/reports/period-comparison", reportHandler.GetPeriodComparison).Methods("GET")
 	api.HandleFunc("/reports/trends/{year}", reportHandler.GetYearlyTrends).Methods("GET")
+	api.HandleFunc("/reports/net-worth", reportHandler.GetNetWorth).Methods("GET")
+	api.HandleFunc("/reports/cash-flow-forecast", forecastHandler.GetCashFlowForecast).Methods("GET")
+
+	// Analytics routes
+	api.HandleFunc("/analytics/heatmap/{year}", analyticsHandler.GetHeatmap).Methods("GET")
 
 	// Health check (public)
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -121,6 +311,7 @@ func main() {
 		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"X-Next-Cursor"},
 		AllowCredentials: true,
 	})
 
@@ -0,0 +1,40 @@
+// Command mockoidc runs a minimal OpenID Connect provider for trying OIDC sign-in locally.
+// It approves every authorization request as the configured user, without a login page.
+//
+//	go run ./cmd/mockoidc -addr :9400 -email dev@example.com
+//
+// and register it with the API:
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9400
+//	OIDC_MOCK_CLIENT_ID=expense-manager
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/abdelrahman/expense-manager/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9400", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9400", "issuer URL, as the API reaches this server")
+	clientID := flag.String("client-id", "expense-manager", "client ID to accept")
+	email := flag.String("email", "dev@example.com", "email of the signed-in user (a login_hint overrides it)")
+	name := flag.String("name", "Dev User", "name of the signed-in user")
+	verified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	flag.Parse()
+
+	p, err := oidctest.NewProvider(*issuer, *clientID)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+	p.Email = *email
+	p.Name = *name
+	p.EmailVerified = *verified
+
+	log.Printf("Mock OIDC provider %s listening on %s", p.Issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -0,0 +1,54 @@
+// Command rollup checks the monthly category totals against the expenses they summarize
+// and rebuilds them when asked.
+//
+//	go run ./cmd/rollup                  # report mismatches, exit 1 if any
+//	go run ./cmd/rollup -rebuild         # rebuild every user's totals
+//	go run ./cmd/rollup -rebuild -user 3 # rebuild one user's totals
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/abdelrahman/expense-manager/internal/config"
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+func main() {
+	rebuild := flag.Bool("rebuild", false, "rebuild the totals from the expenses instead of only checking them")
+	userID := flag.Uint("user", 0, "limit to one user ID (default all users)")
+	flag.Parse()
+
+	cfg := config.Load()
+	if err := database.Connect(cfg.GetDSN()); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	db := database.GetDB()
+
+	if err := db.AutoMigrate(&models.MonthlyCategoryTotal{}); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if *rebuild {
+		if err := models.RebuildMonthlyCategoryTotals(db, *userID); err != nil {
+			log.Fatalf("Failed to rebuild monthly category totals: %v", err)
+		}
+		log.Println("Monthly category totals rebuilt")
+	}
+
+	mismatches, err := models.CheckMonthlyCategoryTotals(db, *userID)
+	if err != nil {
+		log.Fatalf("Failed to check monthly category totals: %v", err)
+	}
+	for _, m := range mismatches {
+		log.Printf("User %d, %d-%02d, category %d: rollup %.2f (%d expenses), actual %.2f (%d expenses)",
+			m.UserID, m.Year, m.Month, m.CategoryID, m.RollupAmount, m.RollupCount, m.ActualAmount, m.ActualCount)
+	}
+	if len(mismatches) > 0 {
+		log.Printf("%d monthly category totals disagree with the expenses; run with -rebuild to fix them", len(mismatches))
+		os.Exit(1)
+	}
+	log.Println("Monthly category totals match the expenses")
+}
@@ -0,0 +1,83 @@
+package anomaly
+
+import (
+	"math"
+	"sort"
+)
+
+// Thresholds an amount must exceed to count as an outlier. Both must be met so that a
+// handful of similar amounts with a tiny spread does not flag every small variation.
+const (
+	MinSamples = 5   // Fewer past amounts than this give no baseline
+	IQRFactor  = 1.5 // Tukey's fence above the third quartile
+	MinZScore  = 2.0 // Standard deviations above the mean
+)
+
+// Baseline summarizes past amounts of a category or merchant
+type Baseline struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+	Median float64 `json:"median"`
+	Q1     float64 `json:"q1"`
+	Q3     float64 `json:"q3"`
+}
+
+// NewBaseline computes the baseline of a set of amounts
+func NewBaseline(amounts []float64) Baseline {
+	b := Baseline{Count: len(amounts)}
+	if b.Count == 0 {
+		return b
+	}
+
+	sorted := append([]float64(nil), amounts...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, amount := range sorted {
+		sum += amount
+	}
+	b.Mean = sum / float64(b.Count)
+
+	variance := 0.0
+	for _, amount := range sorted {
+		variance += (amount - b.Mean) * (amount - b.Mean)
+	}
+	b.StdDev = math.Sqrt(variance / float64(b.Count))
+
+	b.Q1 = quantile(sorted, 0.25)
+	b.Median = quantile(sorted, 0.5)
+	b.Q3 = quantile(sorted, 0.75)
+	return b
+}
+
+// ZScore returns how many standard deviations an amount is above the mean, or zero
+// when all past amounts were equal
+func (b Baseline) ZScore(amount float64) float64 {
+	if b.StdDev == 0 {
+		return 0
+	}
+	return (amount - b.Mean) / b.StdDev
+}
+
+// UpperFence returns the amount above which values are outliers by the IQR rule
+func (b Baseline) UpperFence() float64 {
+	return b.Q3 + IQRFactor*(b.Q3-b.Q1)
+}
+
+// IsOutlier reports whether an amount is unusually high for the baseline. When all past
+// amounts were equal, as with a fixed subscription, anything above them is unusual.
+func (b Baseline) IsOutlier(amount float64) bool {
+	if b.Count < MinSamples || amount <= b.UpperFence() {
+		return false
+	}
+	return b.StdDev == 0 || b.ZScore(amount) >= MinZScore
+}
+
+// quantile interpolates linearly between the closest ranks of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
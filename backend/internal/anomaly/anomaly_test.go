@@ -0,0 +1,60 @@
+package anomaly
+
+import "testing"
+
+func TestNewBaseline(t *testing.T) {
+	amounts := []float64{5, 9, 2, 4, 7, 4, 5, 4}
+	b := NewBaseline(amounts)
+	want := Baseline{Count: 8, Mean: 5, StdDev: 2, Median: 4.5, Q1: 4, Q3: 5.5}
+	if b != want {
+		t.Errorf("NewBaseline = %+v, want %+v", b, want)
+	}
+	if amounts[0] != 5 || amounts[1] != 9 {
+		t.Errorf("NewBaseline reordered its input: %v", amounts)
+	}
+	if fence := b.UpperFence(); fence != 7.75 {
+		t.Errorf("UpperFence = %v, want 7.75", fence)
+	}
+	if z := b.ZScore(9); z != 2 {
+		t.Errorf("ZScore(9) = %v, want 2", z)
+	}
+
+	if empty := NewBaseline(nil); empty != (Baseline{}) {
+		t.Errorf("NewBaseline(nil) = %+v, want a zero baseline", empty)
+	}
+	if single := NewBaseline([]float64{12}); single != (Baseline{Count: 1, Mean: 12, Median: 12, Q1: 12, Q3: 12}) {
+		t.Errorf("NewBaseline of one amount = %+v", single)
+	}
+}
+
+func TestIsOutlier(t *testing.T) {
+	spread := NewBaseline([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	subscription := NewBaseline([]float64{50, 50, 50, 50, 50})
+	// Mean 19 and standard deviation 27, with both quartiles at 10
+	skewed := NewBaseline([]float64{10, 10, 10, 10, 10, 10, 10, 10, 10, 100})
+	tooFew := NewBaseline([]float64{10, 10, 10, 10})
+
+	tests := []struct {
+		name     string
+		baseline Baseline
+		amount   float64
+		want     bool
+	}{
+		{"above the fence and two deviations", spread, 9, true},
+		{"above the fence, under two deviations", spread, 7.8, false},
+		{"under the fence", spread, 7, false},
+		{"below the mean", spread, 1, false},
+		{"same as a fixed amount", subscription, 50, false},
+		{"above a fixed amount", subscription, 50.01, true},
+		{"below a fixed amount", subscription, 20, false},
+		{"far above a skewed baseline", skewed, 73, true},
+		{"above the fence of a skewed baseline only", skewed, 60, false},
+		{"too few past amounts", tooFew, 1000, false},
+		{"no past amounts", NewBaseline(nil), 1000, false},
+	}
+	for _, tt := range tests {
+		if got := tt.baseline.IsOutlier(tt.amount); got != tt.want {
+			t.Errorf("%s: IsOutlier(%v) = %v, want %v (baseline %+v)", tt.name, tt.amount, got, tt.want, tt.baseline)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +19,67 @@ type Config struct {
 	DBName     string
 	ServerPort string
 	JWTSecret  string
+
+	// Authentication
+	AccessTokenTTL  time.Duration // Lifetime of the JWT sent with every request
+	RefreshTokenTTL time.Duration // Lifetime of a refresh token, renewed on every refresh
+	ResetTokenTTL   time.Duration // Lifetime of a password reset link
+	VerifyTokenTTL  time.Duration // Lifetime of an email verification link
+	AppURL          string        // Frontend address used in links sent by email
+	MFATokenTTL     time.Duration // Time to enter the second factor after the password
+	MFAIssuer       string        // Account name shown in authenticator apps
+
+	// RequireVerifiedEmail stops users who have not verified their email from changing
+	// data outside their account settings; they can still sign in and read
+	RequireVerifiedEmail bool
+
+	// Password policy for new passwords
+	PasswordMinLength      int
+	PasswordMinClasses     int    // Of lowercase, uppercase, digits and symbols; 1 for no mixing rule
+	PasswordRejectPersonal bool   // Reject passwords containing the user's email or name
+	BreachedPasswordsPath  string // Local breached password list, file or range directory; empty to skip the check
+
+	// Sign-in throttling. Failed attempts count per email since its last successful sign-in and
+	// per IP address, until LoginFailureWindow passes without one. After LoginBackoffAfter failures each attempt
+	// must wait twice as long as the last, starting at LoginBackoffBase; at LoginLockoutAfter
+	// failures the email is locked for LoginLockoutDuration. An IP address backs off from
+	// LoginLockoutAfter failures and is locked at LoginIPLockoutAfter.
+	LoginFailureWindow   time.Duration
+	LoginBackoffAfter    int
+	LoginBackoffBase     time.Duration
+	LoginLockoutAfter    int
+	LoginLockoutDuration time.Duration
+	LoginIPLockoutAfter  int
+
+	// Reverse proxies, as IP addresses or CIDR ranges, whose X-Forwarded-For header gives the
+	// client address that sign-in throttling and sessions record
+	TrustedProxies []string
+
+	// OpenID Connect providers users can sign in with, from OIDC_PROVIDERS
+	OIDCProviders []OIDCProvider
+
+	// Outgoing email; emails are only logged when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// Currency conversion
+	BaseCurrency  string
+	ExchangeRates string // e.g. "USD:3.75,EUR:4.05", value of one unit in the base currency
+}
+
+// OIDCProvider is an identity provider registered as OIDC_PROVIDERS=<name> with its
+// settings in OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _DISPLAY_NAME, _REDIRECT_URL and _SCOPES
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // Frontend page the provider returns to, which posts the code to the API
+	Scopes       []string // Defaults to openid, email and profile
 }
 
 func Load() *Config {
@@ -32,11 +96,73 @@ func Load() *Config {
 		DBName:     getEnv("DB_NAME", "expense_manager"),
 		ServerPort: getEnv("SERVER_PORT", "8080"),
 		JWTSecret:  getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
+
+		AccessTokenTTL:  getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		ResetTokenTTL:   getDurationEnv("RESET_TOKEN_TTL", time.Hour),
+		VerifyTokenTTL:  getDurationEnv("VERIFY_TOKEN_TTL", 24*time.Hour),
+		AppURL:          getEnv("APP_URL", "http://localhost:5173"),
+		MFATokenTTL:     getDurationEnv("MFA_TOKEN_TTL", 5*time.Minute),
+		MFAIssuer:       getEnv("MFA_ISSUER", "Expense Manager"),
+
+		RequireVerifiedEmail: getBoolEnv("REQUIRE_VERIFIED_EMAIL", false),
+
+		PasswordMinLength:      getIntEnv("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinClasses:     getIntEnv("PASSWORD_MIN_CLASSES", 1),
+		PasswordRejectPersonal: getBoolEnv("PASSWORD_REJECT_PERSONAL", true),
+		BreachedPasswordsPath:  getEnv("BREACHED_PASSWORDS_PATH", ""),
+
+		LoginFailureWindow:   getDurationEnv("LOGIN_FAILURE_WINDOW", time.Hour),
+		LoginBackoffAfter:    getIntEnv("LOGIN_BACKOFF_AFTER", 3),
+		LoginBackoffBase:     getDurationEnv("LOGIN_BACKOFF_BASE", time.Second),
+		LoginLockoutAfter:    getIntEnv("LOGIN_LOCKOUT_AFTER", 10),
+		LoginLockoutDuration: getDurationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginIPLockoutAfter:  getIntEnv("LOGIN_IP_LOCKOUT_AFTER", 50),
+		TrustedProxies:       strings.FieldsFunc(getEnv("TRUSTED_PROXIES", ""), func(r rune) bool { return r == ',' || r == ' ' }),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "Expense Manager <no-reply@localhost>"),
+
+		BaseCurrency:  getEnv("BASE_CURRENCY", "SAR"),
+		ExchangeRates: getEnv("EXCHANGE_RATES", "USD:3.75,EUR:4.05,GBP:4.75,AED:1.02"),
 	}
 
+	config.OIDCProviders = loadOIDCProviders(config.AppURL)
+
 	return config
 }
 
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS, skipping incomplete ones
+func loadOIDCProviders(appURL string) []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := OIDCProvider{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			IssuerURL:    getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimRight(appURL, "/")+"/auth/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(strings.ReplaceAll(getEnv(prefix+"SCOPES", ""), ",", " ")),
+		}
+		if provider.IssuerURL == "" || provider.ClientID == "" {
+			log.Printf("OIDC provider %q needs %sISSUER and %sCLIENT_ID, skipping it", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		c.DBUser, c.DBPassword, c.DBHost, c.DBPort, c.DBName)
@@ -48,3 +174,45 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDurationEnv reads a duration such as "15m" or "720h", falling back to the default when unset or invalid
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getIntEnv reads a positive integer, falling back to the default when unset or invalid
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// getBoolEnv reads a boolean such as "true" or "0", falling back to the default when unset or invalid
+func getBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return enabled
+}
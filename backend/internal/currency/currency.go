@@ -0,0 +1,97 @@
+package currency
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Converter converts amounts between currencies using fixed rates relative to a base currency
+type Converter struct {
+	base  string
+	rates map[string]float64
+}
+
+// NewConverter creates a converter. Rates give the value of one unit of each
+// currency expressed in the base currency (e.g. USD: 3.75 for a SAR base).
+func NewConverter(base string, rates map[string]float64) *Converter {
+	base = Normalize(base)
+	normalized := map[string]float64{base: 1}
+	for code, rate := range rates {
+		if rate > 0 {
+			normalized[Normalize(code)] = rate
+		}
+	}
+	return &Converter{base: base, rates: normalized}
+}
+
+// ParseRates parses a rate list in the form "USD:3.75,EUR:4.05"
+func ParseRates(input string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(input, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid exchange rate %q", pair)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q", pair)
+		}
+		rates[Normalize(parts[0])] = rate
+	}
+	return rates, nil
+}
+
+// Normalize returns the upper-case ISO code, dropping any non-letter characters
+func Normalize(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Base returns the base currency code
+func (c *Converter) Base() string {
+	return c.base
+}
+
+// Supports reports whether a rate is known for the currency
+func (c *Converter) Supports(code string) bool {
+	_, ok := c.rates[c.resolve(code)]
+	return ok
+}
+
+// Convert converts an amount from one currency to another
+func (c *Converter) Convert(amount float64, from, to string) (float64, error) {
+	from, to = c.resolve(from), c.resolve(to)
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, ok := c.rates[from]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", from)
+	}
+	toRate, ok := c.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", to)
+	}
+
+	return amount * fromRate / toRate, nil
+}
+
+// resolve normalizes a code, treating an empty code as the base currency
+func (c *Converter) resolve(code string) string {
+	code = Normalize(code)
+	if code == "" {
+		return c.base
+	}
+	return code
+}
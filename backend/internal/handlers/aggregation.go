@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"gorm.io/gorm"
+)
+
+// Groupings of an expense summary
+const (
+	groupByDay      = "day"
+	groupByWeek     = "week" // ISO weeks, starting on Monday
+	groupByMonth    = "month"
+	groupByQuarter  = "quarter"
+	groupByCategory = "category"
+	groupByTag      = "tag"
+	groupByAccount  = "account"
+)
+
+const maxSummaryGroups = 1000
+
+var errTooManyGroups = fmt.Errorf("A summary is limited to %d groups. Use a coarser grouping or a shorter range", maxSummaryGroups)
+
+// ExpenseSummary aggregates the expenses dated within a range, optionally broken down into groups
+type ExpenseSummary struct {
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	GroupBy       string         `json:"group_by,omitempty"`
+	TotalAmount   float64        `json:"total_amount"`
+	ExpenseCount  int64          `json:"expense_count"`
+	AverageAmount float64        `json:"average_amount"` // Per expense
+	DailyAverage  float64        `json:"daily_average"`
+	Groups        []SummaryGroup `json:"groups"`
+}
+
+// SummaryGroup is one breakdown of an expense summary: a time bucket, a category, a tag or
+// an account. An expense with several tags counts towards each, so tag shares can add up to
+// more than 100.
+type SummaryGroup struct {
+	Key           string  `json:"key"` // 2026-03-01, 2026-W09, 2026-03, 2026-Q1, the category or account ID, or the tag
+	Label         string  `json:"label"`
+	StartDate     string  `json:"start_date,omitempty"`
+	EndDate       string  `json:"end_date,omitempty"`
+	CategoryID    *uint   `json:"category_id,omitempty"`
+	BankAccountID *uint   `json:"bank_account_id,omitempty"`
+	Color         string  `json:"color,omitempty"`
+	TotalAmount   float64 `json:"total_amount"`
+	ExpenseCount  int64   `json:"expense_count"`
+	AverageAmount float64 `json:"average_amount"`
+	Share         float64 `json:"share"` // Percent of the summary total
+}
+
+// summarizeExpenses aggregates the expenses dated in [from, to) by the given grouping,
+// or without groups when groupBy is empty
+func summarizeExpenses(userID uint, from, to time.Time, groupBy string) (ExpenseSummary, error) {
+	summary := ExpenseSummary{
+		From:    from.Format("2006-01-02"),
+		To:      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		GroupBy: groupBy,
+		Groups:  []SummaryGroup{},
+	}
+
+	var err error
+	switch groupBy {
+	case "":
+	case groupByDay, groupByWeek, groupByMonth, groupByQuarter:
+		var periods []models.Period
+		if periods, err = summaryPeriods(from, to, groupBy); err == nil {
+			summary.Groups, err = groupExpensesByPeriods(userID, periods, groupBy)
+		}
+	case groupByCategory:
+		summary.Groups, err = groupExpensesByCategory(userID, from, to)
+	case groupByTag:
+		summary.Groups, err = groupExpensesByTag(userID, from, to)
+	case groupByAccount:
+		summary.Groups, err = groupExpensesByAccount(userID, from, to)
+	default:
+		err = fmt.Errorf("unsupported grouping %q", groupBy)
+	}
+	if err != nil {
+		return summary, err
+	}
+
+	if summary.TotalAmount, summary.ExpenseCount, err = expenseTotals(userID, from, to); err != nil {
+		return summary, err
+	}
+	summary.TotalAmount = roundAmount(summary.TotalAmount)
+	if summary.ExpenseCount > 0 {
+		summary.AverageAmount = roundAmount(summary.TotalAmount / float64(summary.ExpenseCount))
+	}
+	if days := models.DaysBetween(from, to); days > 0 {
+		summary.DailyAverage = roundAmount(summary.TotalAmount / float64(days))
+	}
+	for i := range summary.Groups {
+		if summary.TotalAmount > 0 {
+			summary.Groups[i].Share = roundAmount(summary.Groups[i].TotalAmount / summary.TotalAmount * 100)
+		}
+	}
+
+	return summary, nil
+}
+
+// expenseTotals returns the sum and number of the expenses dated in [from, to)
+func expenseTotals(userID uint, from, to time.Time) (float64, int64, error) {
+	var totals struct {
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+	if wholeMonths(from, to) {
+		err := database.GetDB().Model(&models.MonthlyCategoryTotal{}).
+			Select("COALESCE(SUM(total_amount), 0) as total_amount, COALESCE(SUM(expense_count), 0) as expense_count").
+			Where("user_id = ? AND "+rollupMonthRangeSQL, userID, monthIndex(from), monthIndex(to)).
+			Scan(&totals).Error
+		return totals.TotalAmount, totals.ExpenseCount, err
+	}
+
+	err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("COALESCE(SUM(amount), 0) as total_amount, COUNT(*) as expense_count").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, from, to).
+		Scan(&totals).Error
+	return totals.TotalAmount, totals.ExpenseCount, err
+}
+
+// groupExpensesByPeriods totals the expenses of each period with a single query, over the
+// monthly rollups when every period is made of calendar months and over daily totals
+// otherwise, so budget periods and ISO weeks need no database-specific date functions.
+// Periods may be apart but must not overlap; empty periods are kept with zero totals.
+func groupExpensesByPeriods(userID uint, periods []models.Period, groupBy string) ([]SummaryGroup, error) {
+	groups := make([]SummaryGroup, len(periods))
+	if len(periods) == 0 {
+		return groups, nil
+	}
+
+	from, to := periods[0].Start, periods[0].End
+	for i, period := range periods {
+		if period.Start.Before(from) {
+			from = period.Start
+		}
+		if period.End.After(to) {
+			to = period.End
+		}
+		groups[i] = SummaryGroup{
+			Key:       periodKey(period, groupBy),
+			Label:     periodLabel(period, groupBy),
+			StartDate: period.Start.Format("2006-01-02"),
+			EndDate:   period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		}
+	}
+
+	// Periods made of whole calendar months are read from the monthly rollups
+	calendarMonths := true
+	for _, period := range periods {
+		calendarMonths = calendarMonths && wholeMonths(period.Start, period.End)
+	}
+	if calendarMonths {
+		var months []struct {
+			Year         int
+			Month        int
+			TotalAmount  float64
+			ExpenseCount int64
+		}
+		if err := database.GetDB().Model(&models.MonthlyCategoryTotal{}).
+			Select("year, month, SUM(total_amount) as total_amount, SUM(expense_count) as expense_count").
+			Where("user_id = ? AND "+rollupMonthRangeSQL, userID, monthIndex(from), monthIndex(to)).
+			Group("year, month").
+			Scan(&months).Error; err != nil {
+			return nil, err
+		}
+
+		for _, month := range months {
+			date := time.Date(month.Year, time.Month(month.Month), 1, 0, 0, 0, 0, time.Local)
+			addToPeriodGroup(groups, periods, date, month.TotalAmount, month.ExpenseCount)
+		}
+		for i := range groups {
+			finishSummaryGroup(&groups[i])
+		}
+		return groups, nil
+	}
+
+	var days []struct {
+		ExpenseDate  time.Time
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+	if err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("expense_date, SUM(amount) as total_amount, COUNT(*) as expense_count").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, from, to).
+		Group("expense_date").
+		Scan(&days).Error; err != nil {
+		return nil, err
+	}
+
+	for _, day := range days {
+		date := time.Date(day.ExpenseDate.Year(), day.ExpenseDate.Month(), day.ExpenseDate.Day(), 0, 0, 0, 0, time.Local)
+		addToPeriodGroup(groups, periods, date, day.TotalAmount, day.ExpenseCount)
+	}
+
+	for i := range groups {
+		finishSummaryGroup(&groups[i])
+	}
+	return groups, nil
+}
+
+// groupExpensesByCategory totals the expenses dated in [from, to) per category, largest first
+func groupExpensesByCategory(userID uint, from, to time.Time) ([]SummaryGroup, error) {
+	var rows []struct {
+		CategoryID   *uint
+		Name         string
+		Color        string
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+
+	var query *gorm.DB
+	if wholeMonths(from, to) {
+		query = database.GetDB().Model(&models.MonthlyCategoryTotal{}).
+			Select("NULLIF(monthly_category_totals.category_id, 0) as category_id, categories.name, categories.color, SUM(monthly_category_totals.total_amount) as total_amount, SUM(monthly_category_totals.expense_count) as expense_count").
+			Joins("LEFT JOIN categories ON categories.id = monthly_category_totals.category_id").
+			Where("monthly_category_totals.user_id = ? AND "+rollupMonthRangeSQL, userID, monthIndex(from), monthIndex(to)).
+			Group("monthly_category_totals.category_id, categories.name, categories.color")
+	} else {
+		query = database.GetDB().Model(&models.DailyExpense{}).
+			Select("daily_expenses.category_id, categories.name, categories.color, SUM(daily_expenses.amount) as total_amount, COUNT(*) as expense_count").
+			Joins("LEFT JOIN categories ON categories.id = daily_expenses.category_id").
+			Where("daily_expenses.user_id = ? AND daily_expenses.expense_date >= ? AND daily_expenses.expense_date < ?", userID, from, to).
+			Group("daily_expenses.category_id, categories.name, categories.color")
+	}
+	if err := query.Order("total_amount DESC").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make([]SummaryGroup, 0, len(rows))
+	for _, row := range rows {
+		group := SummaryGroup{
+			Key:          "uncategorized",
+			Label:        "Uncategorized",
+			CategoryID:   row.CategoryID,
+			Color:        "#9CA3AF",
+			TotalAmount:  row.TotalAmount,
+			ExpenseCount: row.ExpenseCount,
+		}
+		if row.CategoryID != nil {
+			group.Key = strconv.FormatUint(uint64(*row.CategoryID), 10)
+			group.Label = row.Name
+			group.Color = row.Color
+		}
+		finishSummaryGroup(&group)
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// groupExpensesByTag totals the expenses dated in [from, to) per tag, largest first.
+// Expenses without tags are grouped together.
+func groupExpensesByTag(userID uint, from, to time.Time) ([]SummaryGroup, error) {
+	var rows []struct {
+		Name         string
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+	if err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("expense_tags.name, SUM(daily_expenses.amount) as total_amount, COUNT(*) as expense_count").
+		Joins("JOIN expense_tags ON expense_tags.expense_id = daily_expenses.id").
+		Where("daily_expenses.user_id = ? AND daily_expenses.expense_date >= ? AND daily_expenses.expense_date < ?", userID, from, to).
+		Group("expense_tags.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var untagged struct {
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+	if err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("COALESCE(SUM(amount), 0) as total_amount, COUNT(*) as expense_count").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, from, to).
+		Where("NOT EXISTS (SELECT 1 FROM expense_tags WHERE expense_tags.expense_id = daily_expenses.id)").
+		Scan(&untagged).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make([]SummaryGroup, 0, len(rows)+1)
+	for _, row := range rows {
+		group := SummaryGroup{
+			Key:          row.Name,
+			Label:        row.Name,
+			TotalAmount:  row.TotalAmount,
+			ExpenseCount: row.ExpenseCount,
+		}
+		finishSummaryGroup(&group)
+		groups = append(groups, group)
+	}
+	if untagged.ExpenseCount > 0 {
+		group := SummaryGroup{
+			Key:          "untagged",
+			Label:        "Untagged",
+			TotalAmount:  untagged.TotalAmount,
+			ExpenseCount: untagged.ExpenseCount,
+		}
+		finishSummaryGroup(&group)
+		groups = append(groups, group)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].TotalAmount > groups[j].TotalAmount
+	})
+	return groups, nil
+}
+
+// groupExpensesByAccount totals the expenses dated in [from, to) per bank account they were
+// debited from, largest first. Expenses entered without an account are grouped together.
+func groupExpensesByAccount(userID uint, from, to time.Time) ([]SummaryGroup, error) {
+	var rows []struct {
+		BankAccountID *uint
+		AccountName   string
+		Color         string
+		TotalAmount   float64
+		ExpenseCount  int64
+	}
+	if err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("daily_expenses.bank_account_id, bank_accounts.account_name, bank_accounts.color, SUM(daily_expenses.amount) as total_amount, COUNT(*) as expense_count").
+		Joins("LEFT JOIN bank_accounts ON bank_accounts.id = daily_expenses.bank_account_id").
+		Where("daily_expenses.user_id = ? AND daily_expenses.expense_date >= ? AND daily_expenses.expense_date < ?", userID, from, to).
+		Group("daily_expenses.bank_account_id, bank_accounts.account_name, bank_accounts.color").
+		Order("total_amount DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	groups := make([]SummaryGroup, 0, len(rows))
+	for _, row := range rows {
+		group := SummaryGroup{
+			Key:           "none",
+			Label:         "No account",
+			BankAccountID: row.BankAccountID,
+			Color:         row.Color,
+			TotalAmount:   row.TotalAmount,
+			ExpenseCount:  row.ExpenseCount,
+		}
+		if row.BankAccountID != nil {
+			group.Key = strconv.FormatUint(uint64(*row.BankAccountID), 10)
+			group.Label = row.AccountName
+			if group.Label == "" {
+				group.Label = "Deleted account"
+			}
+		}
+		finishSummaryGroup(&group)
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// addToPeriodGroup adds the totals of a day or month to the group of the period containing it
+func addToPeriodGroup(groups []SummaryGroup, periods []models.Period, date time.Time, amount float64, count int64) {
+	for i, period := range periods {
+		if !date.Before(period.Start) && date.Before(period.End) {
+			groups[i].TotalAmount += amount
+			groups[i].ExpenseCount += count
+			return
+		}
+	}
+}
+
+// rollupMonthRangeSQL selects the monthly rollups from one month index up to, excluding, another
+const rollupMonthRangeSQL = "year * 12 + month - 1 >= ? AND year * 12 + month - 1 < ?"
+
+// monthIndex numbers months consecutively across years, for comparing against rollups
+func monthIndex(day time.Time) int {
+	return day.Year()*12 + int(day.Month()) - 1
+}
+
+// wholeMonths reports whether [from, to) runs from the first of a month to the first of a
+// later one, so the monthly rollups cover it exactly
+func wholeMonths(from, to time.Time) bool {
+	isFirst := func(day time.Time) bool {
+		return day.Equal(time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.Local))
+	}
+	return isFirst(from) && isFirst(to) && from.Before(to)
+}
+
+// finishSummaryGroup rounds a group's total and computes its average
+func finishSummaryGroup(group *SummaryGroup) {
+	group.TotalAmount = roundAmount(group.TotalAmount)
+	if group.ExpenseCount > 0 {
+		group.AverageAmount = roundAmount(group.TotalAmount / float64(group.ExpenseCount))
+	}
+}
+
+// summaryPeriods cuts [from, to) into days, ISO weeks, calendar months or quarters.
+// The first and last periods are clipped to the range.
+func summaryPeriods(from, to time.Time, groupBy string) ([]models.Period, error) {
+	var periods []models.Period
+	for start := from; start.Before(to); {
+		var bucket time.Time
+		switch groupBy {
+		case groupByDay:
+			bucket = start
+		case groupByWeek:
+			bucket = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		case groupByMonth:
+			bucket = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+		case groupByQuarter:
+			bucket = time.Date(start.Year(), (start.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.Local)
+		}
+
+		var end time.Time
+		switch groupBy {
+		case groupByDay:
+			end = bucket.AddDate(0, 0, 1)
+		case groupByWeek:
+			end = bucket.AddDate(0, 0, 7)
+		case groupByMonth:
+			end = bucket.AddDate(0, 1, 0)
+		case groupByQuarter:
+			end = bucket.AddDate(0, 3, 0)
+		}
+		if end.After(to) {
+			end = to
+		}
+
+		if len(periods) == maxSummaryGroups {
+			return nil, errTooManyGroups
+		}
+		periods = append(periods, models.Period{Start: start, End: end, Year: bucket.Year(), Month: int(bucket.Month())})
+		start = end
+	}
+	return periods, nil
+}
+
+// periodKey identifies a time bucket of a summary
+func periodKey(period models.Period, groupBy string) string {
+	switch groupBy {
+	case groupByWeek:
+		year, week := period.Start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case groupByMonth:
+		return fmt.Sprintf("%d-%02d", period.Year, period.Month)
+	case groupByQuarter:
+		return fmt.Sprintf("%d-Q%d", period.Year, (period.Month-1)/3+1)
+	}
+	return period.Start.Format("2006-01-02")
+}
+
+// periodLabel names a time bucket of a summary for display
+func periodLabel(period models.Period, groupBy string) string {
+	switch groupBy {
+	case groupByWeek:
+		year, week := period.Start.ISOWeek()
+		return fmt.Sprintf("Week %d, %d", week, year)
+	case groupByMonth:
+		return fmt.Sprintf("%s %d", time.Month(period.Month), period.Year)
+	case groupByQuarter:
+		return fmt.Sprintf("Q%d %d", (period.Month-1)/3+1, period.Year)
+	}
+	return period.Start.Format("Mon 2 Jan 2006")
+}
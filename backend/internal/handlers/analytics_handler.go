@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+)
+
+type AnalyticsHandler struct{}
+
+func NewAnalyticsHandler() *AnalyticsHandler {
+	return &AnalyticsHandler{}
+}
+
+// heatmapLevels is the number of shades a spending day can take, besides 0 for no spending
+const heatmapLevels = 4
+
+// SpendingHeatmap shows how spending is spread over the days of a year
+type SpendingHeatmap struct {
+	Year          int                  `json:"year"`
+	StartDate     string               `json:"start_date"`
+	EndDate       string               `json:"end_date"`
+	CategoryIDs   []uint               `json:"category_ids,omitempty"`
+	TotalExpenses float64              `json:"total_expenses"`
+	ExpenseCount  int64                `json:"expense_count"`
+	MaxDailyTotal float64              `json:"max_daily_total"`
+	Days          []HeatmapDay         `json:"days"`
+	ByWeekday     []WeekdaySpending    `json:"by_weekday"`
+	ByDayOfMonth  []DayOfMonthSpending `json:"by_day_of_month"`
+	Weekend       SpendingSplit        `json:"weekend"`
+	Weekdays      SpendingSplit        `json:"weekdays"`
+}
+
+// HeatmapDay is one cell of the heatmap, with level 0 (nothing spent) to 4 (the most spent)
+type HeatmapDay struct {
+	Date         string  `json:"date"`
+	TotalAmount  float64 `json:"total_amount"`
+	ExpenseCount int64   `json:"expense_count"`
+	Level        int     `json:"level"`
+}
+
+type WeekdaySpending struct {
+	Weekday       int     `json:"weekday"` // 0 = Sunday
+	Name          string  `json:"name"`
+	TotalAmount   float64 `json:"total_amount"`
+	Days          int     `json:"days"` // Times the weekday occurred so far in the year
+	AverageAmount float64 `json:"average_amount"`
+}
+
+type DayOfMonthSpending struct {
+	Day           int     `json:"day"`
+	TotalAmount   float64 `json:"total_amount"`
+	Days          int     `json:"days"`
+	AverageAmount float64 `json:"average_amount"`
+}
+
+// SpendingSplit totals the spending on either weekend days or the other days
+type SpendingSplit struct {
+	TotalAmount  float64 `json:"total_amount"`
+	Days         int     `json:"days"`
+	DailyAverage float64 `json:"daily_average"`
+	Share        float64 `json:"share"` // Percent of the total
+}
+
+// GetHeatmap returns the daily spending of a year for a calendar heatmap, with the average
+// spending per weekday and per day of the month and the weekend against weekday split.
+// Averages only count days up to today. Repeat ?category_id to limit to some categories.
+func (h *AnalyticsHandler) GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil || year < 1900 || year > 9999 {
+		respondWithError(w, http.StatusBadRequest, "Invalid year")
+		return
+	}
+
+	var categoryIDs []uint
+	for _, param := range r.URL.Query()["category_id"] {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid category ID")
+			return
+		}
+		categoryIDs = append(categoryIDs, uint(id))
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+
+	query := database.GetDB().Model(&models.DailyExpense{}).
+		Select("expense_date, SUM(amount) as total_amount, COUNT(*) as expense_count").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, start, end)
+	if len(categoryIDs) > 0 {
+		query = query.Where("category_id IN ?", categoryIDs)
+	}
+
+	var rows []struct {
+		ExpenseDate  time.Time
+		TotalAmount  float64
+		ExpenseCount int64
+	}
+	if err := query.Group("expense_date").Scan(&rows).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	heatmap := SpendingHeatmap{
+		Year:         year,
+		StartDate:    start.Format("2006-01-02"),
+		EndDate:      end.AddDate(0, 0, -1).Format("2006-01-02"),
+		CategoryIDs:  categoryIDs,
+		Days:         make([]HeatmapDay, 0, models.DaysBetween(start, end)),
+		ByWeekday:    make([]WeekdaySpending, 7),
+		ByDayOfMonth: make([]DayOfMonthSpending, 31),
+	}
+	for weekday := range heatmap.ByWeekday {
+		heatmap.ByWeekday[weekday] = WeekdaySpending{Weekday: weekday, Name: time.Weekday(weekday).String()}
+	}
+	for i := range heatmap.ByDayOfMonth {
+		heatmap.ByDayOfMonth[i].Day = i + 1
+	}
+
+	byDate := make(map[string]int, len(rows))
+	for i, row := range rows {
+		byDate[row.ExpenseDate.Format("2006-01-02")] = i
+	}
+
+	settings := loadBudgetPeriod(userID)
+	elapsedEnd := today().AddDate(0, 0, 1)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		entry := HeatmapDay{Date: day.Format("2006-01-02")}
+		if i, exists := byDate[entry.Date]; exists {
+			entry.TotalAmount = rows[i].TotalAmount
+			entry.ExpenseCount = rows[i].ExpenseCount
+		}
+		heatmap.Days = append(heatmap.Days, entry)
+
+		heatmap.TotalExpenses += entry.TotalAmount
+		heatmap.ExpenseCount += entry.ExpenseCount
+		heatmap.MaxDailyTotal = math.Max(heatmap.MaxDailyTotal, entry.TotalAmount)
+
+		// Days still to come would drag the averages down
+		if !day.Before(elapsedEnd) && entry.ExpenseCount == 0 {
+			continue
+		}
+		weekday := &heatmap.ByWeekday[day.Weekday()]
+		weekday.TotalAmount += entry.TotalAmount
+		weekday.Days++
+		dayOfMonth := &heatmap.ByDayOfMonth[day.Day()-1]
+		dayOfMonth.TotalAmount += entry.TotalAmount
+		dayOfMonth.Days++
+		split := &heatmap.Weekdays
+		if settings.IsWeekend(day) {
+			split = &heatmap.Weekend
+		}
+		split.TotalAmount += entry.TotalAmount
+		split.Days++
+	}
+
+	heatmap.TotalExpenses = roundAmount(heatmap.TotalExpenses)
+	for i := range heatmap.Days {
+		heatmap.Days[i].Level = heatmapLevel(heatmap.Days[i].TotalAmount, heatmap.MaxDailyTotal)
+	}
+	for i := range heatmap.ByWeekday {
+		heatmap.ByWeekday[i].TotalAmount = roundAmount(heatmap.ByWeekday[i].TotalAmount)
+		heatmap.ByWeekday[i].AverageAmount = averagePerDay(heatmap.ByWeekday[i].TotalAmount, heatmap.ByWeekday[i].Days)
+	}
+	for i := range heatmap.ByDayOfMonth {
+		heatmap.ByDayOfMonth[i].TotalAmount = roundAmount(heatmap.ByDayOfMonth[i].TotalAmount)
+		heatmap.ByDayOfMonth[i].AverageAmount = averagePerDay(heatmap.ByDayOfMonth[i].TotalAmount, heatmap.ByDayOfMonth[i].Days)
+	}
+	for _, split := range []*SpendingSplit{&heatmap.Weekend, &heatmap.Weekdays} {
+		split.TotalAmount = roundAmount(split.TotalAmount)
+		split.DailyAverage = averagePerDay(split.TotalAmount, split.Days)
+		if heatmap.TotalExpenses > 0 {
+			split.Share = roundAmount(split.TotalAmount / heatmap.TotalExpenses * 100)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, heatmap)
+}
+
+// heatmapLevel shades a day's spending relative to the day the most was spent
+func heatmapLevel(amount, max float64) int {
+	if amount <= 0 || max <= 0 {
+		return 0
+	}
+	return int(math.Ceil(amount / max * heatmapLevels))
+}
+
+// averagePerDay divides a total over a number of days
+func averagePerDay(total float64, days int) float64 {
+	if days == 0 {
+		return 0
+	}
+	return roundAmount(total / float64(days))
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/anomaly"
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+type AnomalyHandler struct{}
+
+func NewAnomalyHandler() *AnomalyHandler {
+	return &AnomalyHandler{}
+}
+
+// Anomaly reason types
+const (
+	anomalyCategoryOutlier = "category_outlier"
+	anomalyMerchantOutlier = "merchant_outlier"
+	anomalyDuplicate       = "duplicate"
+)
+
+const (
+	anomalyHistoryDays  = 365 // Past expenses a baseline is built from
+	duplicateWindowDays = 3   // Same merchant and amount within this many days is a likely double charge
+)
+
+type SpendingAnomaly struct {
+	Expense models.DailyExpense `json:"expense"`
+	Reasons []AnomalyReason     `json:"reasons"`
+}
+
+type AnomalyReason struct {
+	Type          string            `json:"type"` // category_outlier, merchant_outlier or duplicate
+	Message       string            `json:"message"`
+	ZScore        float64           `json:"z_score,omitempty"`
+	Baseline      *anomaly.Baseline `json:"baseline,omitempty"`
+	DuplicateOfID *uint             `json:"duplicate_of_id,omitempty"`
+}
+
+type SpendingBaselines struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Categories []CategoryBaseline `json:"categories"`
+	Merchants  []MerchantBaseline `json:"merchants"`
+}
+
+type CategoryBaseline struct {
+	CategoryID   *uint            `json:"category_id"`
+	CategoryName string           `json:"category_name"`
+	Baseline     anomaly.Baseline `json:"baseline"`
+	UpperFence   float64          `json:"upper_fence"`
+}
+
+type MerchantBaseline struct {
+	Merchant   string           `json:"merchant"`
+	Baseline   anomaly.Baseline `json:"baseline"`
+	UpperFence float64          `json:"upper_fence"`
+}
+
+// GetAnomalies returns the expenses dated between from and to (default the last 30 days)
+// that stand out against the year of spending before from, or look like double charges
+func (h *AnomalyHandler) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	to := today()
+	if toParam := r.URL.Query().Get("to"); toParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to date. Use YYYY-MM-DD")
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid from date. Use YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		respondWithError(w, http.StatusBadRequest, "from must be on or before to")
+		return
+	}
+
+	var history []models.DailyExpense
+	if err := database.GetDB().
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, from.AddDate(0, 0, -anomalyHistoryDays), from).
+		Find(&history).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	var expenses []models.DailyExpense
+	if err := database.GetDB().Preload("Category").
+		Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, from.AddDate(0, 0, -duplicateWindowDays), to).
+		Order("expense_date DESC, id DESC").
+		Find(&expenses).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	detector := newSpendingDetector(history)
+	anomalies := []SpendingAnomaly{}
+	for i := range expenses {
+		if expenses[i].ExpenseDate.Before(from) {
+			continue // Only there to catch duplicates at the start of the range
+		}
+		if reasons := detector.check(&expenses[i], expenses); len(reasons) > 0 {
+			anomalies = append(anomalies, SpendingAnomaly{Expense: expenses[i], Reasons: reasons})
+		}
+	}
+
+	calendar := displayCalendar(r, userID)
+	for i := range anomalies {
+		setHijriDates(calendar, &anomalies[i].Expense)
+	}
+
+	respondWithJSON(w, http.StatusOK, anomalies)
+}
+
+// GetBaselines returns the spending baselines of the last year per category and merchant
+func (h *AnomalyHandler) GetBaselines(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	to := today()
+	from := to.AddDate(0, 0, -anomalyHistoryDays)
+
+	var history []models.DailyExpense
+	if err := database.GetDB().Preload("Category").
+		Where("user_id = ? AND expense_date > ? AND expense_date <= ?", userID, from, to).
+		Find(&history).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	detector := newSpendingDetector(history)
+	baselines := SpendingBaselines{
+		From:       from.AddDate(0, 0, 1).Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		Categories: make([]CategoryBaseline, 0, len(detector.categories)),
+		Merchants:  make([]MerchantBaseline, 0, len(detector.merchants)),
+	}
+
+	categoryNames := make(map[uint]string)
+	for i := range history {
+		if history[i].Category != nil {
+			categoryNames[history[i].Category.ID] = history[i].Category.Name
+		}
+	}
+	for categoryID, baseline := range detector.categories {
+		entry := CategoryBaseline{CategoryName: "Uncategorized", Baseline: roundBaseline(baseline), UpperFence: roundAmount(baseline.UpperFence())}
+		if categoryID != 0 {
+			id := categoryID
+			entry.CategoryID = &id
+			entry.CategoryName = categoryNames[categoryID]
+		}
+		baselines.Categories = append(baselines.Categories, entry)
+	}
+	for merchant, baseline := range detector.merchants {
+		baselines.Merchants = append(baselines.Merchants, MerchantBaseline{
+			Merchant:   merchant,
+			Baseline:   roundBaseline(baseline),
+			UpperFence: roundAmount(baseline.UpperFence()),
+		})
+	}
+
+	sort.Slice(baselines.Categories, func(i, j int) bool {
+		return baselines.Categories[i].CategoryName < baselines.Categories[j].CategoryName
+	})
+	sort.Slice(baselines.Merchants, func(i, j int) bool {
+		return baselines.Merchants[i].Merchant < baselines.Merchants[j].Merchant
+	})
+
+	respondWithJSON(w, http.StatusOK, baselines)
+}
+
+// spendingDetector holds the baselines of a user's past expenses per category and merchant
+type spendingDetector struct {
+	categories map[uint]anomaly.Baseline // 0 for uncategorized expenses
+	merchants  map[string]anomaly.Baseline
+}
+
+func newSpendingDetector(history []models.DailyExpense) *spendingDetector {
+	categoryAmounts := make(map[uint][]float64)
+	merchantAmounts := make(map[string][]float64)
+	for i := range history {
+		categoryAmounts[categoryKey(&history[i])] = append(categoryAmounts[categoryKey(&history[i])], history[i].Amount)
+		if merchant := merchantKey(&history[i]); merchant != "" {
+			merchantAmounts[merchant] = append(merchantAmounts[merchant], history[i].Amount)
+		}
+	}
+
+	detector := &spendingDetector{
+		categories: make(map[uint]anomaly.Baseline, len(categoryAmounts)),
+		merchants:  make(map[string]anomaly.Baseline, len(merchantAmounts)),
+	}
+	for key, amounts := range categoryAmounts {
+		detector.categories[key] = anomaly.NewBaseline(amounts)
+	}
+	for key, amounts := range merchantAmounts {
+		detector.merchants[key] = anomaly.NewBaseline(amounts)
+	}
+	return detector
+}
+
+// check returns why an expense looks unusual, if it does. Nearby expenses are searched for
+// an earlier charge of the same amount at the same merchant.
+func (d *spendingDetector) check(expense *models.DailyExpense, nearby []models.DailyExpense) []AnomalyReason {
+	var reasons []AnomalyReason
+
+	if baseline, exists := d.categories[categoryKey(expense)]; exists && baseline.IsOutlier(expense.Amount) {
+		name := "uncategorized expenses"
+		if expense.Category != nil {
+			name = expense.Category.Name
+		}
+		rounded := roundBaseline(baseline)
+		reasons = append(reasons, AnomalyReason{
+			Type:     anomalyCategoryOutlier,
+			Message:  fmt.Sprintf("%.2f is well above the usual %.2f for %s", expense.Amount, rounded.Median, name),
+			ZScore:   math.Round(baseline.ZScore(expense.Amount)*100) / 100,
+			Baseline: &rounded,
+		})
+	}
+
+	merchant := merchantKey(expense)
+	if merchant == "" {
+		return reasons
+	}
+
+	if baseline, exists := d.merchants[merchant]; exists && baseline.IsOutlier(expense.Amount) {
+		rounded := roundBaseline(baseline)
+		reasons = append(reasons, AnomalyReason{
+			Type:     anomalyMerchantOutlier,
+			Message:  fmt.Sprintf("%.2f is well above the usual %.2f at %s", expense.Amount, rounded.Median, merchantName(expense)),
+			ZScore:   math.Round(baseline.ZScore(expense.Amount)*100) / 100,
+			Baseline: &rounded,
+		})
+	}
+
+	for i := range nearby {
+		other := &nearby[i]
+		// Only the later of two matching charges is flagged
+		if other.ID >= expense.ID || other.Amount != expense.Amount || merchantKey(other) != merchant {
+			continue
+		}
+		if days := models.DaysBetween(other.ExpenseDate, expense.ExpenseDate); days < -duplicateWindowDays || days > duplicateWindowDays {
+			continue
+		}
+		id := other.ID
+		reasons = append(reasons, AnomalyReason{
+			Type:          anomalyDuplicate,
+			Message:       fmt.Sprintf("Same amount charged by %s on %s", merchantName(expense), other.ExpenseDate.Format("2006-01-02")),
+			DuplicateOfID: &id,
+		})
+		break
+	}
+
+	return reasons
+}
+
+// notifyExpenseAnomalies notifies the user when a new expense looks unusual, if they opted in
+func notifyExpenseAnomalies(userID uint, expense *models.DailyExpense) error {
+	var user models.User
+	if err := database.GetDB().Select("id", "anomaly_notifications").First(&user, userID).Error; err != nil {
+		return err
+	}
+	if !user.AnomalyNotifications {
+		return nil
+	}
+
+	var history []models.DailyExpense
+	if err := database.GetDB().
+		Where("user_id = ? AND id <> ? AND expense_date >= ? AND expense_date <= ?",
+			userID, expense.ID, expense.ExpenseDate.AddDate(0, 0, -anomalyHistoryDays), expense.ExpenseDate).
+		Find(&history).Error; err != nil {
+		return err
+	}
+
+	var nearby []models.DailyExpense
+	for i := range history {
+		if models.DaysBetween(history[i].ExpenseDate, expense.ExpenseDate) <= duplicateWindowDays {
+			nearby = append(nearby, history[i])
+		}
+	}
+
+	reasons := newSpendingDetector(history).check(expense, nearby)
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		messages = append(messages, reason.Message)
+	}
+
+	title := "Unusual expense"
+	if name := merchantName(expense); name != "" {
+		title = "Unusual expense: " + name
+	}
+	return database.GetDB().Create(&models.Notification{
+		UserID:    userID,
+		Type:      models.NotificationSpendingAnomaly,
+		Title:     title,
+		Message:   strings.Join(messages, ". "),
+		ExpenseID: &expense.ID,
+	}).Error
+}
+
+// categoryKey groups expenses by category, with 0 for uncategorized ones
+func categoryKey(expense *models.DailyExpense) uint {
+	if expense.CategoryID == nil {
+		return 0
+	}
+	return *expense.CategoryID
+}
+
+// merchantKey groups expenses by merchant, falling back to the description
+func merchantKey(expense *models.DailyExpense) string {
+	return strings.ToLower(strings.TrimSpace(merchantName(expense)))
+}
+
+// merchantName returns the merchant of an expense, or its description when no merchant is set
+func merchantName(expense *models.DailyExpense) string {
+	if merchant := strings.TrimSpace(expense.Merchant); merchant != "" {
+		return merchant
+	}
+	return strings.TrimSpace(expense.Description)
+}
+
+// roundBaseline rounds the amounts of a baseline for display
+func roundBaseline(baseline anomaly.Baseline) anomaly.Baseline {
+	baseline.Mean = roundAmount(baseline.Mean)
+	baseline.StdDev = roundAmount(baseline.StdDev)
+	baseline.Median = roundAmount(baseline.Median)
+	baseline.Q1 = roundAmount(baseline.Q1)
+	baseline.Q3 = roundAmount(baseline.Q3)
+	return baseline
+}
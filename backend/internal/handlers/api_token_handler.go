@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+type APITokenHandler struct{}
+
+func NewAPITokenHandler() *APITokenHandler {
+	return &APITokenHandler{}
+}
+
+// maxAPITokens limits how many API tokens a user can hold at once
+const maxAPITokens = 50
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days"` // Omit for a token that does not expire
+}
+
+// CreatedAPIToken is the response to creating a token, the only time the token itself is shown
+type CreatedAPIToken struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// GetAPITokens returns the API tokens of the authenticated user, newest first
+func (h *APITokenHandler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var tokens []models.APIToken
+	if err := database.GetDB().Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&tokens).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch API tokens")
+		return
+	}
+	for i := range tokens {
+		tokens[i].ScopeList = tokens[i].GetScopes()
+	}
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// CreateAPIToken creates an API token with a name, scopes and an optional expiry
+func (h *APITokenHandler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if message := validateAPITokenRequest(&req); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	var count int64
+	if err := database.GetDB().Model(&models.APIToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+	if count >= maxAPITokens {
+		respondWithError(w, http.StatusBadRequest, "Too many API tokens, delete one first")
+		return
+	}
+
+	token, hash, err := utils.GenerateAPIToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate API token")
+		return
+	}
+
+	apiToken := models.APIToken{
+		UserID:      userID,
+		Name:        req.Name,
+		TokenPrefix: token[:len(utils.APITokenPrefix)+6],
+		TokenHash:   hash,
+		Scopes:      strings.Join(req.Scopes, ","),
+	}
+	if req.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := database.GetDB().Create(&apiToken).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+	apiToken.ScopeList = apiToken.GetScopes()
+
+	respondWithJSON(w, http.StatusCreated, CreatedAPIToken{APIToken: apiToken, Token: token})
+}
+
+// DeleteAPIToken deletes an API token of the authenticated user; it stops working immediately
+func (h *APITokenHandler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API token ID")
+		return
+	}
+
+	result := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete API token")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondWithError(w, http.StatusNotFound, "API token not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "API token deleted successfully"})
+}
+
+// validateAPITokenRequest checks a new token's fields, trimming the name and sorting and
+// deduplicating the scopes, and returns an error message if any field is invalid
+func validateAPITokenRequest(req *CreateAPITokenRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "Name is required"
+	}
+	if len(req.Name) > 100 {
+		return "Name must be at most 100 characters"
+	}
+
+	if len(req.Scopes) == 0 {
+		return "At least one scope is required"
+	}
+	seen := make(map[string]bool, len(req.Scopes))
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !models.IsValidScope(scope) {
+			return "Invalid scope: " + scope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	req.Scopes = scopes
+
+	if req.ExpiresInDays != nil && (*req.ExpiresInDays < 1 || *req.ExpiresInDays > 3650) {
+		return "Expiry must be between 1 and 3650 days"
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func TestGetAPITokensListsNoneAsEmptyArray(t *testing.T) {
+	testutil.OpenDB(t)
+	handler := NewAPITokenHandler()
+
+	w := testutil.Serve(handler.GetAPITokens, testutil.AsUser(testutil.Request(t, http.MethodGet, "/api/auth/tokens", nil), 1))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("status %d, body %q, want 200 and []", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateAPITokenFailsClosedWhenTokensCannotBeCounted(t *testing.T) {
+	db := testutil.OpenDB(t)
+	handler := NewAPITokenHandler()
+	if err := db.Migrator().DropTable(&models.APIToken{}); err != nil {
+		t.Fatalf("dropping tokens: %v", err)
+	}
+
+	r := testutil.Request(t, http.MethodPost, "/api/auth/tokens", map[string]interface{}{
+		"name": "Script", "scopes": []string{models.ScopeRead},
+	})
+	w := testutil.Serve(handler.CreateAPIToken, testutil.AsUser(r, 1))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500: %s", w.Code, w.Body.String())
+	}
+}
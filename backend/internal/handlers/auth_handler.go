@@ -2,19 +2,55 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/abdelrahman/expense-manager/internal/config"
 	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/mail"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/oidc"
+	"github.com/abdelrahman/expense-manager/internal/passwordpolicy"
 	"github.com/abdelrahman/expense-manager/internal/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type AuthHandler struct{}
+type AuthHandler struct {
+	config    *config.Config
+	mailer    mail.Sender
+	passwords *passwordpolicy.Policy    // Checked for every new password
+	providers map[string]*oidc.Provider // OpenID Connect providers by name
+	runLater  func(func())              // Runs work the response does not wait for, such as sending mail
+}
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(cfg *config.Config, mailer mail.Sender, passwords *passwordpolicy.Policy) *AuthHandler {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			IssuerURL:    p.IssuerURL,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		})
+	}
+	return &AuthHandler{
+		config:    cfg,
+		mailer:    mailer,
+		passwords: passwords,
+		providers: providers,
+		runLater:  func(f func()) { go f() },
+	}
 }
 
 type RegisterRequest struct {
@@ -28,11 +64,39 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token        string       `json:"token"` // Access token, sent as "Authorization: Bearer <token>"
+	ExpiresAt    time.Time    `json:"expires_at"`
+	RefreshToken string       `json:"refresh_token"`
+	User         *models.User `json:"user"`
 }
 
+var (
+	errRefreshTokenReused = errors.New("refresh token reused")
+	errResetTokenUsed     = errors.New("reset token already used")
+	errVerifyTokenUsed    = errors.New("verification token already used")
+	errEmailTaken         = errors.New("email already registered")
+)
+
 // Register creates a new user account
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
@@ -42,20 +106,19 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
+	req.Email = normalizeEmail(req.Email)
 	if req.Email == "" || req.Password == "" || req.Name == "" {
 		respondWithError(w, http.StatusBadRequest, "Email, password, and name are required")
 		return
 	}
 
-	// Validate email format
-	if !strings.Contains(req.Email, "@") {
-		respondWithError(w, http.StatusBadRequest, "Invalid email format")
+	if message := validateEmail(req.Email); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
 		return
 	}
 
-	// Validate password length
-	if len(req.Password) < 6 {
-		respondWithError(w, http.StatusBadRequest, "Password must be at least 6 characters")
+	if message := h.validatePassword(req.Password, req.Email, req.Name); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
 		return
 	}
 
@@ -82,17 +145,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	// The account works without verification; a failed email can be resent later
+	if err := h.sendEmailVerification(&user, user.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	response, err := h.startSession(r, &user)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  &user,
-	})
+	respondWithJSON(w, http.StatusCreated, response)
 }
 
 // Login authenticates a user and returns a JWT token
@@ -104,35 +168,296 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
+	req.Email = normalizeEmail(req.Email)
 	if req.Email == "" || req.Password == "" {
 		respondWithError(w, http.StatusBadRequest, "Email and password are required")
 		return
 	}
 
+	// Throttle before looking the email up, so a locked email answers the same whether or not it exists
+	ip := middleware.ClientIP(r)
+	wait, err := h.loginRetryAfter(req.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+	if wait > 0 {
+		recordLoginAttempt(r, req.Email, nil, models.LoginThrottled)
+		respondThrottled(w, wait)
+		return
+	}
+
 	// Find user by email
 	var user models.User
 	if err := database.GetDB().Where("email = ?", req.Email).First(&user).Error; err != nil {
+		checkDummyPassword(req.Password)
+		recordLoginAttempt(r, req.Email, nil, models.LoginInvalidCredentials)
 		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
 	// Check password
 	if !user.CheckPassword(req.Password) {
+		recordLoginAttempt(r, req.Email, &user.ID, models.LoginInvalidCredentials)
 		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
+	uncountLoginAttempt(req.Email, ip)
+
+	h.signIn(w, r, &user)
+}
+
+// signIn finishes a first sign-in step: it starts a session, or with two-factor authentication
+// on, returns a challenge for the second step instead
+func (h *AuthHandler) signIn(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if user.HasTOTP() {
+		// Not a success yet: it must not clear the failures the second step is throttled by
+		recordLoginAttempt(r, user.Email, &user.ID, models.LoginMFARequired)
+		token, expiresAt, err := utils.GenerateMFAToken(user.ID, h.config.MFATokenTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt})
+		return
+	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	recordLoginAttempt(r, user.Email, &user.ID, models.LoginSucceeded)
+	clearLoginFailures(user.Email)
+
+	response, err := h.startSession(r, user)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, AuthResponse{
-		Token: token,
-		User:  &user,
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token that was already exchanged revokes its whole session, since either
+// the client or someone who stole the token is replaying it.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := database.GetDB().Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&stored).Error; err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	var session models.Session
+	if err := database.GetDB().First(&session, stored.SessionID).Error; err != nil || !session.IsActive() {
+		respondWithError(w, http.StatusUnauthorized, "Session has expired or been revoked")
+		return
+	}
+	if stored.UsedAt != nil {
+		revokeSession(session.ID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has already been used. The session has been revoked")
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has expired")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, stored.UserID).Error; err != nil {
+		respondWithError(w, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	var refreshToken string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Only one of two concurrent refreshes with the same token can win
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"ip_address":   middleware.ClientIP(r),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		refreshToken, err = h.issueRefreshToken(tx, &session)
+		return err
 	})
+	if errors.Is(err, errRefreshTokenReused) {
+		revokeSession(session.ID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has already been used. The session has been revoked")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	response, err := tokenResponse(&user, &session, refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Logout revokes the session of a refresh token, so neither it nor the session's
+// access tokens can be used again
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	// Unknown tokens are ignored so logging out twice is harmless
+	var stored models.RefreshToken
+	if err := database.GetDB().Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&stored).Error; err == nil {
+		if err := revokeSession(stored.SessionID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// GetSessions returns the active sessions of the authenticated user, most recently used first
+func (h *AuthHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var sessions []models.Session
+	if err := database.GetDB().
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	currentID, _ := middleware.GetSessionID(r)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// DeleteSession signs the authenticated user out of one of their sessions, on this device or another
+func (h *AuthHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	var session models.Session
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if err := revokeSession(session.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Session revoked successfully"})
+}
+
+// startSession signs a user in on a new session for the requesting device and returns its tokens
+func (h *AuthHandler) startSession(r *http.Request, user *models.User) (AuthResponse, error) {
+	session := models.Session{
+		UserID:     user.ID,
+		UserAgent:  middleware.ClientUserAgent(r),
+		IPAddress:  middleware.ClientIP(r),
+		LastSeenAt: time.Now(),
+	}
+
+	var refreshToken string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		refreshToken, err = h.issueRefreshToken(tx, &session)
+		return err
+	})
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return tokenResponse(user, &session, refreshToken)
+}
+
+// issueRefreshToken stores a new refresh token for a session and extends the session to its expiry
+func (h *AuthHandler) issueRefreshToken(tx *gorm.DB, session *models.Session) (string, error) {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(h.config.RefreshTokenTTL)
+	if err := tx.Create(&models.RefreshToken{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		return "", err
+	}
+
+	session.ExpiresAt = expiresAt
+	if err := tx.Model(session).Update("expires_at", expiresAt).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokenResponse signs an access token for a session and pairs it with a refresh token
+func tokenResponse(user *models.User, session *models.Session, refreshToken string) (AuthResponse, error) {
+	token, err := utils.GenerateToken(user.ID, user.Email, session.ID)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+
+	return AuthResponse{
+		Token:        token,
+		ExpiresAt:    time.Now().Add(utils.AccessTokenTTL()),
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// revokeSession revokes a session, rejecting its access tokens and refresh tokens from now on
+func revokeSession(sessionID uint) error {
+	return database.GetDB().Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
 }
 
 // GetCurrentUser returns the authenticated user's information
@@ -167,7 +492,9 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var updateData struct {
-		Name string `json:"name"`
+		Name                 string `json:"name"`
+		Calendar             string `json:"calendar"`
+		AnomalyNotifications *bool  `json:"anomaly_notifications"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
@@ -179,6 +506,18 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		user.Name = updateData.Name
 	}
 
+	if updateData.Calendar != "" {
+		calendar := strings.ToLower(updateData.Calendar)
+		if calendar != models.CalendarGregorian && calendar != models.CalendarHijri {
+			respondWithError(w, http.StatusBadRequest, "Calendar must be gregorian or hijri")
+			return
+		}
+		user.Calendar = calendar
+	}
+	if updateData.AnomalyNotifications != nil {
+		user.AnomalyNotifications = *updateData.AnomalyNotifications
+	}
+
 	if err := database.GetDB().Save(&user).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update profile")
 		return
@@ -186,3 +525,424 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	respondWithJSON(w, http.StatusOK, user)
 }
+
+// ChangePassword sets a new password for the authenticated user after checking the current
+// one, and signs out every other session
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, &user, req.CurrentPassword, "Current password is incorrect") {
+		return
+	}
+	uncountLoginAttempt(user.Email, middleware.ClientIP(r))
+	if message := h.validatePassword(req.NewPassword, user.Email, user.Name); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+	if err := user.HashPassword(req.NewPassword); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	sessionID, _ := middleware.GetSessionID(r)
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", user.Password).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID, sessionID)
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether or not
+// the email is registered, so it cannot be used to find out who has an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || normalizeEmail(req.Email) == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+	req.Email = normalizeEmail(req.Email)
+
+	// The reply goes out before the email is even looked up, so neither its timing nor a
+	// failure tells whether the email is registered
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "If the email is registered, a password reset link has been sent"})
+	h.runLater(func() { h.sendPasswordReset(req.Email) })
+}
+
+// sendPasswordReset emails a reset link when the email belongs to a user, logging failures
+func (h *AuthHandler) sendPasswordReset(email string) {
+	var user models.User
+	if err := database.GetDB().Where("email = ?", email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to look up user for password reset: %v", err)
+		}
+		return
+	}
+
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to create password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	// Only the latest link works
+	now := time.Now()
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hash,
+			ExpiresAt: now.Add(h.config.ResetTokenTTL),
+		}).Error
+	}); err != nil {
+		log.Printf("Failed to create password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	link := h.appLink("/reset-password", token)
+	body := fmt.Sprintf("Hello %s,\n\nUse this link to choose a new password. It expires in %s and works once.\n\n%s\n\nIf you did not ask for this, ignore this email; your password stays the same.\n",
+		user.Name, h.config.ResetTokenTTL, link)
+	if err := h.mailer.Send(user.Email, "Reset your password", body); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+// ResetPassword sets a new password with a token from a reset email and signs out every session
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Reset token is required")
+		return
+	}
+
+	var reset models.PasswordResetToken
+	if err := database.GetDB().Where("token_hash = ?", utils.HashToken(req.Token)).First(&reset).Error; err != nil ||
+		reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		respondWithError(w, http.StatusBadRequest, "Reset link is invalid or has expired")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, reset.UserID).Error; err != nil {
+		respondWithError(w, http.StatusBadRequest, "Reset link is invalid or has expired")
+		return
+	}
+
+	if message := h.validatePassword(req.NewPassword, user.Email, user.Name); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+	if err := user.HashPassword(req.NewPassword); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenUsed
+		}
+
+		if err := tx.Model(&user).Update("password", user.Password).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID, 0)
+	})
+	if errors.Is(err, errResetTokenUsed) {
+		respondWithError(w, http.StatusBadRequest, "Reset link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password reset successfully"})
+}
+
+// ResendEmailVerification emails a new verification link for the user's current address
+func (h *AuthHandler) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.IsEmailVerified() {
+		respondWithError(w, http.StatusBadRequest, "Email is already verified")
+		return
+	}
+
+	if err := h.sendEmailVerification(&user, user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
+
+// ChangeEmail starts moving the account to a new address. The address only changes once
+// the link emailed to it is opened; until then the user signs in with the old one.
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, &user, req.CurrentPassword, "Current password is incorrect") {
+		return
+	}
+	uncountLoginAttempt(user.Email, middleware.ClientIP(r))
+
+	newEmail := normalizeEmail(req.NewEmail)
+	if message := validateEmail(newEmail); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+	if newEmail == user.Email {
+		respondWithError(w, http.StatusBadRequest, "New email is the same as the current one")
+		return
+	}
+
+	var count int64
+	if err := database.GetDB().Model(&models.User{}).Where("email = ?", newEmail).Count(&count).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to change email")
+		return
+	}
+	if count > 0 {
+		respondWithError(w, http.StatusConflict, "Email already registered")
+		return
+	}
+
+	if err := h.sendEmailVerification(&user, newEmail); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to send confirmation email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "Open the link sent to the new address to finish changing your email",
+	})
+}
+
+// VerifyEmail uses a token from a verification email. It marks the address as verified, and
+// for an email change also switches the account to the new address and tells the old one.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Verification token is required")
+		return
+	}
+
+	var verification models.EmailVerificationToken
+	if err := database.GetDB().Where("token_hash = ?", utils.HashToken(req.Token)).First(&verification).Error; err != nil ||
+		verification.UsedAt != nil || time.Now().After(verification.ExpiresAt) {
+		respondWithError(w, http.StatusBadRequest, "Verification link is invalid or has expired")
+		return
+	}
+
+	var user models.User
+	var oldEmail string
+	now := time.Now()
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Locked so verifications for the same user apply one at a time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, verification.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errVerifyTokenUsed
+			}
+			return err
+		}
+		oldEmail = user.Email
+
+		result := tx.Model(&models.EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", verification.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVerifyTokenUsed
+		}
+
+		if verification.Email != user.Email {
+			var count int64
+			if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", verification.Email, user.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errEmailTaken
+			}
+
+			// Links sent before the change, to the old address or to other new ones, would
+			// otherwise still switch the account to their address
+			if err := tx.Model(&models.EmailVerificationToken{}).
+				Where("user_id = ? AND used_at IS NULL", user.ID).
+				Update("used_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		user.Email = verification.Email
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email":             user.Email,
+			"email_verified_at": now,
+		}).Error
+	})
+	if errors.Is(err, errVerifyTokenUsed) {
+		respondWithError(w, http.StatusBadRequest, "Verification link is invalid or has expired")
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email already registered")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	if oldEmail != user.Email {
+		body := fmt.Sprintf("Hello %s,\n\nThe email address of your account was changed to %s. If you did not do this, reset your password and contact support.\n",
+			user.Name, user.Email)
+		if err := h.mailer.Send(oldEmail, "Your email address was changed", body); err != nil {
+			log.Printf("Failed to send email change notice to user %d: %v", user.ID, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// sendEmailVerification creates a verification token for an address of the user and emails
+// the link to it. A new token replaces earlier unused ones for the same purpose: verifying
+// the current address, or changing to another one.
+func (h *AuthHandler) sendEmailVerification(user *models.User, email string) error {
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		pending := tx.Model(&models.EmailVerificationToken{}).Where("user_id = ? AND used_at IS NULL", user.ID)
+		if email == user.Email {
+			pending = pending.Where("email = ?", email)
+		} else {
+			pending = pending.Where("email <> ?", user.Email)
+		}
+		if err := pending.Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:    user.ID,
+			Email:     email,
+			TokenHash: hash,
+			ExpiresAt: now.Add(h.config.VerifyTokenTTL),
+		}).Error
+	}); err != nil {
+		return err
+	}
+
+	subject := "Verify your email address"
+	intro := "Use this link to verify your email address."
+	if email != user.Email {
+		subject = "Confirm your new email address"
+		intro = "Use this link to make this your account's email address."
+	}
+	body := fmt.Sprintf("Hello %s,\n\n%s It expires in %s.\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+		user.Name, intro, h.config.VerifyTokenTTL, h.appLink("/verify-email", token))
+	return h.mailer.Send(email, subject, body)
+}
+
+// appLink builds a frontend link carrying an emailed token
+func (h *AuthHandler) appLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(h.config.AppURL, "/"), path, url.QueryEscape(token))
+}
+
+// normalizeEmail trims an email address and lowercases it so lookups match however it was typed
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail returns why an email address is not acceptable, or an empty string
+func validateEmail(email string) string {
+	if len(email) > 255 {
+		return "Email is too long"
+	}
+	// A bare address only: no display name, comments or surrounding brackets
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "Invalid email format"
+	}
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	if at < 1 || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") ||
+		strings.Contains(domain, "..") || strings.ContainsAny(domain, "[]") {
+		return "Invalid email format"
+	}
+	return ""
+}
+
+// validatePassword returns why a new password for an account is not acceptable under the
+// password policy, or an empty string
+func (h *AuthHandler) validatePassword(password, email, name string) string {
+	return h.passwords.Check(password, passwordpolicy.Account{Email: email, Name: name})
+}
+
+// revokeUserSessions revokes every active session of a user except keepSessionID (0 for none)
+func revokeUserSessions(tx *gorm.DB, userID, keepSessionID uint) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/config"
+	"github.com/abdelrahman/expense-manager/internal/mail"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+// waitForLater makes the handler's deferred work waitable
+func waitForLater(handler *AuthHandler) *sync.WaitGroup {
+	var pending sync.WaitGroup
+	handler.runLater = func(f func()) {
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			f()
+		}()
+	}
+	return &pending
+}
+
+func TestForgotPasswordRespondsAlikeAndMailsInBackground(t *testing.T) {
+	db := testutil.OpenDB(t)
+	server := testutil.StartSMTP(t)
+	handler := NewAuthHandler(&config.Config{AppURL: "https://app.example.com", ResetTokenTTL: time.Hour},
+		mail.NewSender(server.Host, server.Port, "", "", "app@example.com"), nil)
+	pending := waitForLater(handler)
+
+	user := models.User{Email: "user@example.com", Password: "x", Name: "User"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	forgot := func(email string) string {
+		w := testutil.Serve(handler.ForgotPassword,
+			testutil.Request(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{"email": email}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("forgot password for %s: status %d: %s", email, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	registered := forgot(" User@Example.com ")
+	pending.Wait()
+	email := server.Next(t)
+	if len(email.To) != 1 || email.To[0] != "user@example.com" || !strings.Contains(email.Data, "https://app.example.com/reset-password?token=") {
+		t.Errorf("reset email to %v:\n%s", email.To, email.Data)
+	}
+	var tokens int64
+	db.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&tokens)
+	if tokens != 1 {
+		t.Errorf("%d usable reset tokens, want 1", tokens)
+	}
+
+	unknown := forgot("nobody@example.com")
+	pending.Wait()
+	if unknown != registered {
+		t.Errorf("responses differ: %q for a registered email, %q for an unknown one", registered, unknown)
+	}
+	server.ExpectNone(t, 50*time.Millisecond)
+}
+
+func TestForgotPasswordDoesNotFailForRegisteredEmails(t *testing.T) {
+	db := testutil.OpenDB(t)
+	server := testutil.StartSMTP(t)
+	handler := NewAuthHandler(&config.Config{ResetTokenTTL: time.Hour},
+		mail.NewSender(server.Host, server.Port, "", "", "app@example.com"), nil)
+	pending := waitForLater(handler)
+	if err := db.Create(&models.User{Email: "user@example.com", Password: "x", Name: "User"}).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	// Creating the token fails, which only a registered email gets far enough to hit
+	if err := db.Migrator().DropTable(&models.PasswordResetToken{}); err != nil {
+		t.Fatalf("dropping reset tokens: %v", err)
+	}
+	w := testutil.Serve(handler.ForgotPassword,
+		testutil.Request(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{"email": "user@example.com"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	pending.Wait()
+	server.ExpectNone(t, 50*time.Millisecond)
+}
+
+// issueVerification stores a verification token for an address of the user
+func issueVerification(t *testing.T, db *gorm.DB, userID uint, email string) string {
+	t.Helper()
+	token, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.EmailVerificationToken{
+		UserID: userID, Email: email, TokenHash: hash, ExpiresAt: time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatalf("creating verification token: %v", err)
+	}
+	return token
+}
+
+func TestVerifyEmailChangeRetiresEarlierLinks(t *testing.T) {
+	db := testutil.OpenDB(t)
+	handler := NewAuthHandler(&config.Config{}, mail.LogSender{}, nil)
+	user := models.User{Email: "old@example.com", Password: "x", Name: "User"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	verifyOld := issueVerification(t, db, user.ID, "old@example.com")
+	changeToNew := issueVerification(t, db, user.ID, "new@example.com")
+
+	verify := func(token string) int {
+		return testutil.Serve(handler.VerifyEmail,
+			testutil.Request(t, http.MethodPost, "/api/auth/verify-email", map[string]string{"token": token})).Code
+	}
+
+	if code := verify(changeToNew); code != http.StatusOK {
+		t.Fatalf("verifying the change: status %d", code)
+	}
+	if code := verify(verifyOld); code != http.StatusBadRequest {
+		t.Errorf("a link for the previous address: status %d, want 400", code)
+	}
+
+	db.First(&user, user.ID)
+	if user.Email != "new@example.com" {
+		t.Errorf("email = %q, want new@example.com", user.Email)
+	}
+}
+
+// signInTokens logs the guard test user in and returns their tokens
+func signInTokens(t *testing.T, handler *AuthHandler) AuthResponse {
+	t.Helper()
+	w := testutil.Serve(handler.Login, testutil.Request(t, http.MethodPost, "/api/auth/login",
+		LoginRequest{Email: "user@example.com", Password: guardTestPassword}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	var response AuthResponse
+	testutil.DecodeJSON(t, w, &response)
+	return response
+}
+
+// refresh exchanges a refresh token, returning the status and the new tokens
+func refresh(t *testing.T, handler *AuthHandler, refreshToken string) (int, AuthResponse) {
+	t.Helper()
+	w := testutil.Serve(handler.Refresh, testutil.Request(t, http.MethodPost, "/api/auth/refresh",
+		RefreshRequest{RefreshToken: refreshToken}))
+	var response AuthResponse
+	if w.Code == http.StatusOK {
+		testutil.DecodeJSON(t, w, &response)
+	}
+	return w.Code, response
+}
+
+// authenticate returns the status middleware.Auth answers a request made with an access token with
+func authenticate(t *testing.T, accessToken string) int {
+	t.Helper()
+	r := testutil.Request(t, http.MethodGet, "/api/auth/me", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	return testutil.Serve(middleware.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP, r).Code
+}
+
+func TestRefreshRotatesTheRefreshToken(t *testing.T) {
+	db, handler, _ := newGuardTest(t)
+	first := signInTokens(t, handler)
+
+	code, second := refresh(t, handler, first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: status %d", code)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Errorf("refresh returned refresh token %q, want a new one", second.RefreshToken)
+	}
+	if got := authenticate(t, second.Token); got != http.StatusOK {
+		t.Errorf("new access token: status %d, want 200", got)
+	}
+
+	var used models.RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(first.RefreshToken)).First(&used).Error; err != nil {
+		t.Fatalf("loading the exchanged token: %v", err)
+	}
+	if used.UsedAt == nil {
+		t.Error("the exchanged refresh token is not marked used")
+	}
+
+	if code, third := refresh(t, handler, second.RefreshToken); code != http.StatusOK || third.RefreshToken == second.RefreshToken {
+		t.Errorf("refreshing with the new token: status %d, refresh token %q", code, third.RefreshToken)
+	}
+}
+
+func TestReplayedRefreshTokenRevokesTheSession(t *testing.T) {
+	db, handler, _ := newGuardTest(t)
+	first := signInTokens(t, handler)
+	code, second := refresh(t, handler, first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: status %d", code)
+	}
+
+	if code, _ := refresh(t, handler, first.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("replaying a used refresh token: status %d, want 401", code)
+	}
+
+	var sessions []models.Session
+	db.Find(&sessions)
+	if len(sessions) != 1 || sessions[0].RevokedAt == nil {
+		t.Fatalf("sessions after the replay = %+v, want the one session revoked", sessions)
+	}
+	if code, _ := refresh(t, handler, second.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refreshing with the latest token after a replay: status %d, want 401", code)
+	}
+	for name, token := range map[string]string{"first": first.Token, "second": second.Token} {
+		if got := authenticate(t, token); got != http.StatusUnauthorized {
+			t.Errorf("%s access token after a replay: status %d, want 401", name, got)
+		}
+	}
+}
+
+func TestLogoutRevokesTheSession(t *testing.T) {
+	_, handler, _ := newGuardTest(t)
+	tokens := signInTokens(t, handler)
+	other := signInTokens(t, handler)
+
+	logout := func() int {
+		return testutil.Serve(handler.Logout, testutil.Request(t, http.MethodPost, "/api/auth/logout",
+			RefreshRequest{RefreshToken: tokens.RefreshToken})).Code
+	}
+	if code := logout(); code != http.StatusOK {
+		t.Fatalf("logout: status %d", code)
+	}
+
+	if got := authenticate(t, tokens.Token); got != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want 401", got)
+	}
+	if code, _ := refresh(t, handler, tokens.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: status %d, want 401", code)
+	}
+	if got := authenticate(t, other.Token); got != http.StatusOK {
+		t.Errorf("access token of another session: status %d, want 200", got)
+	}
+	if code := logout(); code != http.StatusOK {
+		t.Errorf("logging out twice: status %d, want 200", code)
+	}
+}
+
+func TestAuthRejectsRevokedSessions(t *testing.T) {
+	db, handler, user := newGuardTest(t)
+	tokens := signInTokens(t, handler)
+	if got := authenticate(t, tokens.Token); got != http.StatusOK {
+		t.Fatalf("access token: status %d, want 200", got)
+	}
+
+	if err := db.Model(&models.Session{}).Where("user_id = ?", user.ID).Update("revoked_at", time.Now()).Error; err != nil {
+		t.Fatalf("revoking session: %v", err)
+	}
+	if got := authenticate(t, tokens.Token); got != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked session: status %d, want 401", got)
+	}
+
+	// A token for a session that was never started is rejected too
+	unknown, err := utils.GenerateToken(user.ID, user.Email, 999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authenticate(t, unknown); got != http.StatusUnauthorized {
+		t.Errorf("access token of an unknown session: status %d, want 401", got)
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/oidc"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// OIDCProviderInfo is a provider offered on the sign-in page
+type OIDCProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+var errOIDCEmailUnverified = errors.New("provider has not verified the email")
+
+// oidcBrowserCookie holds a secret that ties a sign-in to the browser that started it, so a
+// code and state from someone else's sign-in cannot be used to sign a victim in as them
+const oidcBrowserCookie = "oidc_login"
+
+// GetOIDCProviders lists the identity providers users can sign in with
+func (h *AuthHandler) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]OIDCProviderInfo, 0, len(h.config.OIDCProviders))
+	for _, p := range h.config.OIDCProviders {
+		providers = append(providers, OIDCProviderInfo{Name: p.Name, DisplayName: p.DisplayName})
+	}
+
+	respondWithJSON(w, http.StatusOK, providers)
+}
+
+// StartOIDCLogin begins signing in with a provider and returns the address to send the user
+// to. The provider sends them back to the frontend, which posts the code to FinishOIDCLogin.
+func (h *AuthHandler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := h.providers[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Identity provider not found")
+		return
+	}
+
+	state, stateHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+	browser, browserHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("OIDC provider %s: %v", name, err)
+		respondWithError(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	if err := database.GetDB().Create(&models.OIDCLoginState{
+		Provider:     name,
+		StateHash:    stateHash,
+		BrowserHash:  browserHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(models.OIDCLoginStateTTL),
+	}).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+
+	h.setOIDCBrowserCookie(w, browser, models.OIDCLoginStateTTL)
+	respondWithJSON(w, http.StatusOK, map[string]string{"authorization_url": authURL})
+}
+
+// FinishOIDCLogin exchanges the code a provider returned for the user's identity and signs
+// them in. An identity seen before signs in its linked user; a new one is linked to the user
+// with the same email, or a new user is created, as long as the provider verified the email.
+func (h *AuthHandler) FinishOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := h.providers[name]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Identity provider not found")
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+		respondWithError(w, http.StatusBadRequest, "Code and state are required")
+		return
+	}
+
+	var state models.OIDCLoginState
+	if err := database.GetDB().Where("state_hash = ? AND provider = ?", utils.HashToken(req.State), name).First(&state).Error; err != nil ||
+		state.UsedAt != nil || time.Now().After(state.ExpiresAt) {
+		respondWithError(w, http.StatusBadRequest, "Sign-in has expired, please try again")
+		return
+	}
+	cookie, err := r.Cookie(oidcBrowserCookie)
+	if err != nil || state.BrowserHash == "" ||
+		subtle.ConstantTimeCompare([]byte(utils.HashToken(cookie.Value)), []byte(state.BrowserHash)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Sign-in was started in another browser, please try again")
+		return
+	}
+	h.setOIDCBrowserCookie(w, "", -1)
+
+	// A code can only be exchanged once, so claim the state before calling the provider
+	result := database.GetDB().Model(&models.OIDCLoginState{}).
+		Where("id = ? AND used_at IS NULL", state.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to finish sign-in")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondWithError(w, http.StatusBadRequest, "Sign-in has expired, please try again")
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC provider %s: %v", name, err)
+		respondWithError(w, http.StatusUnauthorized, "Sign-in with the identity provider failed")
+		return
+	}
+
+	user, err := linkOIDCIdentity(name, claims)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		respondWithError(w, http.StatusForbidden, "Your identity provider has not verified your email address")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to finish sign-in")
+		return
+	}
+
+	h.signIn(w, r, user)
+}
+
+// setOIDCBrowserCookie sets the sign-in cookie for the OIDC routes, or clears it with a
+// negative lifetime
+func (h *AuthHandler) setOIDCBrowserCookie(w http.ResponseWriter, value string, lifetime time.Duration) {
+	maxAge := int(lifetime.Seconds())
+	if lifetime < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBrowserCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.config.AppURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// linkOIDCIdentity returns the user of a provider identity, linking it to the user with the
+// same verified email or creating a user when the identity is new
+func linkOIDCIdentity(provider string, claims *oidc.Claims) (*models.User, error) {
+	var user models.User
+	now := time.Now()
+	email := normalizeEmail(claims.Email)
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Model(&identity).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only an address the provider vouches for may take over a matching account
+		if !claims.EmailVerified || validateEmail(email) != "" {
+			return errOIDCEmailUnverified
+		}
+
+		err = tx.Where("email = ?", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = models.User{Email: email, Name: oidcDisplayName(claims, email)}
+			// The account has no usable password until the user sets one with a reset link
+			password, _, genErr := utils.GenerateOpaqueToken()
+			if genErr != nil {
+				return genErr
+			}
+			if err := user.HashPassword(password); err != nil {
+				return err
+			}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if !user.IsEmailVerified() {
+			// Whoever registered the address never proved it was theirs and may not be the
+			// person the provider vouches for, so nothing they set up keeps working
+			if err := resetUnprovenAccount(tx, &user); err != nil {
+				return err
+			}
+			user.EmailVerifiedAt = &now
+			if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// resetUnprovenAccount takes every way in away from an account whose email was never verified:
+// it replaces the password, signs out every session and drops API tokens, two-factor
+// authentication and outstanding reset and verification links
+func resetUnprovenAccount(tx *gorm.DB, user *models.User) error {
+	password, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := user.HashPassword(password); err != nil {
+		return err
+	}
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":            user.Password,
+		"totp_secret":         "",
+		"totp_pending_secret": "",
+		"totp_last_step":      0,
+		"totp_enabled_at":     nil,
+	}).Error; err != nil {
+		return err
+	}
+	user.TOTPSecret, user.TOTPPendingSecret, user.TOTPLastStep, user.TOTPEnabledAt = "", "", 0, nil
+
+	if err := revokeUserSessions(tx, user.ID, 0); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, pending := range []interface{}{&models.PasswordResetToken{}, &models.EmailVerificationToken{}} {
+		if err := tx.Model(pending).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+	}
+	for _, credential := range []interface{}{&models.APIToken{}, &models.RecoveryCode{}, &models.UserIdentity{}} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(credential).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oidcDisplayName picks a name for a user created from a provider identity
+func oidcDisplayName(claims *oidc.Claims, email string) string {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = email[:strings.Index(email, "@")]
+	}
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	return name
+}
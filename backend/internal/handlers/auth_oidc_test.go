@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/config"
+	"github.com/abdelrahman/expense-manager/internal/mail"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/oidc/oidctest"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+const oidcTestClientID = "expense-manager"
+
+type oidcTest struct {
+	db       *gorm.DB
+	provider *oidctest.Provider
+	handler  *AuthHandler
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	utils.InitJWT("test-secret", 0)
+	db := testutil.OpenDB(t)
+	provider := oidctest.NewServer(t, oidcTestClientID)
+	handler := NewAuthHandler(&config.Config{
+		AppURL:          "https://app.example.com",
+		RefreshTokenTTL: time.Hour,
+		OIDCProviders: []config.OIDCProvider{{
+			Name:        "mock",
+			IssuerURL:   provider.Issuer,
+			ClientID:    oidcTestClientID,
+			RedirectURL: "https://app.example.com/auth/oidc/mock/callback",
+		}},
+	}, mail.LogSender{}, nil)
+	return &oidcTest{db: db, provider: provider, handler: handler}
+}
+
+// start begins a sign-in and returns the authorization URL and the browser's cookie
+func (o *oidcTest) start(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+	r := testutil.WithVars(testutil.Request(t, http.MethodPost, "/api/auth/oidc/mock/start", nil), map[string]string{"provider": "mock"})
+	w := testutil.Serve(o.handler.StartOIDCLogin, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("starting sign-in: status %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	testutil.DecodeJSON(t, w, &response)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcBrowserCookie {
+			if !cookie.HttpOnly || cookie.Path != "/api/auth/oidc" {
+				t.Errorf("sign-in cookie is not HttpOnly and scoped to the OIDC routes: %+v", cookie)
+			}
+			return response.AuthorizationURL, cookie
+		}
+	}
+	t.Fatal("starting sign-in set no cookie")
+	return "", nil
+}
+
+// authorize sends the browser to the provider and returns the code and state it comes back with
+func (o *oidcTest) authorize(t *testing.T, authorizationURL string) (string, string) {
+	t.Helper()
+	back, err := o.provider.Authorize(authorizationURL)
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+// callback finishes a sign-in from a browser with cookie, or none when it is nil
+func (o *oidcTest) callback(t *testing.T, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	r := testutil.WithVars(testutil.Request(t, http.MethodPost, "/api/auth/oidc/mock/callback",
+		OIDCCallbackRequest{Code: code, State: state}), map[string]string{"provider": "mock"})
+	if cookie != nil {
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return testutil.Serve(o.handler.FinishOIDCLogin, r)
+}
+
+// login runs a whole sign-in in one browser
+func (o *oidcTest) login(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	authorizationURL, cookie := o.start(t)
+	code, state := o.authorize(t, authorizationURL)
+	return o.callback(t, code, state, cookie)
+}
+
+// signedInUser checks a sign-in succeeded and returns who it signed in
+func signedInUser(t *testing.T, w *httptest.ResponseRecorder) *models.User {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("sign-in: status %d: %s", w.Code, w.Body.String())
+	}
+	var response AuthResponse
+	testutil.DecodeJSON(t, w, &response)
+	if response.Token == "" || response.RefreshToken == "" || response.User == nil {
+		t.Fatalf("sign-in response is missing tokens or the user: %s", w.Body.String())
+	}
+	return response.User
+}
+
+func TestOIDCLoginCreatesUserThenFindsItBySubject(t *testing.T) {
+	o := newOIDCTest(t)
+	o.provider.Email = "new@example.com"
+	o.provider.Name = "New User"
+
+	first := signedInUser(t, o.login(t))
+	if first.Email != "new@example.com" || first.Name != "New User" || first.EmailVerifiedAt == nil {
+		t.Errorf("created user = %+v", first)
+	}
+
+	// The provider's email changes, but the subject still finds the same user
+	o.provider.Claims = map[string]interface{}{"sub": "mock|new@example.com", "email": "renamed@example.com"}
+	second := signedInUser(t, o.login(t))
+	if second.ID != first.ID {
+		t.Errorf("second sign-in found user %d, want %d", second.ID, first.ID)
+	}
+
+	var identities []models.UserIdentity
+	o.db.Find(&identities)
+	if len(identities) != 1 || identities[0].UserID != first.ID || identities[0].Email != "renamed@example.com" {
+		t.Errorf("identities = %+v", identities)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	o := newOIDCTest(t)
+	verifiedAt := time.Now()
+	user := models.User{Email: "user@example.com", Name: "User", EmailVerifiedAt: &verifiedAt}
+	user.HashPassword("correct horse battery staple")
+	o.db.Create(&user)
+	o.provider.Email = "User@Example.com"
+
+	if got := signedInUser(t, o.login(t)); got.ID != user.ID {
+		t.Errorf("signed in user %d, want %d", got.ID, user.ID)
+	}
+
+	o.db.First(&user, user.ID)
+	if !user.CheckPassword("correct horse battery staple") {
+		t.Error("linking changed the password of a verified account")
+	}
+}
+
+func TestOIDCLoginResetsUnverifiedAccount(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// Someone registered the address first without being able to verify it
+	squatter := models.User{Email: "victim@example.com", Name: "Squatter", TOTPSecret: "SECRET"}
+	enabledAt := time.Now()
+	squatter.TOTPEnabledAt = &enabledAt
+	squatter.HashPassword("squatter password")
+	o.db.Create(&squatter)
+	session := models.Session{UserID: squatter.ID, LastSeenAt: time.Now()}
+	o.db.Create(&session)
+	o.db.Create(&models.APIToken{UserID: squatter.ID, Name: "Script", TokenHash: "hash", Scopes: models.ScopeRead})
+	o.db.Create(&models.RecoveryCode{UserID: squatter.ID, CodeHash: "code"})
+
+	o.provider.Email = "victim@example.com"
+	user := signedInUser(t, o.login(t))
+	if user.ID != squatter.ID || user.EmailVerifiedAt == nil {
+		t.Fatalf("signed in as %+v", user)
+	}
+
+	var account models.User
+	o.db.First(&account, squatter.ID)
+	if account.CheckPassword("squatter password") {
+		t.Error("the squatter's password still works")
+	}
+	if account.HasTOTP() {
+		t.Error("the squatter's authenticator is still enabled")
+	}
+	o.db.First(&session, session.ID)
+	if session.RevokedAt == nil {
+		t.Error("the squatter's session was not revoked")
+	}
+	for _, model := range []interface{}{&models.APIToken{}, &models.RecoveryCode{}} {
+		var count int64
+		o.db.Model(model).Where("user_id = ?", squatter.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("%T: %d left, want none", model, count)
+		}
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedProviderEmail(t *testing.T) {
+	o := newOIDCTest(t)
+	o.provider.EmailVerified = false
+
+	if w := o.login(t); w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+	var users int64
+	o.db.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Errorf("%d users created, want none", users)
+	}
+}
+
+func TestOIDCCallbackOnlyWorksInTheStartingBrowser(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// An attacker starts a sign-in and gets a victim's browser to post its code and state
+	authorizationURL, attackerCookie := o.start(t)
+	code, state := o.authorize(t, authorizationURL)
+	_, victimCookie := o.start(t)
+
+	if w := o.callback(t, code, state, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("without a cookie: status %d, want 400", w.Code)
+	}
+	if w := o.callback(t, code, state, victimCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("with another sign-in's cookie: status %d, want 400", w.Code)
+	}
+
+	// The rejected attempts did not use the state up
+	w := o.callback(t, code, state, attackerCookie)
+	signedInUser(t, w)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcBrowserCookie && cookie.MaxAge >= 0 {
+			t.Errorf("finishing the sign-in kept the cookie: %+v", cookie)
+		}
+	}
+
+	if w := o.callback(t, code, state, attackerCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("reusing the state: status %d, want 400", w.Code)
+	}
+}
+
+func TestOIDCCallbackChecksAuthorizedParty(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		claims map[string]interface{}
+		status int
+	}{
+		{"issued to us", map[string]interface{}{"azp": oidcTestClientID}, http.StatusOK},
+		{"issued to another client", map[string]interface{}{"azp": "other"}, http.StatusUnauthorized},
+		{"several audiences without azp", map[string]interface{}{"aud": []string{oidcTestClientID, "other"}}, http.StatusUnauthorized},
+		{"several audiences for another client", map[string]interface{}{"aud": []string{oidcTestClientID, "other"}, "azp": "other"}, http.StatusUnauthorized},
+		{"several audiences for us", map[string]interface{}{"aud": []string{oidcTestClientID, "other"}, "azp": oidcTestClientID}, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			o.provider.Claims = tc.claims
+			if w := o.login(t); w.Code != tc.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+// MFAChallengeResponse is returned by Login instead of tokens when the user has two-factor
+// authentication on; the challenge token and a code are then exchanged at /auth/login/2fa
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type TwoFactorLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // Authenticator or recovery code
+}
+
+// TwoFactorAuthRequest re-authenticates the user before two-factor settings change.
+// Code is only needed while two-factor authentication is on.
+type TwoFactorAuthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	EnrollmentPending      bool       `json:"enrollment_pending"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to show as a QR code
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginTwoFactor finishes a sign-in started by Login with an authenticator or recovery code
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	userID, err := utils.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Sign-in has expired, please sign in again")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil || !user.HasTOTP() {
+		respondWithError(w, http.StatusUnauthorized, "Sign-in has expired, please sign in again")
+		return
+	}
+
+	// Codes are throttled with the passwords of the same email, so guesses cannot start over
+	// by signing in again
+	ip := middleware.ClientIP(r)
+	wait, err := h.loginRetryAfter(user.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+	if wait > 0 {
+		recordLoginAttempt(r, user.Email, &user.ID, models.LoginThrottled)
+		respondThrottled(w, wait)
+		return
+	}
+
+	if ok, err := useSecondFactor(&user, req.Code); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check code")
+		return
+	} else if !ok {
+		recordLoginAttempt(r, user.Email, &user.ID, models.LoginInvalidMFACode)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	uncountLoginAttempt(user.Email, ip)
+	recordLoginAttempt(r, user.Email, &user.ID, models.LoginSucceeded)
+	clearLoginFailures(user.Email)
+	response, err := h.startSession(r, &user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// GetTwoFactor returns whether two-factor authentication is on and how many recovery codes are left
+func (h *AuthHandler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	status := TwoFactorStatus{
+		Enabled:           user.HasTOTP(),
+		EnabledAt:         user.TOTPEnabledAt,
+		EnrollmentPending: user.TOTPPendingSecret != "",
+	}
+	database.GetDB().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesRemaining)
+
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// SetupTwoFactor starts enrolling an authenticator and returns its secret. Nothing changes
+// until EnableTwoFactor confirms a code, so re-enrolling keeps the current authenticator
+// working until the new one is confirmed.
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate secret")
+		return
+	}
+	if err := database.GetDB().Model(user).Update("totp_pending_secret", secret).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start two-factor setup")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(h.config.MFAIssuer, user.Email, secret),
+	})
+}
+
+// EnableTwoFactor confirms the authenticator being enrolled with one of its codes, turns
+// two-factor authentication on and returns a fresh set of recovery codes, shown only once
+func (h *AuthHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		respondWithError(w, http.StatusBadRequest, "Start two-factor setup first")
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now(), 0)
+	if !valid {
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	var codes []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":         user.TOTPPendingSecret,
+			"totp_pending_secret": "",
+			"totp_last_step":      step,
+			"totp_enabled_at":     time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off and discards the recovery codes
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+	if !user.HasTOTP() {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      0,
+			"totp_enabled_at":     nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, used or not, with a new set
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+	if !user.HasTOTP() {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	var codes []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// reauthenticate loads the requesting user and checks their password, and their second factor
+// when it is on, writing the error response and returning false when either is wrong
+func (h *AuthHandler) reauthenticate(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, false
+	}
+
+	var req TwoFactorAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+
+	if !h.checkCurrentPassword(w, r, &user, req.Password, "Password is incorrect") {
+		return nil, false
+	}
+	if user.HasTOTP() {
+		if strings.TrimSpace(req.Code) == "" {
+			// Not a guess: the password was right and no code was tried
+			uncountLoginAttempt(user.Email, middleware.ClientIP(r))
+			respondWithError(w, http.StatusUnauthorized, "Authenticator or recovery code is required")
+			return nil, false
+		}
+		if ok, err := useSecondFactor(&user, req.Code); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to check code")
+			return nil, false
+		} else if !ok {
+			recordLoginAttempt(r, user.Email, &user.ID, models.LoginInvalidMFACode)
+			respondWithError(w, http.StatusUnauthorized, "Invalid code")
+			return nil, false
+		}
+	}
+	uncountLoginAttempt(user.Email, middleware.ClientIP(r))
+
+	return &user, true
+}
+
+// useSecondFactor accepts an authenticator code or an unused recovery code for a user and
+// records it as used, so neither can be presented twice
+func useSecondFactor(user *models.User, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// Conditional so two requests racing with the same code cannot both pass
+		result := database.GetDB().Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	normalized := utils.NormalizeRecoveryCode(code)
+	if normalized == "" {
+		return false, nil
+	}
+	result := database.GetDB().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores the hashes of a new set,
+// returning the codes themselves
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, models.RecoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, models.RecoveryCodeCount)
+	for len(codes) < models.RecoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code)),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
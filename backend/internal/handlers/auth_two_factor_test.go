@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	db := testutil.OpenDB(t)
+	user := models.User{Email: "user@example.com", Password: "x", Name: "User"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	var codes []string
+	if err := db.Transaction(func(tx *gorm.DB) (err error) {
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	}); err != nil {
+		t.Fatalf("replaceRecoveryCodes: %v", err)
+	}
+	if len(codes) != models.RecoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), models.RecoveryCodeCount)
+	}
+
+	use := func(code string) bool {
+		t.Helper()
+		ok, err := useSecondFactor(&user, code)
+		if err != nil {
+			t.Fatalf("useSecondFactor(%q): %v", code, err)
+		}
+		return ok
+	}
+	if !use(" " + codes[0] + " ") {
+		t.Errorf("recovery code %q was refused", codes[0])
+	}
+	if use(codes[0]) {
+		t.Errorf("recovery code %q was accepted twice", codes[0])
+	}
+	if !use(codes[1]) {
+		t.Errorf("recovery code %q was refused after another was used", codes[1])
+	}
+	if use("aaaaa-aaaaa") {
+		t.Error("an unknown recovery code was accepted")
+	}
+
+	// Regenerating retires the codes that were not used
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := replaceRecoveryCodes(tx, user.ID)
+		return err
+	}); err != nil {
+		t.Fatalf("replaceRecoveryCodes: %v", err)
+	}
+	if use(codes[2]) {
+		t.Errorf("recovery code %q was accepted after the codes were regenerated", codes[2])
+	}
+}
+
+func TestAuthenticatorCodesWorkOnce(t *testing.T) {
+	db := testutil.OpenDB(t)
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := models.User{Email: "user@example.com", Password: "x", Name: "User", TOTPSecret: secret, TOTPEnabledAt: &now}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	code, err := utils.TOTPCode(secret, now.Unix()/30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := useSecondFactor(&user, code); err != nil || !ok {
+		t.Fatalf("useSecondFactor = %v, %v, want the code accepted", ok, err)
+	}
+
+	// A stale copy of the user, as a racing request would hold, is stopped by the stored step
+	if ok, err := useSecondFactor(&user, code); err != nil || ok {
+		t.Errorf("replayed code: useSecondFactor = %v, %v, want it refused", ok, err)
+	}
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := useSecondFactor(&user, code); err != nil || ok {
+		t.Errorf("replayed code after reloading: useSecondFactor = %v, %v, want it refused", ok, err)
+	}
+}
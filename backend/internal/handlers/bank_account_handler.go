@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/abdelrahman/expense-manager/internal/database"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type BankAccountHandler struct{}
@@ -92,10 +97,26 @@ func (h *BankAccountHandler) CreateBankAccount(w http.ResponseWriter, r *http.Re
 		respondWithError(w, http.StatusBadRequest, "Account type is required")
 		return
 	}
+	accountType, err := models.NormalizeAccountType(account.AccountType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	account.AccountType = accountType
+
+	if err := validateAccountLimits(&account); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	account.UserID = userID
 
-	if err := database.GetDB().Create(&account).Error; err != nil {
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		return models.RecordBalanceSnapshot(tx, &account)
+	}); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create bank account")
 		return
 	}
@@ -103,6 +124,15 @@ func (h *BankAccountHandler) CreateBankAccount(w http.ResponseWriter, r *http.Re
 	respondWithJSON(w, http.StatusCreated, account)
 }
 
+// bankAccountUpdateRequest is an account update. Fields that are absent are kept, so the
+// balance and limits are pointers to tell a missing value from zero.
+type bankAccountUpdateRequest struct {
+	models.BankAccount
+	Balance        *float64 `json:"balance"`
+	CreditLimit    *float64 `json:"credit_limit"`
+	OverdraftLimit *float64 `json:"overdraft_limit"`
+}
+
 // UpdateBankAccount updates an existing bank account for the authenticated user
 func (h *BankAccountHandler) UpdateBankAccount(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
@@ -124,7 +154,7 @@ func (h *BankAccountHandler) UpdateBankAccount(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	var updateData models.BankAccount
+	var updateData bankAccountUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
@@ -138,7 +168,12 @@ func (h *BankAccountHandler) UpdateBankAccount(w http.ResponseWriter, r *http.Re
 		account.BankName = updateData.BankName
 	}
 	if updateData.AccountType != "" {
-		account.AccountType = updateData.AccountType
+		accountType, err := models.NormalizeAccountType(updateData.AccountType)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		account.AccountType = accountType
 	}
 	if updateData.AccountNumber != "" {
 		account.AccountNumber = updateData.AccountNumber
@@ -146,8 +181,27 @@ func (h *BankAccountHandler) UpdateBankAccount(w http.ResponseWriter, r *http.Re
 	if updateData.Currency != "" {
 		account.Currency = updateData.Currency
 	}
-	if updateData.Balance >= 0 {
-		account.Balance = updateData.Balance
+	if updateData.CreditLimit != nil {
+		account.CreditLimit = *updateData.CreditLimit
+	}
+	if updateData.OverdraftLimit != nil {
+		account.OverdraftLimit = *updateData.OverdraftLimit
+	}
+	if updateData.StatementClosingDay != 0 {
+		account.StatementClosingDay = updateData.StatementClosingDay
+	}
+	if updateData.PaymentDueDay != 0 {
+		account.PaymentDueDay = updateData.PaymentDueDay
+	}
+	if updateData.MinimumPaymentPercent > 0 {
+		account.MinimumPaymentPercent = updateData.MinimumPaymentPercent
+	}
+	if updateData.MinimumPaymentAmount > 0 {
+		account.MinimumPaymentAmount = updateData.MinimumPaymentAmount
+	}
+	if err := validateAccountLimits(&account); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	if updateData.Color != "" {
 		account.Color = updateData.Color
@@ -158,7 +212,21 @@ func (h *BankAccountHandler) UpdateBankAccount(w http.ResponseWriter, r *http.Re
 	account.IsActive = updateData.IsActive
 	account.Notes = updateData.Notes
 
-	if err := database.GetDB().Save(&account).Error; err != nil {
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// The balance read above may be stale, so it is never saved back; a new balance is
+		// posted as an adjustment instead
+		if err := tx.Omit("balance").Save(&account).Error; err != nil {
+			return err
+		}
+		if updateData.Balance != nil {
+			if err := setBankAccountBalance(tx, &account, *updateData.Balance); err != nil {
+				return err
+			}
+		} else if err := tx.Select("balance").First(&account, account.ID).Error; err != nil {
+			return err
+		}
+		return models.RecordBalanceSnapshot(tx, &account)
+	}); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update bank account")
 		return
 	}
@@ -187,6 +255,7 @@ func (h *BankAccountHandler) DeleteBankAccount(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// The account is soft deleted, so its balance snapshots stay in the net worth history
 	if err := database.GetDB().Delete(&account).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete bank account")
 		return
@@ -216,14 +285,38 @@ func (h *BankAccountHandler) GetBankAccountBalance(w http.ResponseWriter, r *htt
 		return
 	}
 
+	atParam := r.URL.Query().Get("at")
+	if atParam == "" {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"id":       account.ID,
+			"balance":  account.Balance,
+			"currency": account.Currency,
+		})
+		return
+	}
+
+	at, err := time.ParseInLocation("2006-01-02", atParam, time.Local)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+		return
+	}
+
+	balance, err := bankAccountBalanceAt(database.GetDB(), &account, at)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to calculate balance")
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"id":       account.ID,
-		"balance":  account.Balance,
+		"balance":  balance,
 		"currency": account.Currency,
+		"at":       atParam,
 	})
 }
 
-// UpdateBankAccountBalance updates the balance of a bank account
+// UpdateBankAccountBalance sets the balance of a bank account, recording the difference as an
+// adjustment transaction
 func (h *BankAccountHandler) UpdateBankAccountBalance(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -251,8 +344,9 @@ func (h *BankAccountHandler) UpdateBankAccountBalance(w http.ResponseWriter, r *
 	}
 
 	if balance, ok := balanceData["balance"]; ok {
-		account.Balance = balance
-		if err := database.GetDB().Save(&account).Error; err != nil {
+		if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+			return setBankAccountBalance(tx, &account, balance)
+		}); err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Failed to update balance")
 			return
 		}
@@ -261,7 +355,15 @@ func (h *BankAccountHandler) UpdateBankAccountBalance(w http.ResponseWriter, r *
 	respondWithJSON(w, http.StatusOK, account)
 }
 
-// GetBankAccountTransactions returns recent transactions for a bank account
+// BankAccountTransactionEntry is a transaction with the account balance right after it
+type BankAccountTransactionEntry struct {
+	models.BankAccountTransaction
+	RunningBalance float64 `json:"running_balance"`
+}
+
+// GetBankAccountTransactions returns transactions for a bank account, newest value date first,
+// with a running balance per row. Supports from, to, type, limit and cursor query parameters;
+// the cursor for the next page is returned in the X-Next-Cursor header.
 func (h *BankAccountHandler) GetBankAccountTransactions(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -292,18 +394,74 @@ func (h *BankAccountHandler) GetBankAccountTransactions(w http.ResponseWriter, r
 		return
 	}
 
-	var transactions []models.BankAccountTransaction
-	if err := database.GetDB().
-		Where("bank_account_id = ? AND user_id = ?", account.ID, userID).
-		Order("created_at DESC").
-		Limit(limit).
-		Find(&transactions).Error; err != nil {
+	// The running balance is derived backwards from the current balance: the balance after a
+	// row equals the current balance minus everything booked after it in value date order
+	ledger := database.GetDB().Model(&models.BankAccountTransaction{}).
+		Select("bank_account_transactions.*, "+
+			"SUM("+models.SignedAmountSQL+") OVER (ORDER BY value_date, id) AS cumulative, "+
+			"SUM("+models.SignedAmountSQL+") OVER () AS total").
+		Where("bank_account_id = ? AND user_id = ?", account.ID, userID)
+
+	query := database.GetDB().Table("(?) AS ledger", ledger)
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		fromDate, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid from date. Use YYYY-MM-DD")
+			return
+		}
+		query = query.Where("value_date >= ?", fromDate)
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		toDate, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to date. Use YYYY-MM-DD")
+			return
+		}
+		query = query.Where("value_date <= ?", toDate)
+	}
+	if typeParam := r.URL.Query().Get("type"); typeParam != "" {
+		transactionType, err := normalizeTransactionType(typeParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query = query.Where("type = ?", transactionType)
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		cursorDate, cursorID, err := decodeTransactionCursor(cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		query = query.Where("(value_date < ? OR (value_date = ? AND id < ?))", cursorDate, cursorDate, cursorID)
+	}
+
+	var rows []struct {
+		models.BankAccountTransaction
+		Cumulative float64
+		Total      float64
+	}
+	if err := query.
+		Order("value_date DESC, id DESC").
+		Limit(limit + 1).
+		Scan(&rows).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch transactions")
 		return
 	}
 
-	if transactions == nil {
-		transactions = []models.BankAccountTransaction{}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1].BankAccountTransaction
+		w.Header().Set("X-Next-Cursor", encodeTransactionCursor(last.ValueDate, last.ID))
+	}
+
+	transactions := make([]BankAccountTransactionEntry, 0, len(rows))
+	for _, row := range rows {
+		transactions = append(transactions, BankAccountTransactionEntry{
+			BankAccountTransaction: row.BankAccountTransaction,
+			RunningBalance:         math.Round((account.Balance-row.Total+row.Cumulative)*100) / 100,
+		})
 	}
 
 	respondWithJSON(w, http.StatusOK, transactions)
@@ -313,6 +471,7 @@ type bankAccountTransactionRequest struct {
 	Amount      float64 `json:"amount"`
 	Type        string  `json:"type"`
 	Description string  `json:"description"`
+	ValueDate   string  `json:"value_date"` // YYYY-MM-DD, defaults to today
 }
 
 // CreateBankAccountTransaction adds or subtracts money from a bank account
@@ -347,29 +506,38 @@ func (h *BankAccountHandler) CreateBankAccountTransaction(w http.ResponseWriter,
 		return
 	}
 
+	now := time.Now()
+	valueDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if req.ValueDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.ValueDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid value date format. Use YYYY-MM-DD")
+			return
+		}
+		if parsed.After(valueDate) {
+			respondWithError(w, http.StatusBadRequest, "Value date cannot be in the future")
+			return
+		}
+		valueDate = parsed
+	}
+
 	var updatedAccount models.BankAccount
 	var createdTransaction models.BankAccountTransaction
 
 	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Lock the account so the funds check and the posting see the same balance
 		var account models.BankAccount
-		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", id, userID).
+			First(&account).Error; err != nil {
 			return err
 		}
 
-		newBalance := account.Balance
-		switch transactionType {
-		case "credit":
-			newBalance += req.Amount
-		case "debit":
-			if account.Balance-req.Amount < 0 {
-				return errors.New("Insufficient funds")
+		if transactionType == "debit" && account.Balance-req.Amount < account.MinimumAllowedBalance() {
+			if account.IsCreditCard() {
+				return errCreditLimitExceeded
 			}
-			newBalance -= req.Amount
-		}
-
-		account.Balance = newBalance
-		if err := tx.Save(&account).Error; err != nil {
-			return err
+			return errInsufficientFunds
 		}
 
 		transaction := models.BankAccountTransaction{
@@ -378,8 +546,9 @@ func (h *BankAccountHandler) CreateBankAccountTransaction(w http.ResponseWriter,
 			Type:          transactionType,
 			Amount:        req.Amount,
 			Description:   req.Description,
+			ValueDate:     valueDate,
 		}
-		if err := tx.Create(&transaction).Error; err != nil {
+		if err := postBankAccountTransaction(tx, &account, &transaction); err != nil {
 			return err
 		}
 
@@ -387,8 +556,8 @@ func (h *BankAccountHandler) CreateBankAccountTransaction(w http.ResponseWriter,
 		createdTransaction = transaction
 		return nil
 	}); err != nil {
-		if err.Error() == "Insufficient funds" {
-			respondWithError(w, http.StatusBadRequest, "Insufficient funds")
+		if errors.Is(err, errInsufficientFunds) || errors.Is(err, errCreditLimitExceeded) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to create transaction")
@@ -401,6 +570,91 @@ func (h *BankAccountHandler) CreateBankAccountTransaction(w http.ResponseWriter,
 	})
 }
 
+var (
+	errInsufficientFunds   = errors.New("Insufficient funds")
+	errCreditLimitExceeded = errors.New("Credit limit exceeded")
+)
+
+// validateAccountLimits checks the credit, overdraft and statement settings of an account
+func validateAccountLimits(account *models.BankAccount) error {
+	if account.CreditLimit < 0 || account.OverdraftLimit < 0 {
+		return errors.New("Credit limit and overdraft limit cannot be negative")
+	}
+	if account.StatementClosingDay < 0 || account.StatementClosingDay > 31 {
+		return errors.New("Statement closing day must be between 1 and 31")
+	}
+	if account.PaymentDueDay < 0 || account.PaymentDueDay > 31 {
+		return errors.New("Payment due day must be between 1 and 31")
+	}
+	if account.MinimumPaymentPercent < 0 || account.MinimumPaymentPercent > 100 {
+		return errors.New("Minimum payment percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// bankAccountBalanceAt returns the balance at the end of a day by undoing every
+// transaction whose value date falls after it
+func bankAccountBalanceAt(db *gorm.DB, account *models.BankAccount, at time.Time) (float64, error) {
+	var laterTotal float64
+	if err := db.Model(&models.BankAccountTransaction{}).
+		Where("bank_account_id = ? AND value_date > ?", account.ID, at).
+		Select("COALESCE(SUM(" + models.SignedAmountSQL + "), 0)").
+		Scan(&laterTotal).Error; err != nil {
+		return 0, err
+	}
+
+	return math.Round((account.Balance-laterTotal)*100) / 100, nil
+}
+
+// setBankAccountBalance brings an account to a stated balance by posting the difference as
+// an adjustment, so the transactions, snapshots and reconciliations still add up
+func setBankAccountBalance(tx *gorm.DB, account *models.BankAccount, balance float64) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(account, account.ID).Error; err != nil {
+		return err
+	}
+
+	difference := math.Round((balance-account.Balance)*100) / 100
+	if difference == 0 {
+		return nil
+	}
+	adjustment := models.BankAccountTransaction{
+		UserID:        account.UserID,
+		BankAccountID: account.ID,
+		Type:          "credit",
+		Amount:        difference,
+		Description:   "Balance adjustment",
+		ValueDate:     today(),
+	}
+	if difference < 0 {
+		adjustment.Type = "debit"
+		adjustment.Amount = -difference
+	}
+	return postBankAccountTransaction(tx, account, &adjustment)
+}
+
+// postBankAccountTransaction records a transaction and applies it to the account balance
+// and to any balance snapshots taken since its value date
+func postBankAccountTransaction(tx *gorm.DB, account *models.BankAccount, transaction *models.BankAccountTransaction) error {
+	// Move the stored balance instead of saving the one read earlier, so concurrent postings
+	// cannot overwrite each other
+	if err := tx.Model(account).Update("balance", gorm.Expr("balance + ?", transaction.SignedAmount())).Error; err != nil {
+		return err
+	}
+	if err := tx.Select("balance").First(account, account.ID).Error; err != nil {
+		return err
+	}
+	account.Balance = math.Round(account.Balance*100) / 100
+
+	if err := tx.Create(transaction).Error; err != nil {
+		return err
+	}
+	// Back-dated entries also change the balances already snapshotted since then
+	if err := models.AdjustSnapshotsSince(tx, account.ID, transaction.ValueDate, transaction.SignedAmount()); err != nil {
+		return err
+	}
+	return models.RecordBalanceSnapshot(tx, account)
+}
+
 func normalizeTransactionType(input string) (string, error) {
 	value := strings.ToLower(strings.TrimSpace(input))
 	switch value {
@@ -412,3 +666,33 @@ func normalizeTransactionType(input string) (string, error) {
 		return "", errors.New("Transaction type must be add/credit or sub/debit")
 	}
 }
+
+// encodeTransactionCursor builds an opaque pagination cursor from a row's sort key
+func encodeTransactionCursor(valueDate time.Time, id uint) string {
+	raw := fmt.Sprintf("%s|%d", valueDate.Format("2006-01-02"), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeTransactionCursor parses a cursor produced by encodeTransactionCursor
+func decodeTransactionCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, errors.New("malformed cursor")
+	}
+
+	valueDate, err := time.ParseInLocation("2006-01-02", parts[0], time.Local)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return valueDate, uint(id), nil
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"gorm.io/gorm"
+)
+
+// seedAccount creates a bank account for user 1, filling in the required fields
+func seedAccount(t *testing.T, db *gorm.DB, account models.BankAccount) models.BankAccount {
+	t.Helper()
+	account.UserID = 1
+	if account.AccountName == "" {
+		account.AccountName = "Current"
+	}
+	account.BankName = "Bank"
+	account.AccountNumber = "1234"
+	if account.AccountType == "" {
+		account.AccountType = models.AccountTypeChecking
+	}
+	if account.Currency == "" {
+		account.Currency = "SAR"
+	}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("creating account: %v", err)
+	}
+	return account
+}
+
+func postTransaction(t *testing.T, account models.BankAccount, req bankAccountTransactionRequest) int {
+	t.Helper()
+	r := testutil.WithVars(testutil.Request(t, http.MethodPost, "/api/bank-accounts/1/transactions", req),
+		map[string]string{"id": fmt.Sprint(account.ID)})
+	return testutil.Serve(NewBankAccountHandler().CreateBankAccountTransaction, testutil.AsUser(r, 1)).Code
+}
+
+func TestParallelDebitsKeepTheBalanceAndLedgerInStep(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{Balance: 100})
+
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := postTransaction(t, account, bankAccountTransactionRequest{Amount: 30, Type: "debit"})
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusCreated] != 3 || codes[http.StatusBadRequest] != 7 {
+		t.Errorf("responses = %v, want 3 debits and 7 refused for insufficient funds", codes)
+	}
+	var stored models.BankAccount
+	db.First(&stored, account.ID)
+	var posted float64
+	db.Model(&models.BankAccountTransaction{}).Where("bank_account_id = ?", account.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&posted)
+	if stored.Balance != 10 || posted != 90 {
+		t.Errorf("balance %v with %v debited, want 10 with 90 debited", stored.Balance, posted)
+	}
+}
+
+func TestRunningBalanceAndBalanceAtDate(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{Balance: 100})
+	handler := NewBankAccountHandler()
+
+	for _, req := range []bankAccountTransactionRequest{
+		{Amount: 40, Type: "debit", ValueDate: "2026-03-10"},
+		{Amount: 25, Type: "credit", ValueDate: "2026-01-05"}, // Back-dated after the debit
+		{Amount: 10, Type: "debit", ValueDate: "2026-02-01"},
+	} {
+		if code := postTransaction(t, account, req); code != http.StatusCreated {
+			t.Fatalf("posting %+v: status %d", req, code)
+		}
+	}
+
+	r := testutil.WithVars(testutil.Request(t, http.MethodGet, "/api/bank-accounts/1/transactions", nil),
+		map[string]string{"id": fmt.Sprint(account.ID)})
+	w := testutil.Serve(handler.GetBankAccountTransactions, testutil.AsUser(r, 1))
+	var entries []BankAccountTransactionEntry
+	testutil.DecodeJSON(t, w, &entries)
+	want := []float64{75, 115, 125} // Newest value date first
+	if len(entries) != len(want) {
+		t.Fatalf("got %d transactions, want %d: %s", len(entries), len(want), w.Body.String())
+	}
+	for i, entry := range entries {
+		if entry.RunningBalance != want[i] {
+			t.Errorf("running balance after %s = %v, want %v", entry.ValueDate.Format("2006-01-02"), entry.RunningBalance, want[i])
+		}
+	}
+
+	for at, want := range map[string]float64{"2025-12-31": 100, "2026-01-31": 125, "2026-02-15": 115, "2026-06-01": 75} {
+		r := testutil.WithVars(testutil.Request(t, http.MethodGet, "/api/bank-accounts/1/balance?at="+at, nil),
+			map[string]string{"id": fmt.Sprint(account.ID)})
+		var body struct {
+			Balance float64 `json:"balance"`
+		}
+		testutil.DecodeJSON(t, testutil.Serve(handler.GetBankAccountBalance, testutil.AsUser(r, 1)), &body)
+		if body.Balance != want {
+			t.Errorf("balance at %s = %v, want %v", at, body.Balance, want)
+		}
+	}
+}
+
+func TestUpdateBankAccountKeepsOrAdjustsTheBalance(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{
+		AccountType: models.AccountTypeCreditCard,
+		Balance:     -300,
+		CreditLimit: 1000,
+	})
+	update := func(body map[string]interface{}) models.BankAccount {
+		t.Helper()
+		r := testutil.WithVars(testutil.Request(t, http.MethodPut, "/", body), map[string]string{"id": fmt.Sprint(account.ID)})
+		w := testutil.Serve(NewBankAccountHandler().UpdateBankAccount, testutil.AsUser(r, 1))
+		if w.Code != http.StatusOK {
+			t.Fatalf("updating with %v: status %d: %s", body, w.Code, w.Body.String())
+		}
+		var updated models.BankAccount
+		testutil.DecodeJSON(t, w, &updated)
+		return updated
+	}
+
+	if updated := update(map[string]interface{}{"account_name": "Card", "is_active": true}); updated.Balance != -300 || updated.CreditLimit != 1000 {
+		t.Errorf("renaming left balance %v and limit %v, want -300 and 1000", updated.Balance, updated.CreditLimit)
+	}
+
+	if updated := update(map[string]interface{}{"balance": -250, "is_active": true}); updated.Balance != -250 {
+		t.Errorf("balance = %v, want -250", updated.Balance)
+	}
+	var adjustment models.BankAccountTransaction
+	if err := db.Where("bank_account_id = ?", account.ID).First(&adjustment).Error; err != nil ||
+		adjustment.Type != "credit" || adjustment.Amount != 50 {
+		t.Errorf("adjustment = %s %v (%v), want a credit of 50", adjustment.Type, adjustment.Amount, err)
+	}
+
+	if updated := update(map[string]interface{}{"credit_limit": 0, "is_active": true}); updated.CreditLimit != 0 || updated.Balance != -250 {
+		t.Errorf("clearing the limit left limit %v and balance %v, want 0 and -250", updated.CreditLimit, updated.Balance)
+	}
+}
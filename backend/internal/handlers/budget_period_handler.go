@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+// periodCalendar marks reports over plain calendar months
+const periodCalendar = "calendar"
+
+type BudgetPeriodHandler struct{}
+
+func NewBudgetPeriodHandler() *BudgetPeriodHandler {
+	return &BudgetPeriodHandler{}
+}
+
+type budgetPeriodRequest struct {
+	Type        string   `json:"type"`
+	StartDay    int      `json:"start_day"`
+	Adjustment  string   `json:"adjustment"`
+	WeekendDays []int    `json:"weekend_days"`
+	Holidays    []string `json:"holidays"`
+	AnchorDate  string   `json:"anchor_date"` // YYYY-MM-DD
+}
+
+// BudgetPeriodSummary is one budget period with its spending against plan
+type BudgetPeriodSummary struct {
+	StartDate     string  `json:"start_date"`
+	EndDate       string  `json:"end_date"`
+	Year          int     `json:"year,omitempty"`
+	Month         int     `json:"month,omitempty"`
+	TotalExpenses float64 `json:"total_expenses"`
+	TotalPlanned  float64 `json:"total_planned"`
+	ExpenseCount  int64   `json:"expense_count"`
+	IsCurrent     bool    `json:"is_current"`
+}
+
+// GetBudgetPeriod returns the budget period definition of the authenticated user,
+// calendar months when none has been saved
+func (h *BudgetPeriodHandler) GetBudgetPeriod(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loadBudgetPeriod(userID))
+}
+
+// UpdateBudgetPeriod creates or replaces the budget period definition of the authenticated user
+func (h *BudgetPeriodHandler) UpdateBudgetPeriod(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req budgetPeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	settings := loadBudgetPeriod(userID)
+
+	settings.Type = strings.ToLower(req.Type)
+	if settings.Type == "" {
+		settings.Type = models.BudgetPeriodMonthly
+	}
+	switch settings.Type {
+	case models.BudgetPeriodMonthly:
+		if req.StartDay == 0 {
+			req.StartDay = 1
+		}
+		if req.StartDay < 1 || req.StartDay > 31 {
+			respondWithError(w, http.StatusBadRequest, "Start day must be between 1 and 31")
+			return
+		}
+		settings.StartDay = req.StartDay
+		settings.AnchorDate = nil
+	case models.BudgetPeriodWeekly, models.BudgetPeriodBiweekly:
+		if req.AnchorDate == "" {
+			respondWithError(w, http.StatusBadRequest, "Anchor date is required for weekly and bi-weekly periods")
+			return
+		}
+		anchor, err := time.ParseInLocation("2006-01-02", req.AnchorDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid anchor date format. Use YYYY-MM-DD")
+			return
+		}
+		settings.StartDay = 1
+		settings.AnchorDate = &anchor
+	default:
+		respondWithError(w, http.StatusBadRequest, "Type must be monthly, weekly or biweekly")
+		return
+	}
+
+	settings.Adjustment = strings.ToLower(req.Adjustment)
+	switch settings.Adjustment {
+	case "":
+		settings.Adjustment = models.PeriodAdjustNone
+	case models.PeriodAdjustNone, models.PeriodAdjustPrevious, models.PeriodAdjustNext:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Adjustment must be none, previous or next")
+		return
+	}
+
+	for _, weekday := range req.WeekendDays {
+		if weekday < 0 || weekday > 6 {
+			respondWithError(w, http.StatusBadRequest, "Weekend days must be between 0 (Sunday) and 6 (Saturday)")
+			return
+		}
+	}
+	if len(req.WeekendDays) >= 7 {
+		respondWithError(w, http.StatusBadRequest, "At least one business day is required")
+		return
+	}
+	settings.WeekendDays = req.WeekendDays
+
+	for _, holiday := range req.Holidays {
+		if _, err := time.ParseInLocation("2006-01-02", holiday, time.Local); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid holiday date format. Use YYYY-MM-DD")
+			return
+		}
+	}
+	settings.Holidays = req.Holidays
+
+	if err := database.GetDB().Save(settings).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save budget period")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// GetPeriods returns the latest budget periods (default 6, at most 24) up to the one
+// containing ?date (default today), newest first, with spending against plan
+func (h *BudgetPeriodHandler) GetPeriods(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	count := 6
+	if countParam := r.URL.Query().Get("count"); countParam != "" {
+		if parsed, err := strconv.Atoi(countParam); err == nil && parsed > 0 {
+			if parsed > 24 {
+				parsed = 24
+			}
+			count = parsed
+		}
+	}
+
+	day := today()
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	settings := loadBudgetPeriod(userID)
+	current := settings.Containing(today())
+
+	periods := make([]models.Period, 0, count)
+	for period := settings.Containing(day); len(periods) < count; period = settings.Containing(period.Start.AddDate(0, 0, -1)) {
+		periods = append(periods, period)
+	}
+
+	totals, err := monthComparisons(userID, periods)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch budget periods")
+		return
+	}
+
+	// Monthly periods are budgeted against their month's plans, others prorated over the months they overlap
+	var months []planMonth
+	if settings.IsMonthly() {
+		for _, period := range periods {
+			months = append(months, planMonth{year: period.Year, month: period.Month})
+		}
+	} else {
+		months = overlappingMonths(periods...)
+	}
+	monthlyPlans, err := loadPlansByMonth(userID, models.CalendarGregorian, months)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch budget periods")
+		return
+	}
+
+	summaries := make([]BudgetPeriodSummary, 0, count)
+	for i, period := range periods {
+		plans := monthlyPlans[planMonth{year: period.Year, month: period.Month}]
+		if !settings.IsMonthly() {
+			plans = proratePlans(period, monthlyPlans)
+		}
+
+		summaries = append(summaries, BudgetPeriodSummary{
+			StartDate:     totals[i].StartDate,
+			EndDate:       totals[i].EndDate,
+			Year:          period.Year,
+			Month:         period.Month,
+			TotalExpenses: totals[i].TotalExpenses,
+			TotalPlanned:  plans.total,
+			ExpenseCount:  totals[i].ExpenseCount,
+			IsCurrent:     period.Start.Equal(current.Start),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, summaries)
+}
+
+// loadBudgetPeriod returns the user's budget period definition, or calendar months when none is saved
+func loadBudgetPeriod(userID uint) *models.BudgetPeriod {
+	settings := models.BudgetPeriod{
+		UserID:     userID,
+		Type:       models.BudgetPeriodMonthly,
+		StartDay:   1,
+		Adjustment: models.PeriodAdjustNone,
+	}
+	database.GetDB().Where("user_id = ?", userID).First(&settings)
+	return &settings
+}
+
+// reportMonth returns the period a monthly report covers: the user's monthly budget period
+// for the month, or the calendar month when ?period=calendar is given or periods are weekly
+func reportMonth(r *http.Request, userID uint, year, month int) (models.Period, string) {
+	return reportMonths(r, userID)(year, month)
+}
+
+// reportMonths is reportMonth for reports over many months, loading the budget period once
+func reportMonths(r *http.Request, userID uint) func(year, month int) (models.Period, string) {
+	calendar := func(year, month int) (models.Period, string) {
+		return models.CalendarMonth(year, month), periodCalendar
+	}
+	if r.URL.Query().Get("period") == periodCalendar {
+		return calendar
+	}
+
+	settings := loadBudgetPeriod(userID)
+	if !settings.IsMonthly() || settings.IsCalendarMonth() {
+		return calendar
+	}
+	return func(year, month int) (models.Period, string) {
+		return settings.MonthPeriod(year, month), models.BudgetPeriodMonthly
+	}
+}
+
+// periodKind names the kind of period a budget period definition produces
+func periodKind(settings *models.BudgetPeriod) string {
+	if settings.IsCalendarMonth() {
+		return periodCalendar
+	}
+	return settings.Type
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/hijri"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+// displayCalendar returns the calendar dates should be shown in: the calendar query
+// parameter when given, otherwise the user's saved preference
+func displayCalendar(r *http.Request, userID uint) string {
+	if calendar := strings.ToLower(r.URL.Query().Get("calendar")); calendar == models.CalendarHijri || calendar == models.CalendarGregorian {
+		return calendar
+	}
+
+	var user models.User
+	if err := database.GetDB().Select("calendar").First(&user, userID).Error; err == nil && user.Calendar == models.CalendarHijri {
+		return models.CalendarHijri
+	}
+	return models.CalendarGregorian
+}
+
+// setHijriDates fills in the Hijri expense dates when the user displays the Hijri calendar
+func setHijriDates(calendar string, expenses ...*models.DailyExpense) {
+	if calendar != models.CalendarHijri {
+		return
+	}
+	for _, expense := range expenses {
+		expense.HijriDate = hijriDateString(expense.ExpenseDate)
+	}
+}
+
+// hijriDateString formats a day as a Hijri date, or an empty string outside the supported range
+func hijriDateString(day time.Time) string {
+	date, err := hijri.FromGregorian(day)
+	if err != nil {
+		return ""
+	}
+	return date.String()
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 type CategoryHandler struct{}
@@ -77,6 +78,16 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if category.TaxRate != nil {
+		if *category.TaxRate < 0 || *category.TaxRate > 100 {
+			respondWithError(w, http.StatusBadRequest, "Tax rate must be between 0 and 100")
+			return
+		}
+		if *category.TaxRate == 0 {
+			category.TaxRate = nil
+		}
+	}
+
 	// Set the user ID
 	category.UserID = userID
 
@@ -109,7 +120,10 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var updateData models.Category
+	var updateData struct {
+		models.Category
+		TaxReclaimable *bool `json:"tax_reclaimable"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
@@ -128,6 +142,20 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 	if updateData.Icon != "" {
 		category.Icon = updateData.Icon
 	}
+	if updateData.TaxRate != nil {
+		// A rate of 0 removes the category's default VAT
+		if *updateData.TaxRate < 0 || *updateData.TaxRate > 100 {
+			respondWithError(w, http.StatusBadRequest, "Tax rate must be between 0 and 100")
+			return
+		}
+		category.TaxRate = updateData.TaxRate
+		if *category.TaxRate == 0 {
+			category.TaxRate = nil
+		}
+	}
+	if updateData.TaxReclaimable != nil {
+		category.TaxReclaimable = *updateData.TaxReclaimable
+	}
 
 	if err := database.GetDB().Save(&category).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update category")
@@ -152,7 +180,14 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.Category{}).Error; err != nil {
+	// Expenses of the category become uncategorized, so their rollups move with them
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Category{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return models.UncategorizeTotals(tx, userID, uint(id))
+	}); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete category")
 		return
 	}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type CreditCardHandler struct{}
+
+func NewCreditCardHandler() *CreditCardHandler {
+	return &CreditCardHandler{}
+}
+
+// CreditCardCycle summarizes the activity of one statement cycle
+type CreditCardCycle struct {
+	PeriodStart    string  `json:"period_start"`
+	PeriodEnd      string  `json:"period_end"`
+	OpeningBalance float64 `json:"opening_balance"`
+	ClosingBalance float64 `json:"closing_balance"`
+	Purchases      float64 `json:"purchases"`
+	Payments       float64 `json:"payments"`
+}
+
+// CreditCardStatement is a closed statement cycle with its payment obligation
+type CreditCardStatement struct {
+	CreditCardCycle
+	DueDate          string  `json:"due_date"`
+	StatementBalance float64 `json:"statement_balance"`
+	MinimumPayment   float64 `json:"minimum_payment"`
+	PaidSinceClosing float64 `json:"paid_since_closing"`
+	RemainingBalance float64 `json:"remaining_balance"`
+	RemainingMinimum float64 `json:"remaining_minimum"`
+	Status           string  `json:"status"` // paid, minimum_paid, due or overdue
+}
+
+type CreditCardStatementsResponse struct {
+	AccountID       uint                  `json:"account_id"`
+	AccountName     string                `json:"account_name"`
+	Currency        string                `json:"currency"`
+	Balance         float64               `json:"balance"`
+	CreditLimit     float64               `json:"credit_limit"`
+	AvailableCredit float64               `json:"available_credit"`
+	CurrentCycle    CreditCardCycle       `json:"current_cycle"`
+	Statements      []CreditCardStatement `json:"statements"`
+}
+
+type UpcomingPayment struct {
+	AccountID        uint    `json:"account_id"`
+	AccountName      string  `json:"account_name"`
+	Currency         string  `json:"currency"`
+	DueDate          string  `json:"due_date"`
+	DaysUntilDue     int     `json:"days_until_due"`
+	StatementBalance float64 `json:"statement_balance"`
+	MinimumPayment   float64 `json:"minimum_payment"`
+	RemainingBalance float64 `json:"remaining_balance"`
+	RemainingMinimum float64 `json:"remaining_minimum"`
+	Status           string  `json:"status"`
+}
+
+// GetStatements returns the current cycle and the most recent closed statements of a credit card
+func (h *CreditCardHandler) GetStatements(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid bank account ID")
+		return
+	}
+
+	count := 6
+	if countParam := r.URL.Query().Get("count"); countParam != "" {
+		if parsed, err := strconv.Atoi(countParam); err == nil && parsed > 0 {
+			if parsed > 24 {
+				parsed = 24
+			}
+			count = parsed
+		}
+	}
+
+	var account models.BankAccount
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Bank account not found")
+		return
+	}
+
+	if !account.IsCreditCard() {
+		respondWithError(w, http.StatusBadRequest, "Statements are only available for credit card accounts")
+		return
+	}
+	if !account.HasStatementCycle() {
+		respondWithError(w, http.StatusBadRequest, "Statement closing day and payment due day are not configured")
+		return
+	}
+
+	current, statements, err := buildCreditCardStatements(database.GetDB(), &account, today(), count)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to calculate statements")
+		return
+	}
+
+	availableCredit := 0.0
+	if account.CreditLimit > 0 {
+		availableCredit = roundAmount(account.CreditLimit + account.Balance)
+	}
+
+	respondWithJSON(w, http.StatusOK, CreditCardStatementsResponse{
+		AccountID:       account.ID,
+		AccountName:     account.AccountName,
+		Currency:        account.Currency,
+		Balance:         account.Balance,
+		CreditLimit:     account.CreditLimit,
+		AvailableCredit: availableCredit,
+		CurrentCycle:    current,
+		Statements:      statements,
+	})
+}
+
+// GetUpcomingPayments returns unpaid credit card statements due within the next days (default 30), including overdue ones
+func (h *CreditCardHandler) GetUpcomingPayments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	days := 30
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		if parsed, err := strconv.Atoi(daysParam); err == nil && parsed >= 0 {
+			if parsed > 365 {
+				parsed = 365
+			}
+			days = parsed
+		}
+	}
+
+	var accounts []models.BankAccount
+	if err := database.GetDB().Where("user_id = ? AND is_active = ?", userID, true).Find(&accounts).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch bank accounts")
+		return
+	}
+
+	now := today()
+	horizon := now.AddDate(0, 0, days)
+	payments := []UpcomingPayment{}
+	for i := range accounts {
+		account := &accounts[i]
+		if !account.IsCreditCard() || !account.HasStatementCycle() {
+			continue
+		}
+
+		_, statements, err := buildCreditCardStatements(database.GetDB(), account, now, upcomingStatementCount)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to calculate statements")
+			return
+		}
+
+		for _, statement := range statementsToPay(statements) {
+			dueDate, _ := time.ParseInLocation("2006-01-02", statement.DueDate, time.Local)
+			if dueDate.After(horizon) {
+				continue
+			}
+
+			payments = append(payments, UpcomingPayment{
+				AccountID:        account.ID,
+				AccountName:      account.AccountName,
+				Currency:         account.Currency,
+				DueDate:          statement.DueDate,
+				DaysUntilDue:     int(math.Round(dueDate.Sub(now).Hours() / 24)),
+				StatementBalance: statement.StatementBalance,
+				MinimumPayment:   statement.MinimumPayment,
+				RemainingBalance: statement.RemainingBalance,
+				RemainingMinimum: statement.RemainingMinimum,
+				Status:           statement.Status,
+			})
+		}
+	}
+
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].DueDate < payments[j].DueDate
+	})
+
+	respondWithJSON(w, http.StatusOK, payments)
+}
+
+// upcomingStatementCount is how many closed statements are checked for missed payments
+const upcomingStatementCount = 6
+
+// statementsToPay picks the statements, newest first, that still need a payment: the latest
+// one until it is paid in full, and older ones whose minimum payment was missed
+func statementsToPay(statements []CreditCardStatement) []CreditCardStatement {
+	var unpaid []CreditCardStatement
+	for i, statement := range statements {
+		if (i == 0 && statement.RemainingBalance > 0) || statement.Status == "overdue" {
+			unpaid = append(unpaid, statement)
+		}
+	}
+	return unpaid
+}
+
+// buildCreditCardStatements computes the open cycle and the last count closed statements
+// of a card, newest first, from its current balance and transaction history
+func buildCreditCardStatements(db *gorm.DB, account *models.BankAccount, now time.Time, count int) (CreditCardCycle, []CreditCardStatement, error) {
+	// closings[0] is the latest closing on or before today; one extra closing bounds the oldest cycle
+	closings := []time.Time{statementClosingOnOrBefore(account.StatementClosingDay, now)}
+	for len(closings) <= count {
+		previous := closings[len(closings)-1].AddDate(0, 0, -1)
+		closings = append(closings, statementClosingOnOrBefore(account.StatementClosingDay, previous))
+	}
+
+	var transactions []models.BankAccountTransaction
+	if err := db.Where("bank_account_id = ? AND value_date > ?", account.ID, closings[len(closings)-1]).
+		Find(&transactions).Error; err != nil {
+		return CreditCardCycle{}, nil, err
+	}
+
+	// balanceAt undoes every transaction after the given day
+	balanceAt := func(day time.Time) float64 {
+		key := day.Format("2006-01-02")
+		balance := account.Balance
+		for i := range transactions {
+			if transactions[i].ValueDate.Format("2006-01-02") > key {
+				balance -= transactions[i].SignedAmount()
+			}
+		}
+		return roundAmount(balance)
+	}
+
+	// activity sums debits and credits with a value date in (after, through]
+	activity := func(after, through time.Time) (debits, credits float64) {
+		from, to := after.Format("2006-01-02"), through.Format("2006-01-02")
+		for i := range transactions {
+			day := transactions[i].ValueDate.Format("2006-01-02")
+			if day <= from || day > to {
+				continue
+			}
+			if transactions[i].Type == "credit" {
+				credits += transactions[i].Amount
+			} else {
+				debits += transactions[i].Amount
+			}
+		}
+		return roundAmount(debits), roundAmount(credits)
+	}
+
+	nextClosing := dayOfMonth(closings[0].Year(), closings[0].Month()+1, account.StatementClosingDay)
+	purchases, payments := activity(closings[0], now)
+	current := CreditCardCycle{
+		PeriodStart:    closings[0].AddDate(0, 0, 1).Format("2006-01-02"),
+		PeriodEnd:      nextClosing.Format("2006-01-02"),
+		OpeningBalance: balanceAt(closings[0]),
+		ClosingBalance: roundAmount(account.Balance),
+		Purchases:      purchases,
+		Payments:       payments,
+	}
+
+	statements := make([]CreditCardStatement, 0, count)
+	for i := 0; i < count; i++ {
+		closing, previous := closings[i], closings[i+1]
+		purchases, payments := activity(previous, closing)
+
+		statement := CreditCardStatement{
+			CreditCardCycle: CreditCardCycle{
+				PeriodStart:    previous.AddDate(0, 0, 1).Format("2006-01-02"),
+				PeriodEnd:      closing.Format("2006-01-02"),
+				OpeningBalance: balanceAt(previous),
+				ClosingBalance: balanceAt(closing),
+				Purchases:      purchases,
+				Payments:       payments,
+			},
+		}
+
+		dueDate := paymentDueDate(account.PaymentDueDay, closing)
+		statement.DueDate = dueDate.Format("2006-01-02")
+		statement.StatementBalance = math.Max(0, -statement.ClosingBalance)
+		statement.MinimumPayment = minimumPayment(account, statement.StatementBalance)
+		// Payments up to now count, so a late payment still settles the statement
+		_, statement.PaidSinceClosing = activity(closing, now)
+		statement.RemainingBalance = roundAmount(math.Max(0, statement.StatementBalance-statement.PaidSinceClosing))
+		statement.RemainingMinimum = roundAmount(math.Max(0, statement.MinimumPayment-statement.PaidSinceClosing))
+
+		switch {
+		case statement.RemainingBalance == 0:
+			statement.Status = "paid"
+		case statement.RemainingMinimum == 0:
+			statement.Status = "minimum_paid"
+		case now.After(dueDate):
+			statement.Status = "overdue"
+		default:
+			statement.Status = "due"
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return current, statements, nil
+}
+
+// minimumPayment returns the larger of the percentage of the statement balance and the
+// fixed minimum amount, never more than the statement balance itself
+func minimumPayment(account *models.BankAccount, statementBalance float64) float64 {
+	if statementBalance <= 0 {
+		return 0
+	}
+	percentage := statementBalance * account.MinimumPaymentPercent / 100
+	return roundAmount(math.Min(statementBalance, math.Max(percentage, account.MinimumPaymentAmount)))
+}
+
+// statementClosingOnOrBefore returns the latest statement closing date on or before the given day
+func statementClosingOnOrBefore(closingDay int, day time.Time) time.Time {
+	closing := dayOfMonth(day.Year(), day.Month(), closingDay)
+	if closing.After(day) {
+		closing = dayOfMonth(day.Year(), day.Month()-1, closingDay)
+	}
+	return closing
+}
+
+// paymentDueDate returns the first occurrence of the due day after the closing date
+func paymentDueDate(dueDay int, closing time.Time) time.Time {
+	due := dayOfMonth(closing.Year(), closing.Month(), dueDay)
+	if !due.After(closing) {
+		due = dayOfMonth(closing.Year(), closing.Month()+1, dueDay)
+	}
+	return due
+}
+
+// dayOfMonth returns the given day of a month, clamped to the length of the month
+func dayOfMonth(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	last := first.AddDate(0, 1, -1).Day()
+	if day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func date(value string) time.Time {
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestCreditCardStatementsCountLatePayments(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{
+		AccountType:           models.AccountTypeCreditCard,
+		Balance:               -900,
+		CreditLimit:           5000,
+		StatementClosingDay:   25,
+		PaymentDueDay:         15,
+		MinimumPaymentPercent: 5,
+		MinimumPaymentAmount:  50,
+	})
+	for _, transaction := range []models.BankAccountTransaction{
+		{Type: "debit", Amount: 400, ValueDate: date("2026-08-01")},
+		{Type: "debit", Amount: 1000, ValueDate: date("2026-09-01")},
+		{Type: "credit", Amount: 400, ValueDate: date("2026-09-20")}, // The August statement, paid late
+		{Type: "credit", Amount: 100, ValueDate: date("2026-10-10")},
+		{Type: "debit", Amount: 20, ValueDate: date("2026-10-12")},
+	} {
+		transaction.UserID, transaction.BankAccountID = 1, account.ID
+		if err := db.Create(&transaction).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	account.Balance = -920
+
+	current, statements, err := buildCreditCardStatements(db, &account, date("2026-10-18"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current.PeriodStart != "2026-09-26" || current.PeriodEnd != "2026-10-25" ||
+		current.OpeningBalance != -1000 || current.Purchases != 20 || current.Payments != 100 {
+		t.Errorf("current cycle = %+v", current)
+	}
+
+	want := []struct {
+		end, due, status            string
+		balance, minimum, remaining float64
+	}{
+		{"2026-09-25", "2026-10-15", "minimum_paid", 1000, 50, 900},
+		{"2026-08-25", "2026-09-15", "paid", 400, 50, 0},
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("got %d statements, want %d", len(statements), len(want))
+	}
+	for i, statement := range statements {
+		w := want[i]
+		if statement.PeriodEnd != w.end || statement.DueDate != w.due || statement.Status != w.status ||
+			statement.StatementBalance != w.balance || statement.MinimumPayment != w.minimum || statement.RemainingBalance != w.remaining {
+			t.Errorf("statement %d = %s due %s: %s, balance %v, minimum %v, remaining %v; want %+v", i, statement.PeriodEnd,
+				statement.DueDate, statement.Status, statement.StatementBalance, statement.MinimumPayment, statement.RemainingBalance, w)
+		}
+	}
+}
+
+func TestStatementsToPayIncludeMissedOlderStatements(t *testing.T) {
+	statements := []CreditCardStatement{
+		{DueDate: "2026-11-15", RemainingBalance: 900, Status: "due"},
+		{DueDate: "2026-10-15", RemainingBalance: 500, Status: "minimum_paid"},
+		{DueDate: "2026-09-15", RemainingBalance: 300, Status: "overdue"},
+		{DueDate: "2026-08-15", Status: "paid"},
+	}
+	unpaid := statementsToPay(statements)
+	if len(unpaid) != 2 || unpaid[0].DueDate != "2026-11-15" || unpaid[1].DueDate != "2026-09-15" {
+		t.Errorf("statementsToPay = %+v, want the latest and the overdue one", unpaid)
+	}
+
+	statements[0].RemainingBalance, statements[0].Status = 0, "paid"
+	if unpaid := statementsToPay(statements); len(unpaid) != 1 || unpaid[0].Status != "overdue" {
+		t.Errorf("statementsToPay with the latest paid = %+v, want only the overdue one", unpaid)
+	}
+}
+
+func TestMinimumPayment(t *testing.T) {
+	account := &models.BankAccount{MinimumPaymentPercent: 5, MinimumPaymentAmount: 50}
+	for balance, want := range map[float64]float64{2000: 100, 300: 50, 30: 30, 0: 0, 1234.56: 61.73} {
+		if got := minimumPayment(account, balance); got != want {
+			t.Errorf("minimumPayment(%v) = %v, want %v", balance, got, want)
+		}
+	}
+}
+
+func TestStatementDates(t *testing.T) {
+	for _, tc := range []struct {
+		closingDay, dueDay int
+		day, closing, due  string
+	}{
+		{25, 15, "2026-10-18", "2026-09-25", "2026-10-15"},
+		{25, 15, "2026-10-25", "2026-10-25", "2026-11-15"},
+		{31, 28, "2026-03-10", "2026-02-28", "2026-03-28"}, // Clamped to February
+		{5, 28, "2026-03-10", "2026-03-05", "2026-03-28"},
+	} {
+		closing := statementClosingOnOrBefore(tc.closingDay, date(tc.day))
+		due := paymentDueDate(tc.dueDay, closing)
+		if closing.Format("2006-01-02") != tc.closing || due.Format("2006-01-02") != tc.due {
+			t.Errorf("closing day %d, due day %d on %s: closing %s, due %s, want %s and %s", tc.closingDay, tc.dueDay,
+				tc.day, closing.Format("2006-01-02"), due.Format("2006-01-02"), tc.closing, tc.due)
+		}
+	}
+}
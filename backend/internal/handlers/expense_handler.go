@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/abdelrahman/expense-manager/internal/database"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ExpenseHandler struct{}
@@ -26,7 +31,7 @@ func (h *ExpenseHandler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := database.GetDB().Preload("Category").Where("daily_expenses.user_id = ?", userID)
+	query := database.GetDB().Preload("Category").Preload("Tags").Where("daily_expenses.user_id = ?", userID)
 
 	// Filter by date range
 	if startDate := r.URL.Query().Get("start_date"); startDate != "" {
@@ -41,12 +46,23 @@ func (h *ExpenseHandler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		query = query.Where("category_id = ?", categoryID)
 	}
 
+	// Filter by tag
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM expense_tags WHERE expense_tags.expense_id = daily_expenses.id AND expense_tags.name = ?)",
+			strings.ToLower(strings.TrimSpace(tag)))
+	}
+
 	var expenses []models.DailyExpense
 	if err := query.Order("expense_date DESC").Find(&expenses).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
 		return
 	}
 
+	calendar := displayCalendar(r, userID)
+	for i := range expenses {
+		setHijriDates(calendar, &expenses[i])
+	}
+
 	respondWithJSON(w, http.StatusOK, expenses)
 }
 
@@ -66,11 +82,13 @@ func (h *ExpenseHandler) GetExpense(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var expense models.DailyExpense
-	if err := database.GetDB().Preload("Category").Where("id = ? AND user_id = ?", id, userID).First(&expense).Error; err != nil {
+	if err := database.GetDB().Preload("Category").Preload("Tags").Where("id = ? AND user_id = ?", id, userID).First(&expense).Error; err != nil {
 		respondWithError(w, http.StatusNotFound, "Expense not found")
 		return
 	}
 
+	setHijriDates(displayCalendar(r, userID), &expense)
+
 	respondWithJSON(w, http.StatusOK, expense)
 }
 
@@ -92,7 +110,7 @@ func (h *ExpenseHandler) GetExpensesByDate(w http.ResponseWriter, r *http.Reques
 	}
 
 	var expenses []models.DailyExpense
-	if err := database.GetDB().Preload("Category").
+	if err := database.GetDB().Preload("Category").Preload("Tags").
 		Where("expense_date = ? AND user_id = ?", date, userID).
 		Order("created_at DESC").
 		Find(&expenses).Error; err != nil {
@@ -100,6 +118,11 @@ func (h *ExpenseHandler) GetExpensesByDate(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	calendar := displayCalendar(r, userID)
+	for i := range expenses {
+		setHijriDates(calendar, &expenses[i])
+	}
+
 	respondWithJSON(w, http.StatusOK, expenses)
 }
 
@@ -111,29 +134,62 @@ func (h *ExpenseHandler) CreateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var expense models.DailyExpense
-	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+	var req expenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	if expense.Amount <= 0 {
+	if req.Amount <= 0 {
 		respondWithError(w, http.StatusBadRequest, "Amount must be greater than 0")
 		return
 	}
 
+	expense := models.DailyExpense{
+		Description: req.Description,
+		Merchant:    req.Merchant,
+		ExpenseDate: req.ExpenseDate,
+		CategoryID:  req.CategoryID,
+	}
+
 	// Set the user ID
 	expense.UserID = userID
 
-	if err := database.GetDB().Create(&expense).Error; err != nil {
+	if err := applyExpenseTax(userID, &expense, &req, true); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := models.NormalizeTags(req.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&expense).Error; err != nil {
+			return err
+		}
+		if err := models.ReplaceExpenseTags(tx, &expense, tags); err != nil {
+			return err
+		}
+		return models.AddExpenseToTotals(tx, &expense, 1)
+	}); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create expense")
 		return
 	}
 
 	// Reload with category
-	database.GetDB().Preload("Category").First(&expense, expense.ID)
+	database.GetDB().Preload("Category").Preload("Tags").First(&expense, expense.ID)
 
 	respondWithJSON(w, http.StatusCreated, expense)
+
+	// Checking the expense against the history is not worth making the client wait for
+	go func(expense models.DailyExpense) {
+		if err := notifyExpenseAnomalies(userID, &expense); err != nil {
+			log.Printf("Failed to check expense %d for anomalies: %v", expense.ID, err)
+		}
+	}(expense)
 }
 
 // UpdateExpense updates an existing expense for the authenticated user
@@ -157,33 +213,78 @@ func (h *ExpenseHandler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updateData models.DailyExpense
+	var updateData expenseRequest
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
 	// Update fields
-	if updateData.Amount > 0 {
-		expense.Amount = updateData.Amount
-	}
 	if updateData.Description != "" {
 		expense.Description = updateData.Description
 	}
+	if updateData.Merchant != "" {
+		expense.Merchant = updateData.Merchant
+	}
 	if !updateData.ExpenseDate.IsZero() {
 		expense.ExpenseDate = updateData.ExpenseDate
 	}
+	categoryChanged := updateData.CategoryID != nil && (expense.CategoryID == nil || *expense.CategoryID != *updateData.CategoryID)
 	if updateData.CategoryID != nil {
 		expense.CategoryID = updateData.CategoryID
 	}
 
-	if err := database.GetDB().Save(&expense).Error; err != nil {
+	if err := applyExpenseTax(userID, &expense, &updateData, categoryChanged); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Tags are replaced when the request has them, even as an empty list, and kept otherwise
+	tags, err := models.NormalizeTags(updateData.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// The totals move by what is stored now, which a concurrent update may have changed
+		// since the expense was read above
+		var previous models.DailyExpense
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", expense.ID, userID).First(&previous).Error; err != nil {
+			return err
+		}
+		if err := checkExpenseNotLinked(tx, expense.ID); err != nil {
+			return err
+		}
+		if err := models.AddExpenseToTotals(tx, &previous, -1); err != nil {
+			return err
+		}
+		if err := tx.Save(&expense).Error; err != nil {
+			return err
+		}
+		if updateData.Tags != nil {
+			if err := models.ReplaceExpenseTags(tx, &expense, tags); err != nil {
+				return err
+			}
+		}
+		return models.AddExpenseToTotals(tx, &expense, 1)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "Expense not found")
+		return
+	}
+	if errors.Is(err, errExpenseLinked) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update expense")
 		return
 	}
 
 	// Reload with category
-	database.GetDB().Preload("Category").First(&expense, expense.ID)
+	database.GetDB().Preload("Category").Preload("Tags").First(&expense, expense.ID)
 
 	respondWithJSON(w, http.StatusOK, expense)
 }
@@ -203,10 +304,190 @@ func (h *ExpenseHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.DailyExpense{}).Error; err != nil {
+	var expense models.DailyExpense
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&expense).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Expense not found")
+		return
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Locked so a concurrent delete cannot take the expense out of the totals twice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", expense.ID, userID).First(&expense).Error; err != nil {
+			return err
+		}
+		if err := checkExpenseNotLinked(tx, expense.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&expense).Error; err != nil {
+			return err
+		}
+		return models.AddExpenseToTotals(tx, &expense, -1)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(w, http.StatusNotFound, "Expense not found")
+		return
+	}
+	if errors.Is(err, errExpenseLinked) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete expense")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Expense deleted successfully"})
 }
+
+// expenseRequest is an expense payload with its VAT entry options
+type expenseRequest struct {
+	models.DailyExpense
+	TaxInclusive   *bool `json:"tax_inclusive"`   // Whether amount already includes VAT, true by default
+	TaxReclaimable *bool `json:"tax_reclaimable"` // Defaults to the category's setting
+}
+
+// applyExpenseTax sets the amount and VAT of an expense from a request. Without an explicit
+// rate or tax amount, the category's VAT rate applies when the expense is new or its category
+// changed, and the expense's current rate otherwise. An amount entered exclusive of VAT is
+// stored gross.
+func applyExpenseTax(userID uint, expense *models.DailyExpense, req *expenseRequest, categoryChanged bool) error {
+	if req.TaxRate != nil && (*req.TaxRate < 0 || *req.TaxRate > 100) {
+		return errors.New("Tax rate must be between 0 and 100")
+	}
+	if req.TaxAmount < 0 {
+		return errors.New("Tax amount cannot be negative")
+	}
+
+	rate := expense.TaxRate
+	switch {
+	case req.TaxRate != nil:
+		rate = req.TaxRate
+		if *rate == 0 {
+			rate = nil
+		}
+	case req.TaxAmount > 0:
+		rate = nil // Derived from the tax amount below
+	case categoryChanged:
+		rate = nil
+		if expense.CategoryID != nil {
+			var category models.Category
+			if err := database.GetDB().Where("id = ? AND user_id = ?", *expense.CategoryID, userID).First(&category).Error; err == nil {
+				rate = category.TaxRate
+				if req.TaxReclaimable == nil {
+					expense.TaxReclaimable = category.TaxReclaimable
+				}
+			}
+		}
+	}
+
+	inclusive := req.TaxInclusive == nil || *req.TaxInclusive
+	if req.Amount > 0 {
+		expense.Amount = req.Amount
+		if !inclusive {
+			switch {
+			case req.TaxAmount > 0:
+				expense.Amount = roundAmount(req.Amount + req.TaxAmount)
+			case rate != nil:
+				expense.Amount = roundAmount(req.Amount * (1 + *rate/100))
+			}
+		}
+	}
+
+	switch {
+	case req.TaxAmount > 0:
+		if req.TaxAmount >= expense.Amount {
+			return errors.New("Tax amount must be less than the amount")
+		}
+		expense.TaxAmount = req.TaxAmount
+		if rate == nil {
+			derived := roundAmount(req.TaxAmount / (expense.Amount - req.TaxAmount) * 100)
+			rate = &derived
+		}
+	case rate != nil:
+		expense.TaxAmount = roundAmount(expense.Amount * *rate / (100 + *rate))
+	default:
+		expense.TaxAmount = 0
+	}
+	expense.TaxRate = rate
+
+	if req.TaxReclaimable != nil {
+		expense.TaxReclaimable = *req.TaxReclaimable
+	}
+	if expense.TaxAmount == 0 {
+		expense.TaxReclaimable = false
+	}
+
+	return nil
+}
+
+var errExpenseLinked = errors.New("Expense belongs to a loan installment or zakat payment")
+
+// checkExpenseNotLinked refuses an expense that a paid loan installment or zakat payment
+// points to, since changing it would leave that record and its bank debit behind
+func checkExpenseNotLinked(tx *gorm.DB, expenseID uint) error {
+	var installments, payments int64
+	if err := tx.Model(&models.LoanInstallment{}).Where("expense_id = ?", expenseID).Count(&installments).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ZakatPayment{}).Where("expense_id = ?", expenseID).Count(&payments).Error; err != nil {
+		return err
+	}
+	if installments > 0 || payments > 0 {
+		return errExpenseLinked
+	}
+	return nil
+}
+
+// recordPaidExpense records a payment as an expense and, when an account is given,
+// debits it from that bank account. The returned transaction is nil without an account.
+func recordPaidExpense(tx *gorm.DB, userID uint, amount float64, description string, paidDate time.Time, categoryID, bankAccountID *uint) (*models.DailyExpense, *models.BankAccountTransaction, error) {
+	expense := models.DailyExpense{
+		UserID:        userID,
+		Amount:        amount,
+		Description:   description,
+		ExpenseDate:   paidDate,
+		CategoryID:    categoryID,
+		BankAccountID: bankAccountID,
+	}
+	if err := tx.Create(&expense).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := models.AddExpenseToTotals(tx, &expense, 1); err != nil {
+		return nil, nil, err
+	}
+
+	if bankAccountID == nil {
+		return &expense, nil, nil
+	}
+
+	var account models.BankAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", *bankAccountID, userID).
+		First(&account).Error; err != nil {
+		return nil, nil, err
+	}
+	if account.Balance-amount < account.MinimumAllowedBalance() {
+		if account.IsCreditCard() {
+			return nil, nil, errCreditLimitExceeded
+		}
+		return nil, nil, errInsufficientFunds
+	}
+
+	transaction := models.BankAccountTransaction{
+		UserID:        userID,
+		BankAccountID: account.ID,
+		Type:          "debit",
+		Amount:        amount,
+		Description:   description,
+		ValueDate:     paidDate,
+	}
+	if err := postBankAccountTransaction(tx, &account, &transaction); err != nil {
+		return nil, nil, err
+	}
+
+	return &expense, &transaction, nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func floatPtr(value float64) *float64 { return &value }
+
+func boolPtr(value bool) *bool { return &value }
+
+func TestApplyExpenseTax(t *testing.T) {
+	db := testutil.OpenDB(t)
+	vat := models.Category{UserID: 1, Name: "Groceries", TaxRate: floatPtr(15), TaxReclaimable: true}
+	plain := models.Category{UserID: 1, Name: "Rent"}
+	other := models.Category{UserID: 2, Name: "Someone else's", TaxRate: floatPtr(15)}
+	for _, category := range []*models.Category{&vat, &plain, &other} {
+		if err := db.Create(category).Error; err != nil {
+			t.Fatalf("creating category: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		expense         models.DailyExpense // Before the request, with the category it ends up in
+		req             expenseRequest
+		categoryChanged bool
+		amount          float64
+		tax             float64
+		rate            *float64
+		reclaimable     bool
+	}{
+		{
+			name:            "category rate on a new expense",
+			expense:         models.DailyExpense{CategoryID: &vat.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 115}},
+			categoryChanged: true,
+			amount:          115, tax: 15, rate: floatPtr(15), reclaimable: true,
+		},
+		{
+			name:            "amount exclusive of VAT",
+			expense:         models.DailyExpense{CategoryID: &vat.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 100}, TaxInclusive: boolPtr(false)},
+			categoryChanged: true,
+			amount:          115, tax: 15, rate: floatPtr(15), reclaimable: true,
+		},
+		{
+			name:            "explicit rate over the category's",
+			expense:         models.DailyExpense{CategoryID: &vat.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 105, TaxRate: floatPtr(5)}},
+			categoryChanged: true,
+			amount:          105, tax: 5, rate: floatPtr(5),
+		},
+		{
+			name:            "zero rate means no VAT",
+			expense:         models.DailyExpense{CategoryID: &vat.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 115, TaxRate: floatPtr(0)}, TaxReclaimable: boolPtr(true)},
+			categoryChanged: true,
+			amount:          115,
+		},
+		{
+			name:    "rate derived from the tax amount",
+			expense: models.DailyExpense{},
+			req:     expenseRequest{DailyExpense: models.DailyExpense{Amount: 230, TaxAmount: 30}},
+			amount:  230, tax: 30, rate: floatPtr(15),
+		},
+		{
+			name:    "tax amount exclusive of VAT",
+			expense: models.DailyExpense{},
+			req:     expenseRequest{DailyExpense: models.DailyExpense{Amount: 200, TaxAmount: 30}, TaxInclusive: boolPtr(false)},
+			amount:  230, tax: 30, rate: floatPtr(15),
+		},
+		{
+			name:    "unchanged category keeps the expense's rate",
+			expense: models.DailyExpense{CategoryID: &plain.ID, TaxRate: floatPtr(15), TaxReclaimable: true},
+			req:     expenseRequest{DailyExpense: models.DailyExpense{Amount: 57.5}},
+			amount:  57.5, tax: 7.5, rate: floatPtr(15), reclaimable: true,
+		},
+		{
+			name:            "moving to a category without VAT",
+			expense:         models.DailyExpense{Amount: 115, CategoryID: &plain.ID, TaxRate: floatPtr(15), TaxAmount: 15, TaxReclaimable: true},
+			req:             expenseRequest{},
+			categoryChanged: true,
+			amount:          115,
+		},
+		{
+			name:            "reclaimable turned off",
+			expense:         models.DailyExpense{CategoryID: &vat.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 115}, TaxReclaimable: boolPtr(false)},
+			categoryChanged: true,
+			amount:          115, tax: 15, rate: floatPtr(15),
+		},
+		{
+			name:            "another user's category",
+			expense:         models.DailyExpense{CategoryID: &other.ID},
+			req:             expenseRequest{DailyExpense: models.DailyExpense{Amount: 115}},
+			categoryChanged: true,
+			amount:          115,
+		},
+	}
+	for _, tt := range tests {
+		expense := tt.expense
+		req := tt.req
+		if err := applyExpenseTax(1, &expense, &req, tt.categoryChanged); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if expense.Amount != tt.amount || expense.TaxAmount != tt.tax || expense.TaxReclaimable != tt.reclaimable {
+			t.Errorf("%s: amount %v, tax %v, reclaimable %v, want %v, %v, %v", tt.name,
+				expense.Amount, expense.TaxAmount, expense.TaxReclaimable, tt.amount, tt.tax, tt.reclaimable)
+		}
+		if (expense.TaxRate == nil) != (tt.rate == nil) || (tt.rate != nil && *expense.TaxRate != *tt.rate) {
+			t.Errorf("%s: rate %v, want %v", tt.name, expense.TaxRate, tt.rate)
+		}
+	}
+}
+
+func TestApplyExpenseTaxRejectsInvalidVAT(t *testing.T) {
+	testutil.OpenDB(t)
+	for name, req := range map[string]expenseRequest{
+		"rate above 100":            {DailyExpense: models.DailyExpense{Amount: 100, TaxRate: floatPtr(101)}},
+		"negative rate":             {DailyExpense: models.DailyExpense{Amount: 100, TaxRate: floatPtr(-1)}},
+		"negative tax amount":       {DailyExpense: models.DailyExpense{Amount: 100, TaxAmount: -1}},
+		"tax amount over the gross": {DailyExpense: models.DailyExpense{Amount: 100, TaxAmount: 100}},
+	} {
+		expense := models.DailyExpense{}
+		if err := applyExpenseTax(1, &expense, &req, true); err == nil {
+			t.Errorf("%s: applyExpenseTax succeeded", name)
+		}
+	}
+}
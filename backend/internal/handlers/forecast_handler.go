@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/currency"
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+type ForecastHandler struct {
+	converter *currency.Converter
+}
+
+func NewForecastHandler(converter *currency.Converter) *ForecastHandler {
+	return &ForecastHandler{converter: converter}
+}
+
+// Forecast event types
+const (
+	forecastRecurring   = "recurring"
+	forecastInstallment = "installment"
+	forecastCardPayment = "card_payment"
+)
+
+// historyDays is how far back average daily spending is measured
+const historyDays = 90
+
+type CashFlowForecast struct {
+	Currency          string            `json:"currency"`
+	From              string            `json:"from"`
+	To                string            `json:"to"`
+	Threshold         float64           `json:"threshold"`
+	PrimaryAccountID  uint              `json:"primary_account_id"` // Receives unassigned items and day-to-day spending
+	StartingBalance   float64           `json:"starting_balance"`
+	EndingBalance     float64           `json:"ending_balance"`
+	LowestBalance     float64           `json:"lowest_balance"`
+	LowestBalanceDate string            `json:"lowest_balance_date"`
+	AverageDailySpend float64           `json:"average_daily_spend"` // Forecast day-to-day spending per day
+	Accounts          []ForecastAccount `json:"accounts"`
+	Alerts            []ForecastAlert   `json:"alerts"`
+	Days              []ForecastDay     `json:"days"`
+}
+
+type ForecastAccount struct {
+	AccountID         uint    `json:"account_id"`
+	AccountName       string  `json:"account_name"`
+	Currency          string  `json:"currency"`
+	CurrentBalance    float64 `json:"current_balance"`
+	EndingBalance     float64 `json:"ending_balance"`
+	LowestBalance     float64 `json:"lowest_balance"`
+	LowestBalanceDate string  `json:"lowest_balance_date"`
+}
+
+// ForecastAlert marks the first day of each dip of an account below the threshold
+type ForecastAlert struct {
+	Date        string  `json:"date"`
+	AccountID   uint    `json:"account_id"`
+	AccountName string  `json:"account_name"`
+	Balance     float64 `json:"balance"`
+	Threshold   float64 `json:"threshold"`
+}
+
+type ForecastDay struct {
+	Date           string          `json:"date"`
+	Inflows        float64         `json:"inflows"`
+	Outflows       float64         `json:"outflows"` // Scheduled payments, in the forecast currency
+	Discretionary  float64         `json:"discretionary"`
+	Balance        float64         `json:"balance"` // All accounts, in the forecast currency
+	BelowThreshold bool            `json:"below_threshold"`
+	Events         []ForecastEvent `json:"events,omitempty"`
+}
+
+type ForecastEvent struct {
+	Type       string  `json:"type"` // recurring, installment or card_payment
+	Name       string  `json:"name"`
+	AccountID  uint    `json:"account_id"`
+	Amount     float64 `json:"amount"` // Signed, in the account currency
+	CategoryID *uint   `json:"-"`
+}
+
+// GetCashFlowForecast projects daily balances for the next days (default 90) from current
+// balances, recurring items, loan installments, credit card payments and expected day-to-day
+// spending: the rest of each monthly plan spread over its period, and the average daily spend
+// of the last 90 days for categories without a plan
+func (h *ForecastHandler) GetCashFlowForecast(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	days := 90
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		if parsed, err := strconv.Atoi(daysParam); err == nil && parsed > 0 {
+			if parsed > 365 {
+				parsed = 365
+			}
+			days = parsed
+		}
+	}
+
+	threshold := 0.0
+	if thresholdParam := r.URL.Query().Get("threshold"); thresholdParam != "" {
+		parsed, err := strconv.ParseFloat(thresholdParam, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid threshold")
+			return
+		}
+		threshold = parsed
+	}
+
+	target := currency.Normalize(r.URL.Query().Get("currency"))
+	if target == "" {
+		target = h.converter.Base()
+	}
+	if !h.converter.Supports(target) {
+		respondWithError(w, http.StatusBadRequest, "Unsupported currency")
+		return
+	}
+
+	var accounts []models.BankAccount
+	if err := database.GetDB().Where("user_id = ? AND is_active = ?", userID, true).Order("id ASC").Find(&accounts).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch bank accounts")
+		return
+	}
+	if len(accounts) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No active bank accounts to forecast")
+		return
+	}
+
+	accountsByID := make(map[uint]*models.BankAccount, len(accounts))
+	for i := range accounts {
+		if !h.converter.Supports(accounts[i].Currency) {
+			respondWithError(w, http.StatusBadRequest, "Unsupported currency on account "+accounts[i].AccountName)
+			return
+		}
+		accountsByID[accounts[i].ID] = &accounts[i]
+	}
+
+	primary := forecastPrimaryAccount(accounts)
+	if accountParam := r.URL.Query().Get("account_id"); accountParam != "" {
+		id, err := strconv.ParseUint(accountParam, 10, 32)
+		if err != nil || accountsByID[uint(id)] == nil {
+			respondWithError(w, http.StatusBadRequest, "Bank account not found")
+			return
+		}
+		primary = accountsByID[uint(id)]
+	}
+
+	from := today()
+	to := from.AddDate(0, 0, days-1)
+	// accountFor routes a scheduled item to its account, or the primary account when it has none
+	accountFor := func(id *uint) uint {
+		if id != nil && accountsByID[*id] != nil {
+			return *id
+		}
+		return primary.ID
+	}
+
+	// Scheduled items, keyed by day; anything overdue is expected today
+	events := make(map[string][]ForecastEvent)
+	schedule := func(day time.Time, event ForecastEvent) {
+		if day.Before(from) {
+			day = from
+		}
+		if day.After(to) {
+			return
+		}
+		key := day.Format("2006-01-02")
+		events[key] = append(events[key], event)
+	}
+
+	var items []models.RecurringItem
+	if err := database.GetDB().Where("user_id = ? AND is_active = ?", userID, true).Find(&items).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch recurring items")
+		return
+	}
+	scheduledCategories := make(map[uint]bool)
+	for i := range items {
+		item := &items[i]
+		if item.Type == models.RecurringExpense && item.CategoryID != nil {
+			scheduledCategories[*item.CategoryID] = true
+		}
+		for offset := 0; ; offset++ {
+			day := scheduledDate(item.StartDate, item.Frequency, offset)
+			if day.After(to) || (item.EndDate != nil && day.After(*item.EndDate)) {
+				break
+			}
+			if day.Before(from) {
+				continue
+			}
+			schedule(day, ForecastEvent{
+				Type:       forecastRecurring,
+				Name:       item.Name,
+				AccountID:  accountFor(item.BankAccountID),
+				Amount:     item.SignedAmount(),
+				CategoryID: item.CategoryID,
+			})
+		}
+	}
+
+	var loans []models.Loan
+	if err := database.GetDB().Preload("Installments").
+		Where("user_id = ? AND status = ?", userID, models.LoanStatusActive).
+		Find(&loans).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+		return
+	}
+	for i := range loans {
+		loan := &loans[i]
+		if loan.CategoryID != nil {
+			scheduledCategories[*loan.CategoryID] = true
+		}
+		for j := range loan.Installments {
+			installment := &loan.Installments[j]
+			if installment.IsPaid() {
+				continue
+			}
+			schedule(installment.DueDate, ForecastEvent{
+				Type:       forecastInstallment,
+				Name:       loan.Name,
+				AccountID:  accountFor(loan.BankAccountID),
+				Amount:     -installment.Amount,
+				CategoryID: loan.CategoryID,
+			})
+		}
+	}
+
+	// Credit card statements are paid from the primary account by their due date
+	for i := range accounts {
+		card := &accounts[i]
+		if !card.IsCreditCard() || !card.HasStatementCycle() || card.ID == primary.ID {
+			continue
+		}
+		_, statements, err := buildCreditCardStatements(database.GetDB(), card, from, 1)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to calculate statements")
+			return
+		}
+		if remaining := statements[0].RemainingBalance; remaining > 0 {
+			dueDate, _ := time.ParseInLocation("2006-01-02", statements[0].DueDate, time.Local)
+			schedule(dueDate, ForecastEvent{Type: forecastCardPayment, Name: card.AccountName, AccountID: primary.ID, Amount: -remaining})
+			schedule(dueDate, ForecastEvent{Type: forecastCardPayment, Name: card.AccountName, AccountID: card.ID, Amount: remaining})
+		}
+	}
+
+	// Average daily spend of the last days per category, for categories without a plan
+	var history []struct {
+		CategoryID  *uint
+		TotalAmount float64
+	}
+	if err := database.GetDB().Model(&models.DailyExpense{}).
+		Select("category_id, SUM(amount) as total_amount").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ?", userID, from.AddDate(0, 0, -historyDays), from).
+		Group("category_id").
+		Scan(&history).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	settings := loadBudgetPeriod(userID)
+	spending := make(map[string]float64) // Expected daily spending, cached per period
+	var plansErr, spentErr error
+	dailySpending := func(day time.Time) float64 {
+		period := models.CalendarMonth(day.Year(), int(day.Month()))
+		if settings.IsMonthly() {
+			period = settings.Containing(day)
+		}
+		key := period.Start.Format("2006-01-02")
+		if amount, cached := spending[key]; cached {
+			return amount
+		}
+
+		plans, err := loadMonthPlans(userID, models.CalendarGregorian, period.Year, period.Month)
+		if err != nil {
+			plansErr = err
+			return 0
+		}
+		start := period.Start
+		if start.Before(from) {
+			start = from
+		}
+		remainingDays := float64(models.DaysBetween(start, period.End))
+
+		// Already spent this period, and still scheduled, by category
+		committed := make(map[uint]float64)
+		if period.Start.Before(from) {
+			var spent []struct {
+				CategoryID  *uint
+				TotalAmount float64
+			}
+			if err := database.GetDB().Model(&models.DailyExpense{}).
+				Select("category_id, SUM(amount) as total_amount").
+				Where("user_id = ? AND expense_date >= ? AND expense_date < ? AND category_id IS NOT NULL", userID, period.Start, from.AddDate(0, 0, 1)).
+				Group("category_id").
+				Scan(&spent).Error; err != nil {
+				spentErr = err
+				return 0
+			}
+			for _, row := range spent {
+				committed[*row.CategoryID] += row.TotalAmount
+			}
+		}
+		for d := start; d.Before(period.End); d = d.AddDate(0, 0, 1) {
+			for _, event := range events[d.Format("2006-01-02")] {
+				if event.CategoryID != nil && event.Amount < 0 {
+					committed[*event.CategoryID] -= event.Amount
+				}
+			}
+		}
+
+		amount := 0.0
+		for categoryID, planned := range plans.byCategory {
+			amount += math.Max(0, planned-committed[categoryID]) / remainingDays
+		}
+		for _, row := range history {
+			if row.CategoryID != nil {
+				if _, planned := plans.byCategory[*row.CategoryID]; planned || scheduledCategories[*row.CategoryID] {
+					continue
+				}
+			}
+			amount += row.TotalAmount / historyDays
+		}
+
+		spending[key] = amount
+		return amount
+	}
+
+	balances := make(map[uint]float64, len(accounts))
+	summaries := make(map[uint]*ForecastAccount, len(accounts))
+	belowThreshold := make(map[uint]bool, len(accounts))
+	forecast := CashFlowForecast{
+		Currency:         target,
+		From:             from.Format("2006-01-02"),
+		To:               to.Format("2006-01-02"),
+		Threshold:        threshold,
+		PrimaryAccountID: primary.ID,
+		Accounts:         make([]ForecastAccount, 0, len(accounts)),
+		Alerts:           []ForecastAlert{},
+		Days:             make([]ForecastDay, 0, days),
+	}
+	for i := range accounts {
+		account := &accounts[i]
+		balances[account.ID] = account.Balance
+		forecast.Accounts = append(forecast.Accounts, ForecastAccount{
+			AccountID:         account.ID,
+			AccountName:       account.AccountName,
+			Currency:          currency.Normalize(account.Currency),
+			CurrentBalance:    account.Balance,
+			LowestBalance:     account.Balance,
+			LowestBalanceDate: forecast.From,
+		})
+	}
+	for i := range forecast.Accounts {
+		summaries[forecast.Accounts[i].AccountID] = &forecast.Accounts[i]
+	}
+
+	// total converts the sum of all balances to the forecast currency
+	total := func() float64 {
+		sum := 0.0
+		for id, balance := range balances {
+			converted, _ := h.converter.Convert(balance, accountsByID[id].Currency, target)
+			sum += converted
+		}
+		return roundAmount(sum)
+	}
+	forecast.StartingBalance = total()
+	forecast.LowestBalance = forecast.StartingBalance
+	forecast.LowestBalanceDate = forecast.From
+
+	discretionaryTotal := 0.0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		point := ForecastDay{Date: key, Events: events[key]}
+
+		for _, event := range point.Events {
+			balances[event.AccountID] += event.Amount
+			if event.Type == forecastCardPayment {
+				continue // Moves money between own accounts
+			}
+			converted, _ := h.converter.Convert(event.Amount, accountsByID[event.AccountID].Currency, target)
+			if converted > 0 {
+				point.Inflows += converted
+			} else {
+				point.Outflows -= converted
+			}
+		}
+
+		discretionary := dailySpending(day)
+		balances[primary.ID] -= discretionary
+		discretionaryTotal += discretionary
+		converted, _ := h.converter.Convert(discretionary, primary.Currency, target)
+		point.Discretionary = roundAmount(converted)
+		point.Inflows = roundAmount(point.Inflows)
+		point.Outflows = roundAmount(point.Outflows)
+		point.Balance = total()
+
+		if point.Balance < forecast.LowestBalance {
+			forecast.LowestBalance = point.Balance
+			forecast.LowestBalanceDate = key
+		}
+
+		for i := range accounts {
+			account := &accounts[i]
+			balance := roundAmount(balances[account.ID])
+			summary := summaries[account.ID]
+			if balance < summary.LowestBalance {
+				summary.LowestBalance = balance
+				summary.LowestBalanceDate = key
+			}
+
+			// Credit cards and loans run negative by design
+			if account.IsLiability() {
+				continue
+			}
+			if balance < threshold {
+				point.BelowThreshold = true
+				if !belowThreshold[account.ID] {
+					forecast.Alerts = append(forecast.Alerts, ForecastAlert{
+						Date:        key,
+						AccountID:   account.ID,
+						AccountName: account.AccountName,
+						Balance:     balance,
+						Threshold:   threshold,
+					})
+				}
+			}
+			belowThreshold[account.ID] = balance < threshold
+		}
+
+		forecast.Days = append(forecast.Days, point)
+	}
+
+	if plansErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
+		return
+	}
+	if spentErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	for i := range forecast.Accounts {
+		forecast.Accounts[i].EndingBalance = roundAmount(balances[forecast.Accounts[i].AccountID])
+	}
+	forecast.EndingBalance = total()
+	averageSpend, _ := h.converter.Convert(discretionaryTotal/float64(days), primary.Currency, target)
+	forecast.AverageDailySpend = roundAmount(averageSpend)
+
+	respondWithJSON(w, http.StatusOK, forecast)
+}
+
+// forecastPrimaryAccount picks the account day-to-day spending comes out of: the first
+// checking account, otherwise the first account that is not a liability
+func forecastPrimaryAccount(accounts []models.BankAccount) *models.BankAccount {
+	for i := range accounts {
+		if accountType, _ := models.NormalizeAccountType(accounts[i].AccountType); accountType == models.AccountTypeChecking {
+			return &accounts[i]
+		}
+	}
+	for i := range accounts {
+		if !accounts[i].IsLiability() {
+			return &accounts[i]
+		}
+	}
+	return &accounts[0]
+}
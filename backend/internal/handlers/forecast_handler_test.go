@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/currency"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func TestForecastFailsWhenExpensesCannotBeLoaded(t *testing.T) {
+	db := testutil.OpenDB(t)
+	seedAccount(t, db, models.BankAccount{Balance: 1000})
+	handler := NewForecastHandler(currency.NewConverter("SAR", nil))
+
+	forecast := func() int {
+		return testutil.Serve(handler.GetCashFlowForecast, testutil.AsUser(
+			testutil.Request(t, http.MethodGet, "/api/reports/cash-flow-forecast?days=30", nil), 1)).Code
+	}
+	if code := forecast(); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+
+	if err := db.Migrator().DropTable(&models.DailyExpense{}); err != nil {
+		t.Fatalf("dropping expenses: %v", err)
+	}
+	if code := forecast(); code != http.StatusInternalServerError {
+		t.Errorf("status without an expenses table = %d, want 500", code)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"time"
 )
 
 // respondWithError sends an error response
@@ -23,3 +25,14 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	w.Write(response)
 }
+
+// today returns midnight of the current local day
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// roundAmount rounds a money amount to two decimals
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoanHandler struct{}
+
+func NewLoanHandler() *LoanHandler {
+	return &LoanHandler{}
+}
+
+type loanRequest struct {
+	Name             string  `json:"name"`
+	Provider         string  `json:"provider"`
+	Principal        float64 `json:"principal"`
+	ProfitRate       float64 `json:"profit_rate"`
+	Currency         string  `json:"currency"`
+	InstallmentCount int     `json:"installment_count"`
+	Frequency        string  `json:"frequency"`
+	StartDate        string  `json:"start_date"`     // YYYY-MM-DD, defaults to today
+	FirstDueDate     string  `json:"first_due_date"` // YYYY-MM-DD
+	BankAccountID    *uint   `json:"bank_account_id"`
+	CategoryID       *uint   `json:"category_id"`
+	Notes            string  `json:"notes"`
+}
+
+type payInstallmentRequest struct {
+	PaidDate      string `json:"paid_date"`       // YYYY-MM-DD, defaults to today
+	BankAccountID *uint  `json:"bank_account_id"` // Overrides the loan's linked account
+}
+
+// UpcomingInstallment is a pending installment with the loan it belongs to
+type UpcomingInstallment struct {
+	models.LoanInstallment
+	LoanName string `json:"loan_name"`
+	Provider string `json:"provider"`
+	Currency string `json:"currency"`
+	Overdue  bool   `json:"overdue"`
+}
+
+var errInstallmentAlreadyPaid = errors.New("Installment is already paid")
+
+// periodsPerYear maps installment frequencies to the number of periods in a year
+var periodsPerYear = map[string]int{
+	"weekly":   52,
+	"biweekly": 26,
+	"monthly":  12,
+}
+
+// GetLoans returns all loans of the authenticated user with their remaining amounts
+func (h *LoanHandler) GetLoans(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := database.GetDB().Preload("Category").Preload("Installments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sequence ASC")
+	}).Where("loans.user_id = ?", userID)
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var loans []models.Loan
+	if err := query.Order("start_date DESC").Find(&loans).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+		return
+	}
+
+	if loans == nil {
+		loans = []models.Loan{}
+	}
+	for i := range loans {
+		loans[i].RemainingAmount = roundAmount(loans[i].RemainingAt(today()))
+	}
+
+	respondWithJSON(w, http.StatusOK, loans)
+}
+
+// GetLoan returns a single loan with its installment schedule
+func (h *LoanHandler) GetLoan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	loan, err := findLoan(database.GetDB(), uint(id), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Loan not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loan)
+}
+
+// CreateLoan creates a loan and generates its installment schedule
+func (h *LoanHandler) CreateLoan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req loanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		respondWithError(w, http.StatusBadRequest, "Loan name is required")
+		return
+	}
+	if req.Principal <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Principal must be greater than 0")
+		return
+	}
+	if req.ProfitRate < 0 {
+		respondWithError(w, http.StatusBadRequest, "Profit rate cannot be negative")
+		return
+	}
+	if req.InstallmentCount < 1 || req.InstallmentCount > 360 {
+		respondWithError(w, http.StatusBadRequest, "Installment count must be between 1 and 360")
+		return
+	}
+
+	frequency := strings.ToLower(strings.TrimSpace(req.Frequency))
+	if frequency == "" {
+		frequency = "monthly"
+	}
+	if _, ok := periodsPerYear[frequency]; !ok {
+		respondWithError(w, http.StatusBadRequest, "Frequency must be weekly, biweekly or monthly")
+		return
+	}
+
+	startDate := today()
+	if req.StartDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid start date format. Use YYYY-MM-DD")
+			return
+		}
+		startDate = parsed
+	}
+
+	firstDueDate, err := time.ParseInLocation("2006-01-02", req.FirstDueDate, time.Local)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid first due date format. Use YYYY-MM-DD")
+		return
+	}
+	if firstDueDate.Before(startDate) {
+		respondWithError(w, http.StatusBadRequest, "First due date cannot be before the start date")
+		return
+	}
+
+	if req.BankAccountID != nil {
+		var account models.BankAccount
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *req.BankAccountID, userID).First(&account).Error; err != nil {
+			respondWithError(w, http.StatusBadRequest, "Bank account not found")
+			return
+		}
+		if req.Currency == "" {
+			req.Currency = account.Currency
+		}
+	}
+	if req.CategoryID != nil {
+		var category models.Category
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *req.CategoryID, userID).First(&category).Error; err != nil {
+			respondWithError(w, http.StatusBadRequest, "Category not found")
+			return
+		}
+	}
+
+	loan := models.Loan{
+		UserID:           userID,
+		Name:             strings.TrimSpace(req.Name),
+		Provider:         req.Provider,
+		Principal:        req.Principal,
+		ProfitRate:       req.ProfitRate,
+		Currency:         req.Currency,
+		InstallmentCount: req.InstallmentCount,
+		Frequency:        frequency,
+		StartDate:        startDate,
+		FirstDueDate:     firstDueDate,
+		BankAccountID:    req.BankAccountID,
+		CategoryID:       req.CategoryID,
+		Status:           models.LoanStatusActive,
+		Notes:            req.Notes,
+	}
+	loan.Installments = buildInstallmentSchedule(&loan)
+	for _, installment := range loan.Installments {
+		loan.TotalAmount += installment.Amount
+	}
+	loan.TotalAmount = roundAmount(loan.TotalAmount)
+
+	if err := database.GetDB().Create(&loan).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create loan")
+		return
+	}
+
+	created, err := findLoan(database.GetDB(), loan.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load loan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+// UpdateLoan updates the descriptive fields of a loan; the schedule is fixed once created
+func (h *LoanHandler) UpdateLoan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	var loan models.Loan
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&loan).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Loan not found")
+		return
+	}
+
+	var updateData loanRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Update fields
+	if updateData.Name != "" {
+		loan.Name = strings.TrimSpace(updateData.Name)
+	}
+	if updateData.Provider != "" {
+		loan.Provider = updateData.Provider
+	}
+	if updateData.BankAccountID != nil {
+		var account models.BankAccount
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *updateData.BankAccountID, userID).First(&account).Error; err != nil {
+			respondWithError(w, http.StatusBadRequest, "Bank account not found")
+			return
+		}
+		loan.BankAccountID = updateData.BankAccountID
+	}
+	if updateData.CategoryID != nil {
+		var category models.Category
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *updateData.CategoryID, userID).First(&category).Error; err != nil {
+			respondWithError(w, http.StatusBadRequest, "Category not found")
+			return
+		}
+		loan.CategoryID = updateData.CategoryID
+	}
+	loan.Notes = updateData.Notes
+
+	if err := database.GetDB().Omit("Category", "Installments").Save(&loan).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update loan")
+		return
+	}
+
+	updated, err := findLoan(database.GetDB(), loan.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load loan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// DeleteLoan deletes a loan and its schedule; expenses recorded for paid installments are kept
+func (h *LoanHandler) DeleteLoan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var loan models.Loan
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&loan).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("loan_id = ?", loan.ID).Delete(&models.LoanInstallment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&loan).Error
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondWithError(w, http.StatusNotFound, "Loan not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete loan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Loan deleted successfully"})
+}
+
+// PayInstallment marks an installment as paid, records it as an expense and debits the linked account
+func (h *LoanHandler) PayInstallment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+	installmentID, err := strconv.ParseUint(vars["installmentId"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid installment ID")
+		return
+	}
+
+	var req payInstallmentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	paidDate := today()
+	if req.PaidDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.PaidDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid paid date format. Use YYYY-MM-DD")
+			return
+		}
+		if parsed.After(paidDate) {
+			respondWithError(w, http.StatusBadRequest, "Paid date cannot be in the future")
+			return
+		}
+		paidDate = parsed
+	}
+
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var loan models.Loan
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&loan).Error; err != nil {
+			return err
+		}
+
+		// Lock the installment so two requests cannot both find it unpaid and pay it twice
+		var installment models.LoanInstallment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND loan_id = ?", installmentID, loan.ID).
+			First(&installment).Error; err != nil {
+			return err
+		}
+		if installment.IsPaid() {
+			return errInstallmentAlreadyPaid
+		}
+
+		description := fmt.Sprintf("%s installment %d/%d", loan.Name, installment.Sequence, loan.InstallmentCount)
+
+		accountID := loan.BankAccountID
+		if req.BankAccountID != nil {
+			accountID = req.BankAccountID
+		}
+
+		expense, transaction, err := recordPaidExpense(tx, userID, installment.Amount, description, paidDate, loan.CategoryID, accountID)
+		if err != nil {
+			return err
+		}
+		installment.ExpenseID = &expense.ID
+		if transaction != nil {
+			installment.BankAccountTransactionID = &transaction.ID
+		}
+
+		installment.Status = models.InstallmentStatusPaid
+		installment.PaidAt = &paidDate
+		if err := tx.Save(&installment).Error; err != nil {
+			return err
+		}
+
+		var pending int64
+		if err := tx.Model(&models.LoanInstallment{}).
+			Where("loan_id = ? AND status = ?", loan.ID, models.InstallmentStatusPending).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending == 0 {
+			return tx.Model(&loan).Update("status", models.LoanStatusPaidOff).Error
+		}
+		return nil
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			respondWithError(w, http.StatusNotFound, "Loan, installment or bank account not found")
+		case errors.Is(err, errInstallmentAlreadyPaid):
+			respondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, errInsufficientFunds), errors.Is(err, errCreditLimitExceeded):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to pay installment")
+		}
+		return
+	}
+
+	loan, err := findLoan(database.GetDB(), uint(id), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load loan")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loan)
+}
+
+// GetUpcomingInstallments returns pending installments due within the next days (default 30), including overdue ones
+func (h *LoanHandler) GetUpcomingInstallments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	days := 30
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		if parsed, err := strconv.Atoi(daysParam); err == nil && parsed >= 0 {
+			if parsed > 365 {
+				parsed = 365
+			}
+			days = parsed
+		}
+	}
+
+	now := today()
+	var installments []models.LoanInstallment
+	if err := database.GetDB().
+		Where("user_id = ? AND status = ? AND due_date <= ?", userID, models.InstallmentStatusPending, now.AddDate(0, 0, days)).
+		Order("due_date ASC, id ASC").
+		Find(&installments).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch installments")
+		return
+	}
+
+	var loans []models.Loan
+	if err := database.GetDB().Where("user_id = ?", userID).Find(&loans).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+		return
+	}
+	loansByID := make(map[uint]*models.Loan, len(loans))
+	for i := range loans {
+		loansByID[loans[i].ID] = &loans[i]
+	}
+
+	upcoming := make([]UpcomingInstallment, 0, len(installments))
+	for _, installment := range installments {
+		loan, exists := loansByID[installment.LoanID]
+		if !exists {
+			continue
+		}
+		upcoming = append(upcoming, UpcomingInstallment{
+			LoanInstallment: installment,
+			LoanName:        loan.Name,
+			Provider:        loan.Provider,
+			Currency:        loan.Currency,
+			Overdue:         installment.DueDate.Format("2006-01-02") < now.Format("2006-01-02"),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, upcoming)
+}
+
+// findLoan loads a loan with its category and installment schedule
+func findLoan(db *gorm.DB, id, userID uint) (*models.Loan, error) {
+	var loan models.Loan
+	if err := db.Preload("Category").Preload("Installments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sequence ASC")
+	}).Where("id = ? AND user_id = ?", id, userID).First(&loan).Error; err != nil {
+		return nil, err
+	}
+
+	loan.RemainingAmount = roundAmount(loan.RemainingAt(today()))
+	return &loan, nil
+}
+
+// buildInstallmentSchedule splits the principal and a flat profit over the installments.
+// Rounding differences are absorbed by the last installment.
+func buildInstallmentSchedule(loan *models.Loan) []models.LoanInstallment {
+	count := loan.InstallmentCount
+	years := float64(count) / float64(periodsPerYear[loan.Frequency])
+	profit := roundAmount(loan.Principal * loan.ProfitRate / 100 * years)
+
+	principalPortion := roundAmount(loan.Principal / float64(count))
+	profitPortion := roundAmount(profit / float64(count))
+
+	installments := make([]models.LoanInstallment, 0, count)
+	for i := 0; i < count; i++ {
+		principal, profitShare := principalPortion, profitPortion
+		if i == count-1 {
+			principal = roundAmount(loan.Principal - principalPortion*float64(count-1))
+			profitShare = roundAmount(profit - profitPortion*float64(count-1))
+		}
+
+		installments = append(installments, models.LoanInstallment{
+			UserID:           loan.UserID,
+			Sequence:         i + 1,
+			DueDate:          scheduledDate(loan.FirstDueDate, loan.Frequency, i),
+			Amount:           roundAmount(principal + profitShare),
+			PrincipalPortion: principal,
+			ProfitPortion:    profitShare,
+			Status:           models.InstallmentStatusPending,
+		})
+	}
+
+	return installments
+}
+
+// scheduledDate returns the date of the occurrence at the given offset from the first one
+// of a weekly, biweekly, monthly or yearly schedule, such as a loan installment
+func scheduledDate(first time.Time, frequency string, offset int) time.Time {
+	switch frequency {
+	case "weekly":
+		return first.AddDate(0, 0, 7*offset)
+	case "biweekly":
+		return first.AddDate(0, 0, 14*offset)
+	case "yearly":
+		return dayOfMonth(first.Year()+offset, first.Month(), first.Day())
+	default:
+		return dayOfMonth(first.Year(), first.Month()+time.Month(offset), first.Day())
+	}
+}
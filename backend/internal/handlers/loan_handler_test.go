@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func TestBuildInstallmentSchedule(t *testing.T) {
+	loan := &models.Loan{
+		UserID:           1,
+		Principal:        1000,
+		ProfitRate:       10,
+		InstallmentCount: 3,
+		Frequency:        "monthly",
+		FirstDueDate:     time.Date(2026, time.January, 31, 0, 0, 0, 0, time.Local),
+	}
+
+	// A quarter of a year at 10% is 25 of profit; the last installment takes the rounding
+	want := []struct {
+		due                       string
+		amount, principal, profit float64
+	}{
+		{"2026-01-31", 341.66, 333.33, 8.33},
+		{"2026-02-28", 341.66, 333.33, 8.33},
+		{"2026-03-31", 341.68, 333.34, 8.34},
+	}
+	installments := buildInstallmentSchedule(loan)
+	if len(installments) != len(want) {
+		t.Fatalf("got %d installments, want %d", len(installments), len(want))
+	}
+	for i, installment := range installments {
+		w := want[i]
+		if due := installment.DueDate.Format("2006-01-02"); due != w.due || installment.Sequence != i+1 ||
+			installment.Amount != w.amount || installment.PrincipalPortion != w.principal || installment.ProfitPortion != w.profit {
+			t.Errorf("installment %d = %s %v (%v + %v), want %s %v (%v + %v)", i+1, due, installment.Amount,
+				installment.PrincipalPortion, installment.ProfitPortion, w.due, w.amount, w.principal, w.profit)
+		}
+	}
+
+	loan.Frequency, loan.ProfitRate, loan.InstallmentCount = "biweekly", 0, 4
+	installments = buildInstallmentSchedule(loan)
+	if last := installments[3]; last.DueDate.Format("2006-01-02") != "2026-03-14" || last.Amount != 250 {
+		t.Errorf("last biweekly installment = %s %v, want 2026-03-14 250", last.DueDate.Format("2006-01-02"), last.Amount)
+	}
+}
+
+func TestPaidInstallmentIsPaidOnceAndKeepsItsExpense(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{Balance: 1000})
+	loan := models.Loan{
+		UserID:           1,
+		Name:             "Phone",
+		Principal:        300,
+		TotalAmount:      300,
+		InstallmentCount: 3,
+		Frequency:        "monthly",
+		StartDate:        time.Date(2026, time.January, 1, 0, 0, 0, 0, time.Local),
+		FirstDueDate:     time.Date(2026, time.February, 1, 0, 0, 0, 0, time.Local),
+		BankAccountID:    &account.ID,
+		Status:           models.LoanStatusActive,
+	}
+	loan.Installments = buildInstallmentSchedule(&loan)
+	if err := db.Create(&loan).Error; err != nil {
+		t.Fatalf("creating loan: %v", err)
+	}
+	installment := loan.Installments[0]
+
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := testutil.WithVars(testutil.Request(t, http.MethodPost, "/", nil),
+				map[string]string{"id": fmt.Sprint(loan.ID), "installmentId": fmt.Sprint(installment.ID)})
+			code := testutil.Serve(NewLoanHandler().PayInstallment, testutil.AsUser(r, 1)).Code
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusOK] != 1 || codes[http.StatusConflict] != 4 {
+		t.Errorf("responses = %v, want 1 paid and 4 conflicts", codes)
+	}
+	var expenses int64
+	db.Model(&models.DailyExpense{}).Count(&expenses)
+	var stored models.BankAccount
+	db.First(&stored, account.ID)
+	if expenses != 1 || stored.Balance != 900 {
+		t.Errorf("%d expenses and balance %v, want 1 and 900", expenses, stored.Balance)
+	}
+
+	db.First(&installment, installment.ID)
+	vars := map[string]string{"id": fmt.Sprint(*installment.ExpenseID)}
+	handler := NewExpenseHandler()
+	r := testutil.WithVars(testutil.Request(t, http.MethodPut, "/", map[string]interface{}{"amount": 1}), vars)
+	if code := testutil.Serve(handler.UpdateExpense, testutil.AsUser(r, 1)).Code; code != http.StatusConflict {
+		t.Errorf("updating the installment's expense: status %d, want 409", code)
+	}
+	r = testutil.WithVars(testutil.Request(t, http.MethodDelete, "/", nil), vars)
+	if code := testutil.Serve(handler.DeleteExpense, testutil.AsUser(r, 1)).Code; code != http.StatusConflict {
+		t.Errorf("deleting the installment's expense: status %d, want 409", code)
+	}
+}
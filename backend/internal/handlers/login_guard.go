@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// checkDummyPassword spends as long as checking a real password, so a sign-in with an
+// unknown email takes as long as one with a wrong password
+func checkDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// loginRetryAfter returns how long a sign-in for an email from an IP address has to wait,
+// or zero when it may go ahead. The wait doubles with every failure past the backoff
+// threshold and becomes a lockout at the lockout threshold.
+//
+// An attempt allowed to go ahead is counted as failed right away, in the same transaction
+// as the check; call uncountLoginAttempt once its password or code turns out right.
+func (h *AuthHandler) loginRetryAfter(email, ip string) (time.Duration, error) {
+	now := time.Now()
+	emailKey, ipKey := "email:"+email, "ip:"+ip
+
+	var wait time.Duration
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&[]models.LoginThrottle{{Key: emailKey}, {Key: ipKey}}).Error; err != nil {
+			return err
+		}
+		var throttles []models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("throttle_key IN ?", []string{emailKey, ipKey}).
+			Order("throttle_key").Find(&throttles).Error; err != nil {
+			return err
+		}
+
+		for i := range throttles {
+			throttle := &throttles[i]
+			// Failures are forgotten once a whole window passes without one
+			if throttle.LastFailureAt == nil || now.Sub(*throttle.LastFailureAt) > h.config.LoginFailureWindow {
+				throttle.Failures = 0
+			}
+			var keyWait time.Duration
+			if throttle.Key == emailKey {
+				keyWait = h.failureWait(throttle.Failures, throttle.LastFailureAt, h.config.LoginBackoffAfter, h.config.LoginLockoutAfter, now)
+			} else {
+				keyWait = h.failureWait(throttle.Failures, throttle.LastFailureAt, h.config.LoginLockoutAfter, h.config.LoginIPLockoutAfter, now)
+			}
+			if keyWait > wait {
+				wait = keyWait
+			}
+		}
+		if wait > 0 {
+			return nil
+		}
+
+		for _, throttle := range throttles {
+			if err := tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", throttle.Key).Updates(map[string]interface{}{
+				"failures":        throttle.Failures + 1,
+				"last_failure_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return wait, err
+}
+
+// uncountLoginAttempt takes back the failure loginRetryAfter counted for an attempt whose
+// password or code was right
+func uncountLoginAttempt(email, ip string) {
+	if err := database.GetDB().Model(&models.LoginThrottle{}).
+		Where("throttle_key IN ? AND failures > 0", []string{"email:" + email, "ip:" + ip}).
+		Update("failures", gorm.Expr("failures - 1")).Error; err != nil {
+		log.Printf("Failed to update sign-in throttling: %v", err)
+	}
+}
+
+// clearLoginFailures forgets the failures of an email after a successful sign-in. Those of
+// the IP address are kept, or an attacker with one account could keep resetting their own.
+func clearLoginFailures(email string) {
+	if err := database.GetDB().Model(&models.LoginThrottle{}).
+		Where("throttle_key = ?", "email:"+email).
+		Update("failures", 0).Error; err != nil {
+		log.Printf("Failed to update sign-in throttling: %v", err)
+	}
+}
+
+// checkCurrentPassword checks the password of a signed-in user, throttled with the user's
+// sign-ins so a stolen session cannot be used to guess it. It responds and returns false
+// when the request must stop; on true, call uncountLoginAttempt once every check passed.
+func (h *AuthHandler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, user *models.User, password, wrongMessage string) bool {
+	wait, err := h.loginRetryAfter(user.Email, middleware.ClientIP(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check password")
+		return false
+	}
+	if wait > 0 {
+		recordLoginAttempt(r, user.Email, &user.ID, models.LoginThrottled)
+		respondThrottled(w, wait)
+		return false
+	}
+	if !user.CheckPassword(password) {
+		recordLoginAttempt(r, user.Email, &user.ID, models.LoginInvalidCredentials)
+		respondWithError(w, http.StatusUnauthorized, wrongMessage)
+		return false
+	}
+	return true
+}
+
+// failureWait returns how long after its last failure a key with a number of failures
+// is blocked, less the time already passed
+func (h *AuthHandler) failureWait(failures int, last *time.Time, backoffAfter, lockoutAfter int, now time.Time) time.Duration {
+	if last == nil || failures < backoffAfter {
+		return 0
+	}
+
+	delay := h.config.LoginLockoutDuration
+	if failures < lockoutAfter {
+		exponent := float64(failures - backoffAfter)
+		backoff := time.Duration(float64(h.config.LoginBackoffBase) * math.Pow(2, exponent))
+		if backoff > 0 && backoff < delay {
+			delay = backoff
+		}
+	}
+
+	if remaining := last.Add(delay).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// recordLoginAttempt adds an attempt to the audit trail that throttling reads
+func recordLoginAttempt(r *http.Request, email string, userID *uint, outcome string) {
+	if err := database.GetDB().Create(&models.LoginAttempt{
+		Email:     email,
+		UserID:    userID,
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: middleware.ClientUserAgent(r),
+		Outcome:   outcome,
+	}).Error; err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+// respondThrottled tells the client to retry a sign-in later, rounded up to whole seconds
+func respondThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed sign-in attempts, try again later")
+}
+
+// GetLoginAttempts returns the recent sign-in attempts on the authenticated user's account,
+// newest first. Use ?failed=true for only the failed and throttled ones.
+func (h *AuthHandler) GetLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Throttled attempts and those before the account existed have only the email
+	query := database.GetDB().Where("(user_id = ? OR (user_id IS NULL AND email = ?))", user.ID, user.Email)
+	if r.URL.Query().Get("failed") == "true" {
+		query = query.Where("outcome NOT IN ?", []string{models.LoginSucceeded, models.LoginMFARequired})
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("created_at DESC, id DESC").Limit(100).Find(&attempts).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch login attempts")
+		return
+	}
+	if attempts == nil {
+		attempts = []models.LoginAttempt{}
+	}
+
+	respondWithJSON(w, http.StatusOK, attempts)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/config"
+	"github.com/abdelrahman/expense-manager/internal/mail"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+const guardTestPassword = "correct horse battery staple"
+
+// newGuardTest returns a handler that locks an email out at its 5th failure, without backoff before
+func newGuardTest(t *testing.T) (*gorm.DB, *AuthHandler, models.User) {
+	t.Helper()
+	utils.InitJWT("test-secret", 0)
+	db := testutil.OpenDB(t)
+	handler := NewAuthHandler(&config.Config{
+		RefreshTokenTTL:      time.Hour,
+		LoginFailureWindow:   time.Hour,
+		LoginBackoffAfter:    5,
+		LoginBackoffBase:     time.Second,
+		LoginLockoutAfter:    5,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginIPLockoutAfter:  50,
+	}, mail.LogSender{}, nil)
+
+	user := models.User{Email: "user@example.com", Name: "User"}
+	if err := user.HashPassword(guardTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return db, handler, user
+}
+
+func login(t *testing.T, handler *AuthHandler, password string) int {
+	t.Helper()
+	return testutil.Serve(handler.Login, testutil.Request(t, http.MethodPost, "/api/auth/login",
+		LoginRequest{Email: "user@example.com", Password: password})).Code
+}
+
+func TestParallelWrongPasswordsCannotPassTheLockout(t *testing.T) {
+	_, handler, _ := newGuardTest(t)
+
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := login(t, handler, "wrong password")
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusUnauthorized] != 5 || codes[http.StatusTooManyRequests] != 15 {
+		t.Errorf("responses = %v, want 5 checked passwords and 15 throttled", codes)
+	}
+	if code := login(t, handler, guardTestPassword); code != http.StatusTooManyRequests {
+		t.Errorf("right password on a locked email: status %d, want 429", code)
+	}
+}
+
+func TestRightPasswordClearsTheEmailButNotTheIP(t *testing.T) {
+	db, handler, _ := newGuardTest(t)
+
+	for i := 0; i < 4; i++ {
+		if code := login(t, handler, "wrong password"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", i+1, code)
+		}
+	}
+	if code := login(t, handler, guardTestPassword); code != http.StatusOK {
+		t.Fatalf("right password: status %d, want 200", code)
+	}
+
+	var email, ip models.LoginThrottle
+	db.First(&email, "throttle_key = ?", "email:user@example.com")
+	db.First(&ip, "throttle_key = ?", "ip:192.0.2.1")
+	if email.Failures != 0 || ip.Failures != 4 {
+		t.Errorf("failures: email %d, IP %d, want 0 and 4", email.Failures, ip.Failures)
+	}
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	_, handler, user := newGuardTest(t)
+	changePassword := func(current string) int {
+		r := testutil.Request(t, http.MethodPut, "/api/auth/password",
+			ChangePasswordRequest{CurrentPassword: current, NewPassword: "another long password"})
+		return testutil.Serve(handler.ChangePassword, testutil.AsUser(r, user.ID)).Code
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := changePassword("wrong password"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want 401", i+1, code)
+		}
+	}
+	if code := changePassword(guardTestPassword); code != http.StatusTooManyRequests {
+		t.Errorf("after 5 wrong passwords: status %d, want 429", code)
+	}
+	if code := login(t, handler, guardTestPassword); code != http.StatusTooManyRequests {
+		t.Errorf("signing in after 5 wrong current passwords: status %d, want 429", code)
+	}
+}
+
+func TestGetLoginAttemptsListsNoneAsEmptyArray(t *testing.T) {
+	_, handler, user := newGuardTest(t)
+
+	w := testutil.Serve(handler.GetLoginAttempts,
+		testutil.AsUser(testutil.Request(t, http.MethodGet, "/api/auth/login-attempts", nil), user.ID))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("status %d, body %q, want 200 and []", w.Code, w.Body.String())
+	}
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/hijri"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/gorilla/mux"
@@ -38,6 +41,11 @@ func (h *MonthlyPlanHandler) GetMonthlyPlans(w http.ResponseWriter, r *http.Requ
 		query = query.Where("month = ?", month)
 	}
 
+	// Filter by calendar
+	if calendar := r.URL.Query().Get("calendar"); calendar != "" {
+		query = query.Where("calendar = ?", calendar)
+	}
+
 	if err := query.Order("year DESC, month DESC").Find(&plans).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
 		return
@@ -72,6 +80,15 @@ func (h *MonthlyPlanHandler) GetMonthlyPlan(w http.ResponseWriter, r *http.Reque
 
 // GetMonthlyPlanByYearMonth returns plans for a specific year and month for the authenticated user
 func (h *MonthlyPlanHandler) GetMonthlyPlanByYearMonth(w http.ResponseWriter, r *http.Request) {
+	h.getPlansByYearMonth(w, r, models.CalendarGregorian)
+}
+
+// GetHijriMonthlyPlans returns plans for a specific Hijri year and month for the authenticated user
+func (h *MonthlyPlanHandler) GetHijriMonthlyPlans(w http.ResponseWriter, r *http.Request) {
+	h.getPlansByYearMonth(w, r, models.CalendarHijri)
+}
+
+func (h *MonthlyPlanHandler) getPlansByYearMonth(w http.ResponseWriter, r *http.Request, calendar string) {
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
@@ -93,7 +110,7 @@ func (h *MonthlyPlanHandler) GetMonthlyPlanByYearMonth(w http.ResponseWriter, r
 
 	var plans []models.MonthlyPlan
 	if err := database.GetDB().Preload("Category").
-		Where("year = ? AND month = ? AND user_id = ?", year, month, userID).
+		Where("calendar = ? AND year = ? AND month = ? AND user_id = ?", calendar, year, month, userID).
 		Find(&plans).Error; err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
 		return
@@ -102,6 +119,91 @@ func (h *MonthlyPlanHandler) GetMonthlyPlanByYearMonth(w http.ResponseWriter, r
 	respondWithJSON(w, http.StatusOK, plans)
 }
 
+// PeriodPlan is a monthly plan with the part of it budgeted to a budget period
+type PeriodPlan struct {
+	models.MonthlyPlan
+	PeriodAmount float64 `json:"period_amount"`
+}
+
+// PeriodPlans are the plans a budget period is budgeted against
+type PeriodPlans struct {
+	Period       string       `json:"period"` // calendar, or the budget period type
+	StartDate    string       `json:"start_date"`
+	EndDate      string       `json:"end_date"`
+	Year         int          `json:"year,omitempty"`
+	Month        int          `json:"month,omitempty"`
+	TotalPlanned float64      `json:"total_planned"`
+	Plans        []PeriodPlan `json:"plans"`
+}
+
+// GetPeriodPlans returns the plans of the budget period containing ?date (default today).
+// A monthly period uses all of its month's plans, so with a start day of 27 the 28th of
+// January gets February's plans; weekly and bi-weekly periods get the share of each
+// overlapping month's plans matching the days they cover. Use ?period=calendar for the
+// calendar month instead.
+func (h *MonthlyPlanHandler) GetPeriodPlans(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	day := today()
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	settings := loadBudgetPeriod(userID)
+	period, kind := settings.Containing(day), periodKind(settings)
+	if r.URL.Query().Get("period") == periodCalendar {
+		period, kind = models.CalendarMonth(day.Year(), int(day.Month())), periodCalendar
+	}
+
+	// Monthly periods carry the month whose plans they use, weekly ones overlap one or two months
+	months := overlappingMonths(period)
+	if period.Month != 0 {
+		months = []planMonth{{year: period.Year, month: period.Month}}
+	}
+	pairs := make([][]interface{}, 0, len(months))
+	for _, month := range months {
+		pairs = append(pairs, []interface{}{month.year, month.month})
+	}
+
+	var plans []models.MonthlyPlan
+	if err := database.GetDB().Preload("Category").
+		Where("user_id = ? AND calendar = ? AND (year, month) IN ?", userID, models.CalendarGregorian, pairs).
+		Order("year ASC, month ASC, id ASC").
+		Find(&plans).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
+		return
+	}
+
+	result := PeriodPlans{
+		Period:    kind,
+		StartDate: period.Start.Format("2006-01-02"),
+		EndDate:   period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		Year:      period.Year,
+		Month:     period.Month,
+		Plans:     make([]PeriodPlan, 0, len(plans)),
+	}
+	for _, plan := range plans {
+		amount := plan.PlannedAmount
+		if period.Month == 0 {
+			amount = roundAmount(amount * monthShare(period, models.CalendarMonth(plan.Year, plan.Month)))
+		}
+		result.TotalPlanned += amount
+		result.Plans = append(result.Plans, PeriodPlan{MonthlyPlan: plan, PeriodAmount: amount})
+	}
+	result.TotalPlanned = roundAmount(result.TotalPlanned)
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
 // CreateMonthlyPlan creates a new monthly plan for the authenticated user
 func (h *MonthlyPlanHandler) CreateMonthlyPlan(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
@@ -121,6 +223,14 @@ func (h *MonthlyPlanHandler) CreateMonthlyPlan(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if plan.Calendar == "" {
+		plan.Calendar = models.CalendarGregorian
+	}
+	if message := validatePlanYear(plan.Calendar, plan.Year); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
 	if plan.PlannedAmount <= 0 {
 		respondWithError(w, http.StatusBadRequest, "Planned amount must be greater than 0")
 		return
@@ -172,6 +282,10 @@ func (h *MonthlyPlanHandler) UpdateMonthlyPlan(w http.ResponseWriter, r *http.Re
 		plan.Month = updateData.Month
 	}
 	if updateData.Year > 0 {
+		if message := validatePlanYear(plan.Calendar, updateData.Year); message != "" {
+			respondWithError(w, http.StatusBadRequest, message)
+			return
+		}
 		plan.Year = updateData.Year
 	}
 	if updateData.PlannedAmount > 0 {
@@ -214,3 +328,20 @@ func (h *MonthlyPlanHandler) DeleteMonthlyPlan(w http.ResponseWriter, r *http.Re
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Monthly plan deleted successfully"})
 }
+
+// validatePlanYear checks that a plan year belongs to the plan's calendar, returning an error message otherwise
+func validatePlanYear(calendar string, year int) string {
+	switch calendar {
+	case models.CalendarGregorian:
+		if year < 1 || year > 9999 {
+			return "Year must be between 1 and 9999"
+		}
+	case models.CalendarHijri:
+		if year < hijri.MinYear || year > hijri.MaxYear {
+			return fmt.Sprintf("Hijri year must be between %d and %d", hijri.MinYear, hijri.MaxYear)
+		}
+	default:
+		return "Calendar must be gregorian or hijri"
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+)
+
+type NotificationHandler struct{}
+
+func NewNotificationHandler() *NotificationHandler {
+	return &NotificationHandler{}
+}
+
+// GetNotifications returns the notifications of the authenticated user, newest first
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := database.GetDB().Where("user_id = ?", userID)
+
+	// Filter unread notifications
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(100).Find(&notifications).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+
+	respondWithJSON(w, http.StatusOK, notifications)
+}
+
+// MarkNotificationRead marks a notification of the authenticated user as read
+func (h *NotificationHandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	var notification models.Notification
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+		if err := database.GetDB().Save(&notification).Error; err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update notification")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, notification)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the authenticated user as read
+func (h *NotificationHandler) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := database.GetDB().Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now()).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Notifications marked as read"})
+}
+
+// DeleteNotification deletes a notification of the authenticated user
+func (h *NotificationHandler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.Notification{}).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete notification")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Notification deleted successfully"})
+}
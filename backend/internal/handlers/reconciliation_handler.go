@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReconciliationHandler struct{}
+
+func NewReconciliationHandler() *ReconciliationHandler {
+	return &ReconciliationHandler{}
+}
+
+// ReconciliationSummary is a reconciliation with its cleared balance and candidate transactions
+type ReconciliationSummary struct {
+	models.BankAccountReconciliation
+	ClearedBalance float64                         `json:"cleared_balance"`
+	Difference     float64                         `json:"difference"`
+	Transactions   []models.BankAccountTransaction `json:"transactions"`
+}
+
+type startReconciliationRequest struct {
+	StatementDate    string  `json:"statement_date"` // YYYY-MM-DD
+	StatementBalance float64 `json:"statement_balance"`
+}
+
+type clearTransactionsRequest struct {
+	TransactionIDs []uint `json:"transaction_ids"`
+	Cleared        bool   `json:"cleared"`
+}
+
+var (
+	errReconciliationNotInProgress = errors.New("Reconciliation is already completed")
+	errReconciliationInProgress    = errors.New("A reconciliation is already in progress for this account")
+	errStatementNotAfterLast       = errors.New("Statement date must be after the last reconciled statement")
+)
+
+// GetReconciliations returns the reconciliation history of a bank account
+func (h *ReconciliationHandler) GetReconciliations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid bank account ID")
+		return
+	}
+
+	var account models.BankAccount
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Bank account not found")
+		return
+	}
+
+	var reconciliations []models.BankAccountReconciliation
+	if err := database.GetDB().
+		Where("bank_account_id = ? AND user_id = ?", account.ID, userID).
+		Order("statement_date DESC, id DESC").
+		Find(&reconciliations).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch reconciliations")
+		return
+	}
+
+	if reconciliations == nil {
+		reconciliations = []models.BankAccountReconciliation{}
+	}
+
+	respondWithJSON(w, http.StatusOK, reconciliations)
+}
+
+// StartReconciliation opens a reconciliation session against a bank statement
+func (h *ReconciliationHandler) StartReconciliation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid bank account ID")
+		return
+	}
+
+	var account models.BankAccount
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Bank account not found")
+		return
+	}
+
+	var req startReconciliationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	statementDate, err := time.ParseInLocation("2006-01-02", req.StatementDate, time.Local)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid statement date format. Use YYYY-MM-DD")
+		return
+	}
+
+	reconciliation := models.BankAccountReconciliation{
+		UserID:           userID,
+		BankAccountID:    account.ID,
+		StatementDate:    statementDate,
+		StatementBalance: req.StatementBalance,
+		Status:           models.ReconciliationStatusInProgress,
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Lock the account so two requests cannot both find no open session and open one each
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, account.ID).Error; err != nil {
+			return err
+		}
+
+		var open int64
+		if err := tx.Model(&models.BankAccountReconciliation{}).
+			Where("bank_account_id = ? AND status = ?", account.ID, models.ReconciliationStatusInProgress).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return errReconciliationInProgress
+		}
+
+		var last models.BankAccountReconciliation
+		err := tx.Where("bank_account_id = ? AND status = ?", account.ID, models.ReconciliationStatusCompleted).
+			Order("statement_date DESC").
+			First(&last).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && !statementDate.After(last.StatementDate) {
+			return errStatementNotAfterLast
+		}
+
+		return tx.Create(&reconciliation).Error
+	})
+	if errors.Is(err, errReconciliationInProgress) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, errStatementNotAfterLast) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start reconciliation")
+		return
+	}
+
+	summary, err := buildReconciliationSummary(database.GetDB(), &account, &reconciliation)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load reconciliation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, summary)
+}
+
+// GetReconciliation returns a reconciliation with its cleared balance and difference
+func (h *ReconciliationHandler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	account, reconciliation, status, message := loadReconciliation(mux.Vars(r), userID)
+	if status != 0 {
+		respondWithError(w, status, message)
+		return
+	}
+
+	summary, err := buildReconciliationSummary(database.GetDB(), account, reconciliation)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load reconciliation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// UpdateReconciliationTransactions ticks transactions as cleared or uncleared
+func (h *ReconciliationHandler) UpdateReconciliationTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	account, reconciliation, status, message := loadReconciliation(mux.Vars(r), userID)
+	if status != 0 {
+		respondWithError(w, status, message)
+		return
+	}
+
+	if reconciliation.Status != models.ReconciliationStatusInProgress {
+		respondWithError(w, http.StatusConflict, errReconciliationNotInProgress.Error())
+		return
+	}
+
+	var req clearTransactionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(req.TransactionIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one transaction is required")
+		return
+	}
+
+	unique := make(map[uint]bool, len(req.TransactionIDs))
+	for _, transactionID := range req.TransactionIDs {
+		unique[transactionID] = true
+	}
+
+	// Only unlocked transactions up to the statement date can be ticked
+	eligible := database.GetDB().Model(&models.BankAccountTransaction{}).
+		Where("bank_account_id = ? AND user_id = ? AND id IN ? AND reconciliation_id IS NULL AND value_date <= ?",
+			account.ID, userID, req.TransactionIDs, reconciliation.StatementDate)
+
+	var count int64
+	if err := eligible.Count(&count).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update transactions")
+		return
+	}
+	if count != int64(len(unique)) {
+		respondWithError(w, http.StatusBadRequest, "Some transactions cannot be cleared in this reconciliation")
+		return
+	}
+
+	if err := database.GetDB().Model(&models.BankAccountTransaction{}).
+		Where("bank_account_id = ? AND user_id = ? AND id IN ? AND reconciliation_id IS NULL", account.ID, userID, req.TransactionIDs).
+		Update("cleared", req.Cleared).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update transactions")
+		return
+	}
+
+	summary, err := buildReconciliationSummary(database.GetDB(), account, reconciliation)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load reconciliation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// CompleteReconciliation locks the cleared transactions and records an adjustment for any residual difference
+func (h *ReconciliationHandler) CompleteReconciliation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	account, reconciliation, status, message := loadReconciliation(mux.Vars(r), userID)
+	if status != 0 {
+		respondWithError(w, status, message)
+		return
+	}
+
+	var summary *ReconciliationSummary
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Lock both rows so a concurrent completion or transaction cannot change the balance
+		// between computing the difference and locking the cleared transactions
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(reconciliation, reconciliation.ID).Error; err != nil {
+			return err
+		}
+		if reconciliation.Status != models.ReconciliationStatusInProgress {
+			return errReconciliationNotInProgress
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(account, account.ID).Error; err != nil {
+			return err
+		}
+
+		clearedBalance, err := reconciliationClearedBalance(tx, account)
+		if err != nil {
+			return err
+		}
+
+		difference := math.Round((reconciliation.StatementBalance-clearedBalance)*100) / 100
+		if difference != 0 {
+			adjustment := models.BankAccountTransaction{
+				UserID:        userID,
+				BankAccountID: account.ID,
+				Type:          "credit",
+				Amount:        difference,
+				Description:   "Reconciliation adjustment",
+				ValueDate:     reconciliation.StatementDate,
+				Cleared:       true,
+			}
+			if difference < 0 {
+				adjustment.Type = "debit"
+				adjustment.Amount = -difference
+			}
+			if err := postBankAccountTransaction(tx, account, &adjustment); err != nil {
+				return err
+			}
+			reconciliation.AdjustmentTransactionID = &adjustment.ID
+		}
+
+		locked := tx.Model(&models.BankAccountTransaction{}).
+			Where("bank_account_id = ? AND cleared = ? AND reconciliation_id IS NULL", account.ID, true).
+			Update("reconciliation_id", reconciliation.ID)
+		if locked.Error != nil {
+			return locked.Error
+		}
+
+		completedAt := time.Now()
+		reconciliation.Status = models.ReconciliationStatusCompleted
+		reconciliation.AdjustmentAmount = difference
+		reconciliation.ClearedCount = locked.RowsAffected
+		reconciliation.CompletedAt = &completedAt
+		if err := tx.Save(reconciliation).Error; err != nil {
+			return err
+		}
+
+		summary, err = buildReconciliationSummary(tx, account, reconciliation)
+		return err
+	}); err != nil {
+		if errors.Is(err, errReconciliationNotInProgress) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to complete reconciliation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// CancelReconciliation discards an in-progress reconciliation and unticks its transactions
+func (h *ReconciliationHandler) CancelReconciliation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	account, reconciliation, status, message := loadReconciliation(mux.Vars(r), userID)
+	if status != 0 {
+		respondWithError(w, status, message)
+		return
+	}
+
+	if reconciliation.Status != models.ReconciliationStatusInProgress {
+		respondWithError(w, http.StatusConflict, "Completed reconciliations cannot be cancelled")
+		return
+	}
+
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.BankAccountTransaction{}).
+			Where("bank_account_id = ? AND cleared = ? AND reconciliation_id IS NULL", account.ID, true).
+			Update("cleared", false).Error; err != nil {
+			return err
+		}
+		return tx.Delete(reconciliation).Error
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel reconciliation")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Reconciliation cancelled successfully"})
+}
+
+// loadReconciliation fetches the bank account and reconciliation named in the route,
+// returning a non-zero status and message when either is missing
+func loadReconciliation(vars map[string]string, userID uint) (*models.BankAccount, *models.BankAccountReconciliation, int, string) {
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, "Invalid bank account ID"
+	}
+
+	reconciliationID, err := strconv.ParseUint(vars["reconciliationId"], 10, 32)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, "Invalid reconciliation ID"
+	}
+
+	var account models.BankAccount
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&account).Error; err != nil {
+		return nil, nil, http.StatusNotFound, "Bank account not found"
+	}
+
+	var reconciliation models.BankAccountReconciliation
+	if err := database.GetDB().
+		Where("id = ? AND bank_account_id = ? AND user_id = ?", reconciliationID, account.ID, userID).
+		First(&reconciliation).Error; err != nil {
+		return nil, nil, http.StatusNotFound, "Reconciliation not found"
+	}
+
+	return &account, &reconciliation, 0, ""
+}
+
+// reconciliationClearedBalance returns the balance the account would have if only cleared
+// transactions had happened. The opening balance is whatever the current balance does not
+// explain through recorded transactions.
+func reconciliationClearedBalance(db *gorm.DB, account *models.BankAccount) (float64, error) {
+	var totals struct {
+		Total   float64
+		Cleared float64
+	}
+	if err := db.Model(&models.BankAccountTransaction{}).
+		Select("COALESCE(SUM("+models.SignedAmountSQL+"), 0) AS total, "+
+			"COALESCE(SUM(CASE WHEN cleared THEN "+models.SignedAmountSQL+" ELSE 0 END), 0) AS cleared").
+		Where("bank_account_id = ?", account.ID).
+		Scan(&totals).Error; err != nil {
+		return 0, err
+	}
+
+	return math.Round((account.Balance-totals.Total+totals.Cleared)*100) / 100, nil
+}
+
+// buildReconciliationSummary computes the cleared balance and lists the transactions
+// that belong to the reconciliation
+func buildReconciliationSummary(db *gorm.DB, account *models.BankAccount, reconciliation *models.BankAccountReconciliation) (*ReconciliationSummary, error) {
+	summary := &ReconciliationSummary{BankAccountReconciliation: *reconciliation}
+
+	query := db.Where("bank_account_id = ?", account.ID)
+	if reconciliation.Status == models.ReconciliationStatusCompleted {
+		summary.ClearedBalance = reconciliation.StatementBalance
+		query = query.Where("reconciliation_id = ?", reconciliation.ID)
+	} else {
+		clearedBalance, err := reconciliationClearedBalance(db, account)
+		if err != nil {
+			return nil, err
+		}
+		summary.ClearedBalance = clearedBalance
+		summary.Difference = math.Round((reconciliation.StatementBalance-clearedBalance)*100) / 100
+		query = query.Where("reconciliation_id IS NULL AND value_date <= ?", reconciliation.StatementDate)
+	}
+
+	if err := query.Order("value_date ASC, id ASC").Find(&summary.Transactions).Error; err != nil {
+		return nil, err
+	}
+	if summary.Transactions == nil {
+		summary.Transactions = []models.BankAccountTransaction{}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func startReconciliation(t *testing.T, account models.BankAccount, req startReconciliationRequest) (int, ReconciliationSummary) {
+	t.Helper()
+	r := testutil.WithVars(testutil.Request(t, http.MethodPost, "/api/bank-accounts/1/reconciliations", req),
+		map[string]string{"id": fmt.Sprint(account.ID)})
+	w := testutil.Serve(NewReconciliationHandler().StartReconciliation, testutil.AsUser(r, 1))
+	var summary ReconciliationSummary
+	if w.Code == http.StatusCreated {
+		testutil.DecodeJSON(t, w, &summary)
+	}
+	return w.Code, summary
+}
+
+func TestParallelStartsOpenOneReconciliation(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{Balance: 100})
+
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := startReconciliation(t, account, startReconciliationRequest{StatementDate: "2026-09-30", StatementBalance: 100})
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[http.StatusCreated] != 1 || codes[http.StatusConflict] != 9 {
+		t.Errorf("responses = %v, want 1 started and 9 conflicts", codes)
+	}
+	var open int64
+	db.Model(&models.BankAccountReconciliation{}).Where("bank_account_id = ?", account.ID).Count(&open)
+	if open != 1 {
+		t.Errorf("%d reconciliations open, want 1", open)
+	}
+}
+
+func TestCompleteReconciliationLocksClearedAndAdjustsTheDifference(t *testing.T) {
+	db := testutil.OpenDB(t)
+	account := seedAccount(t, db, models.BankAccount{Balance: 100})
+	postTransaction(t, account, bankAccountTransactionRequest{Amount: 50, Type: "credit", ValueDate: "2026-09-01"})
+	postTransaction(t, account, bankAccountTransactionRequest{Amount: 20, Type: "debit", ValueDate: "2026-09-05"})
+	postTransaction(t, account, bankAccountTransactionRequest{Amount: 5, Type: "debit", ValueDate: "2026-10-02"}) // After the statement
+
+	code, started := startReconciliation(t, account, startReconciliationRequest{StatementDate: "2026-09-30", StatementBalance: 128})
+	if code != http.StatusCreated {
+		t.Fatalf("starting: status %d", code)
+	}
+	// The opening balance is 100, and the transaction after the statement date is not listed
+	if len(started.Transactions) != 2 || started.ClearedBalance != 100 || started.Difference != 28 {
+		t.Fatalf("started with %d transactions, cleared %v, difference %v, want 2, 100 and 28",
+			len(started.Transactions), started.ClearedBalance, started.Difference)
+	}
+
+	vars := map[string]string{"id": fmt.Sprint(account.ID), "reconciliationId": fmt.Sprint(started.ID)}
+	handler := NewReconciliationHandler()
+	ids := []uint{started.Transactions[0].ID, started.Transactions[1].ID}
+	r := testutil.WithVars(testutil.Request(t, http.MethodPut, "/", clearTransactionsRequest{TransactionIDs: ids, Cleared: true}), vars)
+	var cleared ReconciliationSummary
+	testutil.DecodeJSON(t, testutil.Serve(handler.UpdateReconciliationTransactions, testutil.AsUser(r, 1)), &cleared)
+	if cleared.ClearedBalance != 130 || cleared.Difference != -2 {
+		t.Errorf("after clearing: cleared %v, difference %v, want 130 and -2", cleared.ClearedBalance, cleared.Difference)
+	}
+
+	r = testutil.WithVars(testutil.Request(t, http.MethodPost, "/", nil), vars)
+	w := testutil.Serve(handler.CompleteReconciliation, testutil.AsUser(r, 1))
+	var completed ReconciliationSummary
+	testutil.DecodeJSON(t, w, &completed)
+	if completed.Status != models.ReconciliationStatusCompleted || completed.AdjustmentAmount != -2 || completed.ClearedCount != 3 {
+		t.Errorf("completed %s with adjustment %v and %d cleared, want completed, -2 and 3: %s",
+			completed.Status, completed.AdjustmentAmount, completed.ClearedCount, w.Body.String())
+	}
+
+	// The adjustment is cleared and locked along with the ticked transactions
+	var stored models.BankAccount
+	db.First(&stored, account.ID)
+	var locked int64
+	db.Model(&models.BankAccountTransaction{}).Where("reconciliation_id = ?", started.ID).Count(&locked)
+	if stored.Balance != 123 || locked != 3 {
+		t.Errorf("balance %v with %d locked transactions, want 123 and 3", stored.Balance, locked)
+	}
+
+	if code, _ := startReconciliation(t, account, startReconciliationRequest{StatementDate: "2026-09-15"}); code != http.StatusBadRequest {
+		t.Errorf("statement before the last reconciled one: status %d, want 400", code)
+	}
+}
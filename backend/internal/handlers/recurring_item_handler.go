@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/gorilla/mux"
+)
+
+type RecurringItemHandler struct{}
+
+func NewRecurringItemHandler() *RecurringItemHandler {
+	return &RecurringItemHandler{}
+}
+
+type recurringItemRequest struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Amount        float64 `json:"amount"`
+	Frequency     string  `json:"frequency"`
+	StartDate     string  `json:"start_date"` // YYYY-MM-DD
+	EndDate       *string `json:"end_date"`   // YYYY-MM-DD, empty string clears it
+	BankAccountID *uint   `json:"bank_account_id"`
+	CategoryID    *uint   `json:"category_id"`
+	IsActive      *bool   `json:"is_active"`
+	Notes         *string `json:"notes"`
+}
+
+// recurringFrequencies lists the schedules a recurring item can follow
+var recurringFrequencies = map[string]bool{
+	"weekly":   true,
+	"biweekly": true,
+	"monthly":  true,
+	"yearly":   true,
+}
+
+// GetRecurringItems returns all recurring incomes and expenses of the authenticated user
+func (h *RecurringItemHandler) GetRecurringItems(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := database.GetDB().Preload("Category").Where("recurring_items.user_id = ?", userID)
+
+	// Filter by type
+	if itemType := r.URL.Query().Get("type"); itemType != "" {
+		query = query.Where("type = ?", itemType)
+	}
+
+	var items []models.RecurringItem
+	if err := query.Order("start_date ASC").Find(&items).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch recurring items")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+// CreateRecurringItem creates a recurring income or expense for the authenticated user
+func (h *RecurringItemHandler) CreateRecurringItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req recurringItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	item := models.RecurringItem{
+		UserID:    userID,
+		Frequency: "monthly",
+		StartDate: today(),
+		IsActive:  true,
+	}
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if req.Type == "" {
+		respondWithError(w, http.StatusBadRequest, "Type must be income or expense")
+		return
+	}
+	if req.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be greater than 0")
+		return
+	}
+
+	if message := applyRecurringItemRequest(userID, &item, &req); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	if err := database.GetDB().Create(&item).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create recurring item")
+		return
+	}
+
+	// Reload with category
+	database.GetDB().Preload("Category").First(&item, item.ID)
+
+	respondWithJSON(w, http.StatusCreated, item)
+}
+
+// UpdateRecurringItem updates a recurring item of the authenticated user
+func (h *RecurringItemHandler) UpdateRecurringItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid recurring item ID")
+		return
+	}
+
+	var item models.RecurringItem
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Recurring item not found")
+		return
+	}
+
+	var req recurringItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if message := applyRecurringItemRequest(userID, &item, &req); message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	if err := database.GetDB().Omit("Category").Save(&item).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update recurring item")
+		return
+	}
+
+	// Reload with category
+	database.GetDB().Preload("Category").First(&item, item.ID)
+
+	respondWithJSON(w, http.StatusOK, item)
+}
+
+// DeleteRecurringItem deletes a recurring item of the authenticated user
+func (h *RecurringItemHandler) DeleteRecurringItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid recurring item ID")
+		return
+	}
+
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.RecurringItem{}).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete recurring item")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Recurring item deleted successfully"})
+}
+
+// applyRecurringItemRequest copies the fields set in a request onto a recurring item,
+// returning an error message when a field is invalid
+func applyRecurringItemRequest(userID uint, item *models.RecurringItem, req *recurringItemRequest) string {
+	if req.Name != "" {
+		item.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Type != "" {
+		itemType := strings.ToLower(req.Type)
+		if itemType != models.RecurringIncome && itemType != models.RecurringExpense {
+			return "Type must be income or expense"
+		}
+		item.Type = itemType
+	}
+	if req.Amount < 0 {
+		return "Amount must be greater than 0"
+	}
+	if req.Amount > 0 {
+		item.Amount = req.Amount
+	}
+	if req.Frequency != "" {
+		frequency := strings.ToLower(req.Frequency)
+		if !recurringFrequencies[frequency] {
+			return "Frequency must be weekly, biweekly, monthly or yearly"
+		}
+		item.Frequency = frequency
+	}
+	if req.StartDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+		if err != nil {
+			return "Invalid start date format. Use YYYY-MM-DD"
+		}
+		item.StartDate = parsed
+	}
+	if req.EndDate != nil {
+		item.EndDate = nil
+		if *req.EndDate != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", *req.EndDate, time.Local)
+			if err != nil {
+				return "Invalid end date format. Use YYYY-MM-DD"
+			}
+			item.EndDate = &parsed
+		}
+	}
+	if item.EndDate != nil && item.EndDate.Before(item.StartDate) {
+		return "End date cannot be before the start date"
+	}
+	if req.BankAccountID != nil {
+		var account models.BankAccount
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *req.BankAccountID, userID).First(&account).Error; err != nil {
+			return "Bank account not found"
+		}
+		item.BankAccountID = req.BankAccountID
+	}
+	if req.CategoryID != nil {
+		var category models.Category
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *req.CategoryID, userID).First(&category).Error; err != nil {
+			return "Category not found"
+		}
+		item.CategoryID = req.CategoryID
+	}
+	if req.IsActive != nil {
+		item.IsActive = *req.IsActive
+	}
+	if req.Notes != nil {
+		item.Notes = *req.Notes
+	}
+	return ""
+}
@@ -1,29 +1,46 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/abdelrahman/expense-manager/internal/currency"
 	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/hijri"
 	"github.com/abdelrahman/expense-manager/internal/middleware"
 	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/gorilla/mux"
 )
 
-type ReportHandler struct{}
+type ReportHandler struct {
+	converter *currency.Converter
+}
 
-func NewReportHandler() *ReportHandler {
-	return &ReportHandler{}
+func NewReportHandler(converter *currency.Converter) *ReportHandler {
+	return &ReportHandler{converter: converter}
 }
 
 type MonthlyReport struct {
-	Year          int                      `json:"year"`
-	Month         int                      `json:"month"`
-	TotalExpenses float64                  `json:"total_expenses"`
-	TotalPlanned  float64                  `json:"total_planned"`
-	ExpenseCount  int64                    `json:"expense_count"`
-	ByCategory    []CategoryExpenseSummary `json:"by_category"`
+	Calendar       string                   `json:"calendar"`
+	Year           int                      `json:"year"`
+	Month          int                      `json:"month"`
+	MonthName      string                   `json:"month_name,omitempty"`
+	Period         string                   `json:"period"` // calendar, or the budget period type
+	StartDate      string                   `json:"start_date"`
+	EndDate        string                   `json:"end_date"`
+	StartDateHijri string                   `json:"start_date_hijri,omitempty"`
+	EndDateHijri   string                   `json:"end_date_hijri,omitempty"`
+	TotalExpenses  float64                  `json:"total_expenses"`
+	TotalPlanned   float64                  `json:"total_planned"`
+	ExpenseCount   int64                    `json:"expense_count"`
+	ByCategory     []CategoryExpenseSummary `json:"by_category"`
 }
 
 type CategoryExpenseSummary struct {
@@ -38,11 +55,121 @@ type CategoryExpenseSummary struct {
 type MonthComparison struct {
 	Year          int     `json:"year"`
 	Month         int     `json:"month"`
+	StartDate     string  `json:"start_date"`
+	EndDate       string  `json:"end_date"`
+	TotalExpenses float64 `json:"total_expenses"`
+	ExpenseCount  int64   `json:"expense_count"`
+}
+
+// PeriodComparison compares the spending of a period with an earlier one, per category
+type PeriodComparison struct {
+	Against          string          `json:"against"` // previous, year or custom
+	Current          ComparedPeriod  `json:"current"`
+	Previous         ComparedPeriod  `json:"previous"`
+	Delta            float64         `json:"delta"`
+	DeltaPercent     *float64        `json:"delta_percent"` // nil when nothing was spent in the previous period
+	ByCategory       []CategoryDelta `json:"by_category"`
+	LargestIncreases []CategoryDelta `json:"largest_increases"`
+}
+
+type ComparedPeriod struct {
+	StartDate     string  `json:"start_date"`
+	EndDate       string  `json:"end_date"`
+	Year          int     `json:"year,omitempty"`
+	Month         int     `json:"month,omitempty"`
 	TotalExpenses float64 `json:"total_expenses"`
 	ExpenseCount  int64   `json:"expense_count"`
 }
 
-// GetMonthlyReport returns a comprehensive report for a specific month for the authenticated user
+type CategoryDelta struct {
+	CategoryID     *uint    `json:"category_id"`
+	CategoryName   string   `json:"category_name"`
+	CategoryColor  string   `json:"category_color"`
+	CurrentAmount  float64  `json:"current_amount"`
+	PreviousAmount float64  `json:"previous_amount"`
+	Delta          float64  `json:"delta"`
+	DeltaPercent   *float64 `json:"delta_percent"`
+}
+
+// Periods a comparison can be made against
+const (
+	compareAgainstPrevious = "previous"
+	compareAgainstYear     = "year"
+	compareAgainstCustom   = "custom"
+)
+
+type NetWorthReport struct {
+	Currency string            `json:"currency"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Interval string            `json:"interval"`
+	Points   []NetWorthPoint   `json:"points"`
+	Accounts []NetWorthAccount `json:"accounts"`
+	Loans    []NetWorthLoan    `json:"loans"`
+}
+
+type NetWorthPoint struct {
+	Date        string  `json:"date"`
+	Assets      float64 `json:"assets"`
+	Liabilities float64 `json:"liabilities"`
+	NetWorth    float64 `json:"net_worth"`
+}
+
+type NetWorthLoan struct {
+	LoanID             uint    `json:"loan_id"`
+	Name               string  `json:"name"`
+	RemainingAmount    float64 `json:"remaining_amount"`
+	Currency           string  `json:"currency"`
+	ConvertedRemaining float64 `json:"converted_remaining"`
+}
+
+type NetWorthAccount struct {
+	AccountID        uint    `json:"account_id"`
+	AccountName      string  `json:"account_name"`
+	AccountType      string  `json:"account_type"`
+	IsLiability      bool    `json:"is_liability"`
+	Balance          float64 `json:"balance"`
+	Currency         string  `json:"currency"`
+	ConvertedBalance float64 `json:"converted_balance"`
+}
+
+// VATSummary totals the VAT paid on expenses during a calendar quarter
+type VATSummary struct {
+	Year              int                  `json:"year"`
+	Quarter           int                  `json:"quarter"`
+	StartDate         string               `json:"start_date"`
+	EndDate           string               `json:"end_date"`
+	ExpenseCount      int64                `json:"expense_count"`
+	TotalGross        float64              `json:"total_gross"`
+	TotalNet          float64              `json:"total_net"`
+	TotalTax          float64              `json:"total_tax"`
+	ReclaimableTax    float64              `json:"reclaimable_tax"`
+	NonReclaimableTax float64              `json:"non_reclaimable_tax"`
+	ByCategory        []VATCategorySummary `json:"by_category"`
+	ByRate            []VATRateSummary     `json:"by_rate"`
+}
+
+type VATCategorySummary struct {
+	CategoryID     *uint   `json:"category_id"`
+	CategoryName   string  `json:"category_name"`
+	ExpenseCount   int64   `json:"expense_count"`
+	Gross          float64 `json:"gross"`
+	Tax            float64 `json:"tax"`
+	ReclaimableTax float64 `json:"reclaimable_tax"`
+}
+
+type VATRateSummary struct {
+	Rate           float64 `json:"rate"`
+	ExpenseCount   int64   `json:"expense_count"`
+	Net            float64 `json:"net"`
+	Tax            float64 `json:"tax"`
+	ReclaimableTax float64 `json:"reclaimable_tax"`
+}
+
+const maxNetWorthPoints = 1000
+
+// GetMonthlyReport returns a comprehensive report for a specific month for the authenticated user.
+// The month follows the user's budget period unless ?period=calendar is given.
 func (h *ReportHandler) GetMonthlyReport(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -63,69 +190,333 @@ func (h *ReportHandler) GetMonthlyReport(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get start and end dates for the month
-	startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
+	period, kind := reportMonth(r, userID, year, month)
+	plans, err := loadMonthPlans(userID, models.CalendarGregorian, year, month)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
+		return
+	}
+	report, err := buildPeriodReport(userID, period, plans)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+	report.Calendar = models.CalendarGregorian
+	report.Period = kind
+	if displayCalendar(r, userID) == models.CalendarHijri {
+		report.StartDateHijri = hijriDateString(period.Start)
+		report.EndDateHijri = hijriDateString(period.End.AddDate(0, 0, -1))
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// GetHijriMonthlyReport returns the monthly report for an Umm al-Qura month, compared
+// against the plans made for that Hijri month
+func (h *ReportHandler) GetHijriMonthlyReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil || year < hijri.MinYear || year > hijri.MaxYear {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid Hijri year. Use %d to %d", hijri.MinYear, hijri.MaxYear))
+		return
+	}
+
+	month, err := strconv.Atoi(vars["month"])
+	if err != nil || month < 1 || month > 12 {
+		respondWithError(w, http.StatusBadRequest, "Invalid month")
+		return
+	}
+
+	startDate, endDate, err := hijri.MonthRange(year, month)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	period := models.Period{Start: startDate, End: endDate, Year: year, Month: month}
+	plans, err := loadMonthPlans(userID, models.CalendarHijri, year, month)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
+		return
+	}
+	report, err := buildPeriodReport(userID, period, plans)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+	report.Calendar = models.CalendarHijri
+	report.Period = periodCalendar
+	report.MonthName = hijri.MonthName(month)
+	report.StartDateHijri = hijri.Date{Year: year, Month: month, Day: 1}.String()
+	report.EndDateHijri = hijri.Date{Year: year, Month: month, Day: hijri.DaysInMonth(year, month)}.String()
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// GetPeriodReport returns the report for the budget period containing a date (default today).
+// Weekly and bi-weekly periods are budgeted with the monthly plans prorated by day.
+func (h *ReportHandler) GetPeriodReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	day := today()
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	settings := loadBudgetPeriod(userID)
+	period := settings.Containing(day)
 
-	// Get total expenses
-	var totalExpenses float64
-	var expenseCount int64
-	database.GetDB().Model(&models.DailyExpense{}).
-		Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-		Select("COALESCE(SUM(amount), 0)").
-		Scan(&totalExpenses)
+	var plans periodPlans
+	var err error
+	if settings.IsMonthly() {
+		plans, err = loadMonthPlans(userID, models.CalendarGregorian, period.Year, period.Month)
+	} else {
+		plans, err = proratedPlans(userID, period)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch monthly plans")
+		return
+	}
+
+	report, err := buildPeriodReport(userID, period, plans)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+	report.Calendar = models.CalendarGregorian
+	report.Period = periodKind(settings)
+	if displayCalendar(r, userID) == models.CalendarHijri {
+		report.StartDateHijri = hijriDateString(period.Start)
+		report.EndDateHijri = hijriDateString(period.End.AddDate(0, 0, -1))
+	}
 
-	database.GetDB().Model(&models.DailyExpense{}).
-		Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-		Count(&expenseCount)
+	respondWithJSON(w, http.StatusOK, report)
+}
 
-	// Get total planned
-	var totalPlanned float64
-	database.GetDB().Model(&models.MonthlyPlan{}).
-		Where("user_id = ? AND year = ? AND month = ?", userID, year, month).
-		Select("COALESCE(SUM(planned_amount), 0)").
-		Scan(&totalPlanned)
+// GetSummaryReport aggregates the expenses dated between from and to (inclusive, default the
+// current month up to today) with totals, averages and a breakdown by ?group_by
+func (h *ReportHandler) GetSummaryReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Without from, the range starts on the first of to's month
+	query := r.URL.Query()
+	fromParam, toParam := query.Get("from"), query.Get("to")
+	if toParam == "" {
+		toParam = today().Format("2006-01-02")
+	}
+	if fromParam == "" {
+		to, err := time.ParseInLocation("2006-01-02", toParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to date. Use YYYY-MM-DD")
+			return
+		}
+		fromParam = time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.Local).Format("2006-01-02")
+	}
+	from, to, message := parseDateRange(fromParam, toParam)
+	if message != "" {
+		respondWithError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	groupBy := strings.ToLower(query.Get("group_by"))
+	switch groupBy {
+	case "", groupByDay, groupByWeek, groupByMonth, groupByQuarter, groupByCategory, groupByTag, groupByAccount:
+	default:
+		respondWithError(w, http.StatusBadRequest, "group_by must be day, week, month, quarter, category, tag or account")
+		return
+	}
+
+	summary, err := summarizeExpenses(userID, from, to, groupBy)
+	if errors.Is(err, errTooManyGroups) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// periodPlans holds the planned amounts a period is budgeted against
+type periodPlans struct {
+	total      float64
+	byCategory map[uint]float64
+}
+
+// planMonth identifies the month of a calendar plans are made for
+type planMonth struct {
+	year  int
+	month int
+}
+
+// loadMonthPlans returns the plans made for a month of a calendar
+func loadMonthPlans(userID uint, calendar string, year, month int) (periodPlans, error) {
+	key := planMonth{year: year, month: month}
+	plans, err := loadPlansByMonth(userID, calendar, []planMonth{key})
+	if err != nil {
+		return periodPlans{}, err
+	}
+	return plans[key], nil
+}
+
+// loadPlansByMonth returns the plans made for each of the given months of a calendar with a
+// single query. Every requested month is present, with empty plans when none were made.
+func loadPlansByMonth(userID uint, calendar string, months []planMonth) (map[planMonth]periodPlans, error) {
+	plans := make(map[planMonth]periodPlans, len(months))
+	if len(months) == 0 {
+		return plans, nil
+	}
+
+	pairs := make([][]interface{}, 0, len(months))
+	for _, key := range months {
+		if _, exists := plans[key]; !exists {
+			plans[key] = periodPlans{byCategory: make(map[uint]float64)}
+			pairs = append(pairs, []interface{}{key.year, key.month})
+		}
+	}
+
+	var monthPlans []models.MonthlyPlan
+	if err := database.GetDB().Where("user_id = ? AND calendar = ? AND (year, month) IN ?", userID, calendar, pairs).
+		Find(&monthPlans).Error; err != nil {
+		return nil, err
+	}
+	for _, plan := range monthPlans {
+		key := planMonth{year: plan.Year, month: plan.Month}
+		entry := plans[key]
+		entry.total += plan.PlannedAmount
+		if plan.CategoryID != nil {
+			entry.byCategory[*plan.CategoryID] += plan.PlannedAmount
+		}
+		plans[key] = entry
+	}
+	return plans, nil
+}
+
+// overlappingMonths returns the calendar months the given periods overlap
+func overlappingMonths(periods ...models.Period) []planMonth {
+	var months []planMonth
+	for _, period := range periods {
+		for month := models.CalendarMonth(period.Start.Year(), int(period.Start.Month())); month.Start.Before(period.End); month = models.CalendarMonth(month.End.Year(), int(month.End.Month())) {
+			months = append(months, planMonth{year: month.Year, month: month.Month})
+		}
+	}
+	return months
+}
+
+// proratedPlans budgets a period with the share of each overlapping calendar month's
+// plans matching the share of the month's days the period covers
+func proratedPlans(userID uint, period models.Period) (periodPlans, error) {
+	monthlyPlans, err := loadPlansByMonth(userID, models.CalendarGregorian, overlappingMonths(period))
+	if err != nil {
+		return periodPlans{}, err
+	}
+	return proratePlans(period, monthlyPlans), nil
+}
+
+// proratePlans prorates a period's plans from the already loaded plans of the calendar months it overlaps
+func proratePlans(period models.Period, monthlyPlans map[planMonth]periodPlans) periodPlans {
+	plans := periodPlans{byCategory: make(map[uint]float64)}
+
+	for month := models.CalendarMonth(period.Start.Year(), int(period.Start.Month())); month.Start.Before(period.End); month = models.CalendarMonth(month.End.Year(), int(month.End.Month())) {
+		share := monthShare(period, month)
+		monthPlans := monthlyPlans[planMonth{year: month.Year, month: month.Month}]
+		plans.total += monthPlans.total * share
+		for categoryID, amount := range monthPlans.byCategory {
+			plans.byCategory[categoryID] += amount * share
+		}
+	}
+
+	plans.total = roundAmount(plans.total)
+	for categoryID, amount := range plans.byCategory {
+		plans.byCategory[categoryID] = roundAmount(amount)
+	}
+	return plans
+}
+
+// monthShare returns the share of a calendar month's days a period covers
+func monthShare(period, month models.Period) float64 {
+	from, to := month.Start, month.End
+	if period.Start.After(from) {
+		from = period.Start
+	}
+	if period.End.Before(to) {
+		to = period.End
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return to.Sub(from).Hours() / month.End.Sub(month.Start).Hours()
+}
+
+// buildPeriodReport totals the expenses dated within a period against its plans
+func buildPeriodReport(userID uint, period models.Period, plans periodPlans) (MonthlyReport, error) {
+	totalExpenses, expenseCount, err := expenseTotals(userID, period.Start, period.End)
+	if err != nil {
+		return MonthlyReport{}, err
+	}
 
 	// Get expenses by category
-	var categoryExpenses []CategoryExpenseSummary
-	database.GetDB().Model(&models.DailyExpense{}).
-		Select("category_id, COUNT(*) as expense_count, SUM(amount) as total_amount").
-		Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-		Group("category_id").
-		Scan(&categoryExpenses)
-
-	// Enrich with category details and planned amounts
+	categoryExpenses, err := categoryExpenseSummaries(userID, period)
+	if err != nil {
+		return MonthlyReport{}, err
+	}
 	for i := range categoryExpenses {
 		if categoryExpenses[i].CategoryID != nil {
-			var category models.Category
-			// We only query the category table, we trust the category exists if referenced
-			if err := database.GetDB().First(&category, *categoryExpenses[i].CategoryID).Error; err == nil {
-				categoryExpenses[i].CategoryName = category.Name
-				categoryExpenses[i].CategoryColor = category.Color
-			}
-
-			// Get planned amount for this category
-			var plan models.MonthlyPlan
-			if err := database.GetDB().Where("user_id = ? AND year = ? AND month = ? AND category_id = ?",
-				userID, year, month, *categoryExpenses[i].CategoryID).First(&plan).Error; err == nil {
-				categoryExpenses[i].PlannedAmount = plan.PlannedAmount
-			}
-		} else {
-			categoryExpenses[i].CategoryName = "Uncategorized"
-			categoryExpenses[i].CategoryColor = "#9CA3AF"
+			categoryExpenses[i].PlannedAmount = plans.byCategory[*categoryExpenses[i].CategoryID]
 		}
 	}
 
-	report := MonthlyReport{
-		Year:          year,
-		Month:         month,
-		TotalExpenses: totalExpenses,
-		TotalPlanned:  totalPlanned,
+	return MonthlyReport{
+		Year:          period.Year,
+		Month:         period.Month,
+		StartDate:     period.Start.Format("2006-01-02"),
+		EndDate:       period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+		TotalExpenses: roundAmount(totalExpenses),
+		TotalPlanned:  plans.total,
 		ExpenseCount:  expenseCount,
 		ByCategory:    categoryExpenses,
+	}, nil
+}
+
+// categoryExpenseSummaries groups the expenses of a period by category
+func categoryExpenseSummaries(userID uint, period models.Period) ([]CategoryExpenseSummary, error) {
+	groups, err := groupExpensesByCategory(userID, period.Start, period.End)
+	if err != nil {
+		return nil, err
 	}
 
-	respondWithJSON(w, http.StatusOK, report)
+	categoryExpenses := make([]CategoryExpenseSummary, 0, len(groups))
+	for _, group := range groups {
+		categoryExpenses = append(categoryExpenses, CategoryExpenseSummary{
+			CategoryID:    group.CategoryID,
+			CategoryName:  group.Label,
+			CategoryColor: group.Color,
+			TotalAmount:   group.TotalAmount,
+			ExpenseCount:  group.ExpenseCount,
+		})
+	}
+	return categoryExpenses, nil
 }
 
 // GetCategoryReport returns expenses grouped by category for a specific month for the authenticated user
@@ -149,28 +540,12 @@ func (h *ReportHandler) GetCategoryReport(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
-
-	var categoryExpenses []CategoryExpenseSummary
-	database.GetDB().Model(&models.DailyExpense{}).
-		Select("category_id, COUNT(*) as expense_count, SUM(amount) as total_amount").
-		Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-		Group("category_id").
-		Scan(&categoryExpenses)
+	period, _ := reportMonth(r, userID, year, month)
 
-	// Enrich with category details
-	for i := range categoryExpenses {
-		if categoryExpenses[i].CategoryID != nil {
-			var category models.Category
-			if err := database.GetDB().First(&category, *categoryExpenses[i].CategoryID).Error; err == nil {
-				categoryExpenses[i].CategoryName = category.Name
-				categoryExpenses[i].CategoryColor = category.Color
-			}
-		} else {
-			categoryExpenses[i].CategoryName = "Uncategorized"
-			categoryExpenses[i].CategoryColor = "#9CA3AF"
-		}
+	categoryExpenses, err := categoryExpenseSummaries(userID, period)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, categoryExpenses)
@@ -196,41 +571,217 @@ func (h *ReportHandler) GetMonthComparison(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var comparisons []MonthComparison
-
+	var periods []models.Period
+	seen := make(map[string]bool)
+	monthPeriod := reportMonths(r, userID)
 	for _, monthStr := range monthsParam {
 		t, err := time.Parse("2006-01", monthStr)
-		if err != nil {
+		if err != nil || seen[monthStr] {
 			continue
 		}
+		seen[monthStr] = true
 
-		year := t.Year()
-		month := int(t.Month())
+		period, _ := monthPeriod(t.Year(), int(t.Month()))
+		periods = append(periods, period)
+	}
 
-		startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-		endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
+	comparisons, err := monthComparisons(userID, periods)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
 
-		var totalExpenses float64
-		var expenseCount int64
+	respondWithJSON(w, http.StatusOK, comparisons)
+}
 
-		database.GetDB().Model(&models.DailyExpense{}).
-			Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-			Select("COALESCE(SUM(amount), 0)").
-			Scan(&totalExpenses)
+// GetPeriodComparison compares a period with the one before it (?against=previous), the same
+// period a year earlier (?against=year) or any other range (?against=custom with compare_from
+// and compare_to). The period is from..to when given, otherwise the budget period containing
+// ?date (default today), or its calendar month with ?period=calendar.
+func (h *ReportHandler) GetPeriodComparison(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
 
-		database.GetDB().Model(&models.DailyExpense{}).
-			Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-			Count(&expenseCount)
+	query := r.URL.Query()
+	against := strings.ToLower(query.Get("against"))
+	if against == "" {
+		against = compareAgainstPrevious
+	}
+	if against != compareAgainstPrevious && against != compareAgainstYear && against != compareAgainstCustom {
+		respondWithError(w, http.StatusBadRequest, "against must be previous, year or custom")
+		return
+	}
 
-		comparisons = append(comparisons, MonthComparison{
-			Year:          year,
-			Month:         month,
-			TotalExpenses: totalExpenses,
-			ExpenseCount:  expenseCount,
-		})
+	var current, previous models.Period
+	if query.Get("from") != "" || query.Get("to") != "" {
+		from, to, message := parseDateRange(query.Get("from"), query.Get("to"))
+		if message != "" {
+			respondWithError(w, http.StatusBadRequest, message)
+			return
+		}
+		current = models.Period{Start: from, End: to}
+		switch against {
+		case compareAgainstPrevious:
+			previous = models.Period{Start: from.AddDate(0, 0, -models.DaysBetween(from, to)), End: from}
+		case compareAgainstYear:
+			previous = models.Period{Start: from.AddDate(-1, 0, 0), End: to.AddDate(-1, 0, 0)}
+		}
+	} else {
+		day := today()
+		if dateParam := query.Get("date"); dateParam != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", dateParam, time.Local)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid date format. Use YYYY-MM-DD")
+				return
+			}
+			day = parsed
+		}
+
+		settings := loadBudgetPeriod(userID)
+		if query.Get("period") == periodCalendar {
+			settings = &models.BudgetPeriod{Type: models.BudgetPeriodMonthly, StartDay: 1}
+		}
+		current = settings.Containing(day)
+		switch against {
+		case compareAgainstPrevious:
+			previous = settings.Containing(current.Start.AddDate(0, 0, -1))
+		case compareAgainstYear:
+			if settings.IsMonthly() {
+				previous = settings.MonthPeriod(current.Year-1, current.Month)
+			} else {
+				previous = settings.Containing(current.Start.AddDate(-1, 0, 0))
+			}
+		}
 	}
 
-	respondWithJSON(w, http.StatusOK, comparisons)
+	if against == compareAgainstCustom {
+		if query.Get("compare_from") == "" || query.Get("compare_to") == "" {
+			respondWithError(w, http.StatusBadRequest, "compare_from and compare_to are required for a custom comparison")
+			return
+		}
+		from, to, message := parseDateRange(query.Get("compare_from"), query.Get("compare_to"))
+		if message != "" {
+			respondWithError(w, http.StatusBadRequest, message)
+			return
+		}
+		previous = models.Period{Start: from, End: to}
+	}
+
+	top := 3
+	if topParam := query.Get("top"); topParam != "" {
+		if parsed, err := strconv.Atoi(topParam); err == nil && parsed >= 0 {
+			top = parsed
+		}
+	}
+
+	comparison, err := comparePeriods(userID, current, previous, top)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
+	}
+	comparison.Against = against
+
+	respondWithJSON(w, http.StatusOK, comparison)
+}
+
+// comparePeriods compares the spending of two periods per category and picks the top
+// categories whose spending grew the most
+func comparePeriods(userID uint, current, previous models.Period, top int) (PeriodComparison, error) {
+	comparison := PeriodComparison{
+		ByCategory:       []CategoryDelta{},
+		LargestIncreases: []CategoryDelta{},
+	}
+
+	periods := []models.Period{current, previous}
+	compared := []*ComparedPeriod{&comparison.Current, &comparison.Previous}
+	index := make(map[uint]int) // Category ID, 0 for uncategorized, to its position in ByCategory
+	for i, period := range periods {
+		groups, err := groupExpensesByCategory(userID, period.Start, period.End)
+		if err != nil {
+			return comparison, err
+		}
+
+		*compared[i] = ComparedPeriod{
+			StartDate: period.Start.Format("2006-01-02"),
+			EndDate:   period.End.AddDate(0, 0, -1).Format("2006-01-02"),
+			Year:      period.Year,
+			Month:     period.Month,
+		}
+		for _, group := range groups {
+			compared[i].TotalExpenses += group.TotalAmount
+			compared[i].ExpenseCount += group.ExpenseCount
+
+			var key uint
+			if group.CategoryID != nil {
+				key = *group.CategoryID
+			}
+			position, exists := index[key]
+			if !exists {
+				position = len(comparison.ByCategory)
+				index[key] = position
+				comparison.ByCategory = append(comparison.ByCategory, CategoryDelta{
+					CategoryID:    group.CategoryID,
+					CategoryName:  group.Label,
+					CategoryColor: group.Color,
+				})
+			}
+			if i == 0 {
+				comparison.ByCategory[position].CurrentAmount = group.TotalAmount
+			} else {
+				comparison.ByCategory[position].PreviousAmount = group.TotalAmount
+			}
+		}
+		compared[i].TotalExpenses = roundAmount(compared[i].TotalExpenses)
+	}
+
+	comparison.Delta, comparison.DeltaPercent = amountDelta(comparison.Current.TotalExpenses, comparison.Previous.TotalExpenses)
+	for i := range comparison.ByCategory {
+		entry := &comparison.ByCategory[i]
+		entry.Delta, entry.DeltaPercent = amountDelta(entry.CurrentAmount, entry.PreviousAmount)
+	}
+
+	sort.SliceStable(comparison.ByCategory, func(i, j int) bool {
+		return comparison.ByCategory[i].Delta > comparison.ByCategory[j].Delta
+	})
+	for _, entry := range comparison.ByCategory {
+		if len(comparison.LargestIncreases) == top || entry.Delta <= 0 {
+			break
+		}
+		comparison.LargestIncreases = append(comparison.LargestIncreases, entry)
+	}
+
+	return comparison, nil
+}
+
+// amountDelta returns the change from previous to current, and the change in percent
+// unless previous is zero
+func amountDelta(current, previous float64) (float64, *float64) {
+	delta := roundAmount(current - previous)
+	if previous == 0 {
+		return delta, nil
+	}
+	percent := roundAmount(delta / previous * 100)
+	return delta, &percent
+}
+
+// parseDateRange parses an inclusive from..to range into [from, to), returning an error
+// message when either date is invalid
+func parseDateRange(fromParam, toParam string) (time.Time, time.Time, string) {
+	from, err := time.ParseInLocation("2006-01-02", fromParam, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, "Invalid from date. Use YYYY-MM-DD"
+	}
+	to, err := time.ParseInLocation("2006-01-02", toParam, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, "Invalid to date. Use YYYY-MM-DD"
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, "from must be on or before to"
+	}
+	return from, to.AddDate(0, 0, 1), ""
 }
 
 // GetYearlyTrends returns monthly expense trends for a year for the authenticated user
@@ -248,31 +799,423 @@ func (h *ReportHandler) GetYearlyTrends(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var trends []MonthComparison
-
+	periods := make([]models.Period, 0, 12)
+	monthPeriod := reportMonths(r, userID)
 	for month := 1; month <= 12; month++ {
-		startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-		endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
-
-		var totalExpenses float64
-		var expenseCount int64
-
-		database.GetDB().Model(&models.DailyExpense{}).
-			Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-			Select("COALESCE(SUM(amount), 0)").
-			Scan(&totalExpenses)
-
-		database.GetDB().Model(&models.DailyExpense{}).
-			Where("user_id = ? AND expense_date >= ? AND expense_date <= ?", userID, startDate, endDate).
-			Count(&expenseCount)
-
-		trends = append(trends, MonthComparison{
-			Year:          year,
-			Month:         month,
-			TotalExpenses: totalExpenses,
-			ExpenseCount:  expenseCount,
-		})
+		period, _ := monthPeriod(year, month)
+		periods = append(periods, period)
+	}
+
+	trends, err := monthComparisons(userID, periods)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to build report")
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, trends)
 }
+
+// monthComparisons totals the expenses of each monthly period
+func monthComparisons(userID uint, periods []models.Period) ([]MonthComparison, error) {
+	groups, err := groupExpensesByPeriods(userID, periods, groupByMonth)
+	if err != nil {
+		return nil, err
+	}
+
+	comparisons := make([]MonthComparison, 0, len(periods))
+	for i, period := range periods {
+		comparisons = append(comparisons, MonthComparison{
+			Year:          period.Year,
+			Month:         period.Month,
+			StartDate:     groups[i].StartDate,
+			EndDate:       groups[i].EndDate,
+			TotalExpenses: groups[i].TotalAmount,
+			ExpenseCount:  groups[i].ExpenseCount,
+		})
+	}
+	return comparisons, nil
+}
+
+// GetVATSummary returns the VAT paid on expenses in a calendar quarter and how much of it
+// is reclaimable. With ?format=csv the taxed expenses are exported line by line.
+func (h *ReportHandler) GetVATSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid year")
+		return
+	}
+
+	quarter, err := strconv.Atoi(vars["quarter"])
+	if err != nil || quarter < 1 || quarter > 4 {
+		respondWithError(w, http.StatusBadRequest, "Invalid quarter")
+		return
+	}
+
+	startDate := time.Date(year, time.Month(quarter*3-2), 1, 0, 0, 0, 0, time.Local)
+	endDate := startDate.AddDate(0, 3, 0)
+
+	query := database.GetDB().Preload("Category").
+		Where("user_id = ? AND expense_date >= ? AND expense_date < ? AND tax_amount > 0", userID, startDate, endDate)
+	if r.URL.Query().Get("reclaimable_only") == "true" {
+		query = query.Where("tax_reclaimable = ?", true)
+	}
+
+	var expenses []models.DailyExpense
+	if err := query.Order("expense_date ASC, id ASC").Find(&expenses).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch expenses")
+		return
+	}
+
+	summary := VATSummary{
+		Year:       year,
+		Quarter:    quarter,
+		StartDate:  startDate.Format("2006-01-02"),
+		EndDate:    endDate.AddDate(0, 0, -1).Format("2006-01-02"),
+		ByCategory: []VATCategorySummary{},
+		ByRate:     []VATRateSummary{},
+	}
+
+	categoryIndex := make(map[uint]int)
+	rateIndex := make(map[float64]int)
+	for i := range expenses {
+		expense := &expenses[i]
+		reclaimable := 0.0
+		if expense.TaxReclaimable {
+			reclaimable = expense.TaxAmount
+		}
+
+		summary.ExpenseCount++
+		summary.TotalGross += expense.Amount
+		summary.TotalTax += expense.TaxAmount
+		summary.ReclaimableTax += reclaimable
+
+		var categoryID uint
+		if expense.CategoryID != nil {
+			categoryID = *expense.CategoryID
+		}
+		index, exists := categoryIndex[categoryID]
+		if !exists {
+			index = len(summary.ByCategory)
+			categoryIndex[categoryID] = index
+			entry := VATCategorySummary{CategoryID: expense.CategoryID, CategoryName: "Uncategorized"}
+			if expense.Category != nil {
+				entry.CategoryName = expense.Category.Name
+			}
+			summary.ByCategory = append(summary.ByCategory, entry)
+		}
+		summary.ByCategory[index].ExpenseCount++
+		summary.ByCategory[index].Gross += expense.Amount
+		summary.ByCategory[index].Tax += expense.TaxAmount
+		summary.ByCategory[index].ReclaimableTax += reclaimable
+
+		var rate float64
+		if expense.TaxRate != nil {
+			rate = *expense.TaxRate
+		}
+		index, exists = rateIndex[rate]
+		if !exists {
+			index = len(summary.ByRate)
+			rateIndex[rate] = index
+			summary.ByRate = append(summary.ByRate, VATRateSummary{Rate: rate})
+		}
+		summary.ByRate[index].ExpenseCount++
+		summary.ByRate[index].Net += expense.Amount - expense.TaxAmount
+		summary.ByRate[index].Tax += expense.TaxAmount
+		summary.ByRate[index].ReclaimableTax += reclaimable
+	}
+
+	summary.TotalGross = roundAmount(summary.TotalGross)
+	summary.TotalTax = roundAmount(summary.TotalTax)
+	summary.TotalNet = roundAmount(summary.TotalGross - summary.TotalTax)
+	summary.ReclaimableTax = roundAmount(summary.ReclaimableTax)
+	summary.NonReclaimableTax = roundAmount(summary.TotalTax - summary.ReclaimableTax)
+	for i := range summary.ByCategory {
+		summary.ByCategory[i].Gross = roundAmount(summary.ByCategory[i].Gross)
+		summary.ByCategory[i].Tax = roundAmount(summary.ByCategory[i].Tax)
+		summary.ByCategory[i].ReclaimableTax = roundAmount(summary.ByCategory[i].ReclaimableTax)
+	}
+	for i := range summary.ByRate {
+		summary.ByRate[i].Net = roundAmount(summary.ByRate[i].Net)
+		summary.ByRate[i].Tax = roundAmount(summary.ByRate[i].Tax)
+		summary.ByRate[i].ReclaimableTax = roundAmount(summary.ByRate[i].ReclaimableTax)
+	}
+	sort.Slice(summary.ByRate, func(i, j int) bool {
+		return summary.ByRate[i].Rate > summary.ByRate[j].Rate
+	})
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeVATCSV(w, &summary, expenses)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, summary)
+}
+
+// writeVATCSV writes the taxed expenses of a VAT summary as a CSV attachment
+func writeVATCSV(w http.ResponseWriter, summary *VATSummary, expenses []models.DailyExpense) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"vat-%d-Q%d.csv\"", summary.Year, summary.Quarter))
+	w.WriteHeader(http.StatusOK)
+
+	money := func(amount float64) string {
+		return strconv.FormatFloat(amount, 'f', 2, 64)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Date", "Description", "Category", "Net Amount", "VAT Rate", "VAT Amount", "Gross Amount", "Reclaimable"})
+	for i := range expenses {
+		expense := &expenses[i]
+		category := "Uncategorized"
+		if expense.Category != nil {
+			category = expense.Category.Name
+		}
+		rate := ""
+		if expense.TaxRate != nil {
+			rate = money(*expense.TaxRate)
+		}
+		writer.Write([]string{
+			expense.ExpenseDate.Format("2006-01-02"),
+			csvText(expense.Description),
+			csvText(category),
+			money(expense.Amount - expense.TaxAmount),
+			rate,
+			money(expense.TaxAmount),
+			money(expense.Amount),
+			strconv.FormatBool(expense.TaxReclaimable),
+		})
+	}
+	writer.Write([]string{"Total", "", "", money(summary.TotalNet), "", money(summary.TotalTax), money(summary.TotalGross), ""})
+	writer.Write([]string{"Reclaimable VAT", "", "", "", "", money(summary.ReclaimableTax), "", ""})
+	writer.Flush()
+}
+
+// csvText makes user text safe to open in a spreadsheet: a cell starting with one of the
+// characters that begin a formula is prefixed with a quote so it is shown as text
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// GetNetWorth returns a net worth time series built from daily balance snapshots for the authenticated user
+func (h *ReportHandler) GetNetWorth(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if toParam := r.URL.Query().Get("to"); toParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to date. Use YYYY-MM-DD")
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromParam, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid from date. Use YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		respondWithError(w, http.StatusBadRequest, "from must be on or before to")
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	dates, err := netWorthDates(from, to, interval)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target := currency.Normalize(r.URL.Query().Get("currency"))
+	if target == "" {
+		target = h.converter.Base()
+	}
+	if !h.converter.Supports(target) {
+		respondWithError(w, http.StatusBadRequest, "Unsupported currency")
+		return
+	}
+
+	// Deleted accounts are loaded too, as they still count in the history before their deletion
+	var accounts []models.BankAccount
+	if err := database.GetDB().Unscoped().Where("user_id = ?", userID).Find(&accounts).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch bank accounts")
+		return
+	}
+
+	accountsByID := make(map[uint]*models.BankAccount, len(accounts))
+	breakdown := make([]NetWorthAccount, 0, len(accounts))
+	for i := range accounts {
+		account := &accounts[i]
+		accountsByID[account.ID] = account
+		if account.DeletedAt.Valid {
+			continue
+		}
+
+		converted, err := h.netWorthContribution(account, account.Balance, account.Currency, target)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		breakdown = append(breakdown, NetWorthAccount{
+			AccountID:        account.ID,
+			AccountName:      account.AccountName,
+			AccountType:      account.AccountType,
+			IsLiability:      account.IsLiability(),
+			Balance:          account.Balance,
+			Currency:         currency.Normalize(account.Currency),
+			ConvertedBalance: converted,
+		})
+	}
+
+	// Installment loans count as liabilities for whatever is still unpaid
+	var loans []models.Loan
+	if err := database.GetDB().Preload("Installments").Where("user_id = ?", userID).Find(&loans).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+		return
+	}
+
+	loanBreakdown := make([]NetWorthLoan, 0, len(loans))
+	for i := range loans {
+		remaining := roundAmount(loans[i].RemainingAt(today()))
+		converted, err := h.converter.Convert(remaining, loans[i].Currency, target)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		loanBreakdown = append(loanBreakdown, NetWorthLoan{
+			LoanID:             loans[i].ID,
+			Name:               loans[i].Name,
+			RemainingAmount:    remaining,
+			Currency:           currency.Normalize(loans[i].Currency),
+			ConvertedRemaining: roundAmount(converted),
+		})
+	}
+
+	var snapshots []models.BankAccountSnapshot
+	if err := database.GetDB().
+		Where("user_id = ? AND snapshot_date <= ?", userID, to).
+		Order("snapshot_date ASC").
+		Find(&snapshots).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch balance history")
+		return
+	}
+
+	// Walk the snapshots once, carrying each account's latest balance forward
+	latest := make(map[uint]models.BankAccountSnapshot)
+	points := make([]NetWorthPoint, 0, len(dates))
+	next := 0
+	for _, date := range dates {
+		day := date.Format("2006-01-02")
+		for next < len(snapshots) && snapshots[next].SnapshotDate.Format("2006-01-02") <= day {
+			latest[snapshots[next].BankAccountID] = snapshots[next]
+			next++
+		}
+
+		point := NetWorthPoint{Date: day}
+		for accountID, snapshot := range latest {
+			account, exists := accountsByID[accountID]
+			if !exists || (account.DeletedAt.Valid && !date.Before(account.DeletedAt.Time)) {
+				continue
+			}
+
+			value, err := h.netWorthContribution(account, snapshot.Balance, snapshot.Currency, target)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if value < 0 {
+				point.Liabilities -= value
+			} else {
+				point.Assets += value
+			}
+		}
+		for i := range loans {
+			owed, err := h.converter.Convert(loans[i].RemainingAt(date), loans[i].Currency, target)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			point.Liabilities += owed
+		}
+		point.Assets = math.Round(point.Assets*100) / 100
+		point.Liabilities = math.Round(point.Liabilities*100) / 100
+		point.NetWorth = math.Round((point.Assets-point.Liabilities)*100) / 100
+		points = append(points, point)
+	}
+
+	respondWithJSON(w, http.StatusOK, NetWorthReport{
+		Currency: target,
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Interval: interval,
+		Points:   points,
+		Accounts: breakdown,
+		Loans:    loanBreakdown,
+	})
+}
+
+// netWorthContribution converts a balance to the target currency. Liabilities are stored
+// negative already, so an overpaid credit card counts as an asset.
+func (h *ReportHandler) netWorthContribution(account *models.BankAccount, balance float64, from, target string) (float64, error) {
+	if from == "" {
+		from = account.Currency
+	}
+	return h.converter.Convert(balance, from, target)
+}
+
+// netWorthDates returns the dates a net worth series is sampled at: every day,
+// the end of every week, or the end of every month, always including the last date
+func netWorthDates(from, to time.Time, interval string) ([]time.Time, error) {
+	var dates []time.Time
+	switch interval {
+	case "day":
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			dates = append(dates, d)
+			if len(dates) > maxNetWorthPoints {
+				return nil, errors.New("Date range is too large")
+			}
+		}
+		return dates, nil
+	case "week":
+		for d := from.AddDate(0, 0, 6); d.Before(to); d = d.AddDate(0, 0, 7) {
+			dates = append(dates, d)
+			if len(dates) > maxNetWorthPoints {
+				return nil, errors.New("Date range is too large")
+			}
+		}
+	case "month":
+		for d := time.Date(from.Year(), from.Month()+1, 0, 0, 0, 0, 0, from.Location()); d.Before(to); d = time.Date(d.Year(), d.Month()+2, 0, 0, 0, 0, 0, d.Location()) {
+			dates = append(dates, d)
+			if len(dates) > maxNetWorthPoints {
+				return nil, errors.New("Date range is too large")
+			}
+		}
+	default:
+		return nil, errors.New("Interval must be day, week or month")
+	}
+
+	return append(dates, to), nil
+}
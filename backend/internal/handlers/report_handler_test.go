@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/currency"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"gorm.io/gorm"
+)
+
+func seedPlans(t *testing.T, db *gorm.DB, userID uint, year int, amount float64) {
+	t.Helper()
+	for month := 1; month <= 12; month++ {
+		if err := db.Create(&models.MonthlyPlan{
+			UserID:        userID,
+			Year:          year,
+			Month:         month,
+			Calendar:      models.CalendarGregorian,
+			PlannedAmount: amount,
+		}).Error; err != nil {
+			t.Fatalf("creating plan: %v", err)
+		}
+	}
+}
+
+func TestLoadPlansByMonthUsesOneQuery(t *testing.T) {
+	db := testutil.OpenDB(t)
+	seedPlans(t, db, 1, 2026, 100)
+	counter := testutil.CountQueries(t, db)
+
+	for _, count := range []int{1, 3, 12} {
+		months := make([]planMonth, 0, count)
+		for month := 1; month <= count; month++ {
+			months = append(months, planMonth{year: 2026, month: month})
+		}
+
+		counter.Reset()
+		plans, err := loadPlansByMonth(1, models.CalendarGregorian, months)
+		if err != nil {
+			t.Fatalf("loadPlansByMonth(%d months): %v", count, err)
+		}
+		if got := counter.Count(); got != 1 {
+			t.Errorf("loadPlansByMonth(%d months) ran %d queries, want 1", count, got)
+		}
+		for _, month := range months {
+			if plans[month].total != 100 {
+				t.Errorf("plans for %v = %v, want 100", month, plans[month].total)
+			}
+		}
+	}
+}
+
+func TestGetPeriodsQueryCountDoesNotGrowWithPeriods(t *testing.T) {
+	db := testutil.OpenDB(t)
+	seedPlans(t, db, 1, 2025, 100)
+	seedPlans(t, db, 1, 2026, 100)
+	handler := NewBudgetPeriodHandler()
+	counter := testutil.CountQueries(t, db)
+
+	queries := make(map[string]int64)
+	for _, count := range []string{"2", "12", "24"} {
+		counter.Reset()
+		w := testutil.Serve(handler.GetPeriods, testutil.AsUser(
+			testutil.Request(t, http.MethodGet, "/api/budget-periods?date=2026-12-15&count="+count, nil), 1))
+		if w.Code != http.StatusOK {
+			t.Fatalf("count=%s: status %d: %s", count, w.Code, w.Body.String())
+		}
+		queries[count] = counter.Count()
+	}
+
+	if queries["2"] != queries["12"] || queries["12"] != queries["24"] {
+		t.Errorf("queries per request grow with the number of periods: %v", queries)
+	}
+}
+
+// seedReportExpenses adds one expense in each month of 2025 and 2026, and twelve expenses in
+// their own categories in June 2026
+func seedReportExpenses(t *testing.T, db *gorm.DB, userID uint) {
+	t.Helper()
+	for i := 0; i < 24; i++ {
+		expense := models.DailyExpense{UserID: userID, Amount: 10, ExpenseDate: date("2025-01-10").AddDate(0, i, 0)}
+		if err := db.Create(&expense).Error; err != nil {
+			t.Fatalf("creating expense: %v", err)
+		}
+	}
+	for i := 0; i < 12; i++ {
+		category := models.Category{UserID: userID, Name: fmt.Sprint("Category ", i)}
+		if err := db.Create(&category).Error; err != nil {
+			t.Fatalf("creating category: %v", err)
+		}
+		expense := models.DailyExpense{UserID: userID, Amount: 5, ExpenseDate: date("2026-06-12"), CategoryID: &category.ID}
+		if err := db.Create(&expense).Error; err != nil {
+			t.Fatalf("creating expense: %v", err)
+		}
+	}
+}
+
+// reportQueryCounts serves each request and returns the number of statements it ran
+func reportQueryCounts(t *testing.T, counter *testutil.QueryCounter, handler http.HandlerFunc, requests map[string]*http.Request) map[string]int64 {
+	t.Helper()
+	queries := make(map[string]int64, len(requests))
+	for name, r := range requests {
+		counter.Reset()
+		w := testutil.Serve(handler, testutil.AsUser(r, 1))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", name, w.Code, w.Body.String())
+		}
+		queries[name] = counter.Count()
+	}
+	return queries
+}
+
+func TestReportQueryCountsDoNotGrowWithMonths(t *testing.T) {
+	for _, settings := range []*models.BudgetPeriod{
+		nil,
+		{UserID: 1, Type: models.BudgetPeriodMonthly, StartDay: 25, Adjustment: models.PeriodAdjustNone},
+	} {
+		name := "calendar months"
+		if settings != nil {
+			name = "salary day"
+		}
+		t.Run(name, func(t *testing.T) {
+			db := testutil.OpenDB(t)
+			seedPlans(t, db, 1, 2025, 100)
+			seedPlans(t, db, 1, 2026, 100)
+			seedReportExpenses(t, db, 1)
+			if settings != nil {
+				if err := db.Create(settings).Error; err != nil {
+					t.Fatalf("saving budget period: %v", err)
+				}
+			}
+			handler := NewReportHandler(nil)
+			counter := testutil.CountQueries(t, db)
+
+			comparison := func(months int) *http.Request {
+				query := make([]string, 0, months)
+				for i := 0; i < months; i++ {
+					query = append(query, "months="+date("2025-01-01").AddDate(0, i, 0).Format("2006-01"))
+				}
+				return testutil.Request(t, http.MethodGet, "/api/reports/compare?"+strings.Join(query, "&"), nil)
+			}
+			queries := reportQueryCounts(t, counter, handler.GetMonthComparison, map[string]*http.Request{
+				"1": comparison(1), "12": comparison(12), "24": comparison(24),
+			})
+			if queries["1"] != queries["12"] || queries["12"] != queries["24"] {
+				t.Errorf("month comparison queries grow with the number of months: %v", queries)
+			}
+
+			trends := func(year string) *http.Request {
+				return testutil.WithVars(testutil.Request(t, http.MethodGet, "/api/reports/trends/"+year, nil),
+					map[string]string{"year": year})
+			}
+			queries = reportQueryCounts(t, counter, handler.GetYearlyTrends, map[string]*http.Request{
+				"empty": trends("2024"), "full": trends("2026"),
+			})
+			if queries["empty"] != queries["full"] {
+				t.Errorf("yearly trend queries grow with the months that have expenses: %v", queries)
+			}
+
+			monthly := func(month string) *http.Request {
+				return testutil.WithVars(testutil.Request(t, http.MethodGet, "/api/reports/monthly/2026/"+month, nil),
+					map[string]string{"year": "2026", "month": month})
+			}
+			queries = reportQueryCounts(t, counter, handler.GetMonthlyReport, map[string]*http.Request{
+				"1 category": monthly("3"), "12 categories": monthly("6"),
+			})
+			if queries["1 category"] != queries["12 categories"] {
+				t.Errorf("monthly report queries grow with the number of categories: %v", queries)
+			}
+		})
+	}
+}
+
+func TestMonthlyReportFailsWhenPlansCannotBeLoaded(t *testing.T) {
+	db := testutil.OpenDB(t)
+	if err := db.Migrator().DropTable(&models.MonthlyPlan{}); err != nil {
+		t.Fatalf("dropping plans: %v", err)
+	}
+
+	if _, err := loadPlansByMonth(1, models.CalendarGregorian, []planMonth{{year: 2026, month: 1}}); err == nil {
+		t.Error("loadPlansByMonth succeeded without a plans table")
+	}
+
+	handler := NewReportHandler(nil)
+	r := testutil.WithVars(testutil.Request(t, http.MethodGet, "/api/reports/monthly/2026/1?period=calendar", nil),
+		map[string]string{"year": "2026", "month": "1"})
+	w := testutil.Serve(handler.GetMonthlyReport, testutil.AsUser(r, 1))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNetWorthCountsBalancesWithTheirSign(t *testing.T) {
+	db := testutil.OpenDB(t)
+	checking := seedAccount(t, db, models.BankAccount{Balance: 1200})
+	dollars := seedAccount(t, db, models.BankAccount{Balance: 100, Currency: "USD"})
+	card := seedAccount(t, db, models.BankAccount{AccountType: models.AccountTypeCreditCard, Balance: -300})
+	overpaid := seedAccount(t, db, models.BankAccount{AccountType: models.AccountTypeCreditCard, Balance: 50})
+	closed := seedAccount(t, db, models.BankAccount{Balance: 500})
+
+	for _, snapshot := range []models.BankAccountSnapshot{
+		{BankAccountID: checking.ID, SnapshotDate: date("2026-09-01"), Balance: 1000, Currency: "SAR"},
+		{BankAccountID: checking.ID, SnapshotDate: date("2026-09-03"), Balance: 1200, Currency: "SAR"},
+		{BankAccountID: dollars.ID, SnapshotDate: date("2026-09-01"), Balance: 100, Currency: "USD"},
+		{BankAccountID: card.ID, SnapshotDate: date("2026-09-01"), Balance: -300, Currency: "SAR"},
+		{BankAccountID: overpaid.ID, SnapshotDate: date("2026-09-02"), Balance: 50, Currency: "SAR"},
+		{BankAccountID: closed.ID, SnapshotDate: date("2026-09-01"), Balance: 500, Currency: "SAR"},
+	} {
+		snapshot.UserID = 1
+		if err := db.Create(&snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&closed).Update("deleted_at", date("2026-09-02")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewReportHandler(currency.NewConverter("SAR", map[string]float64{"USD": 3.75}))
+	w := testutil.Serve(handler.GetNetWorth, testutil.AsUser(
+		testutil.Request(t, http.MethodGet, "/api/reports/net-worth?from=2026-09-01&to=2026-09-03", nil), 1))
+	var report NetWorthReport
+	testutil.DecodeJSON(t, w, &report)
+
+	want := []NetWorthPoint{
+		{Date: "2026-09-01", Assets: 1875, Liabilities: 300, NetWorth: 1575},
+		{Date: "2026-09-02", Assets: 1425, Liabilities: 300, NetWorth: 1125},
+		{Date: "2026-09-03", Assets: 1625, Liabilities: 300, NetWorth: 1325},
+	}
+	if len(report.Points) != len(want) {
+		t.Fatalf("got %d points, want %d: %s", len(report.Points), len(want), w.Body.String())
+	}
+	for i, point := range report.Points {
+		if point != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, point, want[i])
+		}
+	}
+
+	for _, account := range report.Accounts {
+		if account.AccountID == overpaid.ID && account.ConvertedBalance != 50 {
+			t.Errorf("overpaid card counts as %v, want 50", account.ConvertedBalance)
+		}
+		if account.AccountID == closed.ID {
+			t.Error("deleted account is listed")
+		}
+	}
+}
+
+func TestNetWorthDates(t *testing.T) {
+	format := func(dates []time.Time) []string {
+		formatted := make([]string, len(dates))
+		for i, d := range dates {
+			formatted[i] = d.Format("2006-01-02")
+		}
+		return formatted
+	}
+	for _, tc := range []struct {
+		interval, from, to string
+		want               []string
+	}{
+		{"day", "2026-01-30", "2026-02-01", []string{"2026-01-30", "2026-01-31", "2026-02-01"}},
+		{"week", "2026-01-01", "2026-01-20", []string{"2026-01-07", "2026-01-14", "2026-01-20"}},
+		{"month", "2026-01-15", "2026-03-10", []string{"2026-01-31", "2026-02-28", "2026-03-10"}},
+	} {
+		dates, err := netWorthDates(date(tc.from), date(tc.to), tc.interval)
+		if got := format(dates); err != nil || strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s from %s to %s = %v (%v), want %v", tc.interval, tc.from, tc.to, got, err, tc.want)
+		}
+	}
+	if _, err := netWorthDates(date("2026-01-01"), date("2026-01-02"), "year"); err == nil {
+		t.Error("an unknown interval was accepted")
+	}
+}
@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/currency"
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/hijri"
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"gorm.io/gorm"
+)
+
+type ZakatHandler struct {
+	converter *currency.Converter
+}
+
+func NewZakatHandler(converter *currency.Converter) *ZakatHandler {
+	return &ZakatHandler{converter: converter}
+}
+
+type zakatSettingsRequest struct {
+	HawlStartDate      string   `json:"hawl_start_date"`  // Gregorian YYYY-MM-DD
+	HawlStartHijri     string   `json:"hawl_start_hijri"` // Umm al-Qura YYYY-MM-DD, used when no Gregorian date is given
+	NisabBasis         string   `json:"nisab_basis"`
+	GoldPricePerGram   float64  `json:"gold_price_per_gram"`
+	SilverPricePerGram float64  `json:"silver_price_per_gram"`
+	Currency           string   `json:"currency"`
+	ExcludedAccountIDs []uint   `json:"excluded_account_ids"`
+	DeductLiabilities  *bool    `json:"deduct_liabilities"`
+	AdditionalAssets   *float64 `json:"additional_assets"`
+}
+
+type zakatPaymentRequest struct {
+	Amount        float64 `json:"amount"`
+	PaidDate      string  `json:"paid_date"` // YYYY-MM-DD, defaults to today
+	HawlYear      int     `json:"hawl_year"` // Defaults to the hawl year the payment date falls in
+	BankAccountID *uint   `json:"bank_account_id"`
+	CategoryID    *uint   `json:"category_id"`
+	Notes         string  `json:"notes"`
+}
+
+// ZakatDate is a day shown in both calendars
+type ZakatDate struct {
+	Gregorian string `json:"gregorian"`
+	Hijri     string `json:"hijri"`
+}
+
+type ZakatAccount struct {
+	AccountID        uint    `json:"account_id"`
+	AccountName      string  `json:"account_name"`
+	AccountType      string  `json:"account_type"`
+	Balance          float64 `json:"balance"`
+	Currency         string  `json:"currency"`
+	ConvertedBalance float64 `json:"converted_balance"`
+	IsLiability      bool    `json:"is_liability"`
+	Excluded         bool    `json:"excluded"`
+}
+
+type ZakatCalculation struct {
+	Currency             string         `json:"currency"`
+	NisabBasis           string         `json:"nisab_basis"`
+	NisabValue           float64        `json:"nisab_value"`
+	HawlYear             int            `json:"hawl_year"`
+	HawlStart            ZakatDate      `json:"hawl_start"`
+	Anniversary          ZakatDate      `json:"anniversary"`
+	DaysUntilAnniversary int            `json:"days_until_anniversary"`
+	TotalAssets          float64        `json:"total_assets"`
+	AdditionalAssets     float64        `json:"additional_assets"`
+	TotalLiabilities     float64        `json:"total_liabilities"`
+	ZakatableWealth      float64        `json:"zakatable_wealth"`
+	MinimumDuringHawl    float64        `json:"minimum_during_hawl"`
+	AboveNisab           bool           `json:"above_nisab"`
+	NisabMaintained      bool           `json:"nisab_maintained"` // Wealth stayed above the nisab on every day of the hawl so far
+	ZakatRate            float64        `json:"zakat_rate"`
+	ZakatDue             float64        `json:"zakat_due"`
+	PaidThisHawl         float64        `json:"paid_this_hawl"`
+	RemainingDue         float64        `json:"remaining_due"`
+	Accounts             []ZakatAccount `json:"accounts"`
+}
+
+// GetSettings returns the zakat settings of the authenticated user
+func (h *ZakatHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var settings models.ZakatSettings
+	if err := database.GetDB().Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Zakat settings not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// UpdateSettings creates or updates the zakat settings of the authenticated user
+func (h *ZakatHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req zakatSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	settings := models.ZakatSettings{
+		UserID:            userID,
+		NisabBasis:        "silver",
+		Currency:          h.converter.Base(),
+		DeductLiabilities: true,
+	}
+	isNew := database.GetDB().Where("user_id = ?", userID).First(&settings).Error != nil
+
+	switch {
+	case req.HawlStartDate != "":
+		parsed, err := time.ParseInLocation("2006-01-02", req.HawlStartDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid hawl start date format. Use YYYY-MM-DD")
+			return
+		}
+		settings.HawlStartDate = parsed
+	case req.HawlStartHijri != "":
+		date, err := hijri.Parse(req.HawlStartHijri)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid Hijri hawl start date. Use YYYY-MM-DD")
+			return
+		}
+		parsed, err := date.ToGregorian()
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		settings.HawlStartDate = parsed
+	case isNew:
+		respondWithError(w, http.StatusBadRequest, "Hawl start date is required")
+		return
+	}
+
+	if settings.HawlStartDate.After(today()) {
+		respondWithError(w, http.StatusBadRequest, "Hawl start date cannot be in the future")
+		return
+	}
+	if _, err := hijri.FromGregorian(settings.HawlStartDate); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.NisabBasis != "" {
+		basis := strings.ToLower(strings.TrimSpace(req.NisabBasis))
+		if basis != "gold" && basis != "silver" {
+			respondWithError(w, http.StatusBadRequest, "Nisab basis must be gold or silver")
+			return
+		}
+		settings.NisabBasis = basis
+	}
+	if req.GoldPricePerGram < 0 || req.SilverPricePerGram < 0 {
+		respondWithError(w, http.StatusBadRequest, "Prices cannot be negative")
+		return
+	}
+	if req.GoldPricePerGram > 0 {
+		settings.GoldPricePerGram = req.GoldPricePerGram
+	}
+	if req.SilverPricePerGram > 0 {
+		settings.SilverPricePerGram = req.SilverPricePerGram
+	}
+	if req.Currency != "" {
+		code := currency.Normalize(req.Currency)
+		if !h.converter.Supports(code) {
+			respondWithError(w, http.StatusBadRequest, "Unsupported currency")
+			return
+		}
+		settings.Currency = code
+	}
+	if req.ExcludedAccountIDs != nil {
+		settings.ExcludedAccountIDs = req.ExcludedAccountIDs
+	}
+	if req.DeductLiabilities != nil {
+		settings.DeductLiabilities = *req.DeductLiabilities
+	}
+	if req.AdditionalAssets != nil {
+		if *req.AdditionalAssets < 0 {
+			respondWithError(w, http.StatusBadRequest, "Additional assets cannot be negative")
+			return
+		}
+		settings.AdditionalAssets = *req.AdditionalAssets
+	}
+
+	if err := database.GetDB().Save(&settings).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save zakat settings")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// GetCalculation computes the zakat due on the next hawl anniversary from the user's bank
+// account balances, and checks the daily balance snapshots of the hawl against the nisab
+func (h *ZakatHandler) GetCalculation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var settings models.ZakatSettings
+	if err := database.GetDB().Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		respondWithError(w, http.StatusNotFound, "Zakat settings not found")
+		return
+	}
+
+	pricePerGram, grams := settings.SilverPricePerGram, models.NisabSilverGrams
+	if settings.NisabBasis == "gold" {
+		pricePerGram, grams = settings.GoldPricePerGram, models.NisabGoldGrams
+	}
+	if pricePerGram <= 0 {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Set the %s price per gram to calculate the nisab", settings.NisabBasis))
+		return
+	}
+
+	now := today()
+	hawlStart, anniversary, hawlYear, err := zakatHawl(settings.HawlStartDate, now)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var accounts []models.BankAccount
+	if err := database.GetDB().Where("user_id = ?", userID).Find(&accounts).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch bank accounts")
+		return
+	}
+
+	var loans []models.Loan
+	if settings.DeductLiabilities {
+		if err := database.GetDB().Preload("Installments").Where("user_id = ?", userID).Find(&loans).Error; err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+			return
+		}
+	}
+
+	calculation := ZakatCalculation{
+		Currency:             settings.Currency,
+		NisabBasis:           settings.NisabBasis,
+		NisabValue:           roundAmount(pricePerGram * grams),
+		HawlYear:             hawlYear,
+		HawlStart:            zakatDate(hawlStart),
+		Anniversary:          zakatDate(anniversary),
+		DaysUntilAnniversary: int(math.Round(anniversary.Sub(now).Hours() / 24)),
+		AdditionalAssets:     settings.AdditionalAssets,
+		ZakatRate:            models.ZakatRate,
+		Accounts:             make([]ZakatAccount, 0, len(accounts)),
+	}
+
+	// Current wealth from live balances
+	balances := make(map[uint]models.BankAccountSnapshot, len(accounts))
+	for i := range accounts {
+		account := &accounts[i]
+		balances[account.ID] = models.BankAccountSnapshot{Balance: account.Balance, Currency: account.Currency}
+
+		converted, err := h.converter.Convert(account.Balance, account.Currency, settings.Currency)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		calculation.Accounts = append(calculation.Accounts, ZakatAccount{
+			AccountID:        account.ID,
+			AccountName:      account.AccountName,
+			AccountType:      account.AccountType,
+			Balance:          account.Balance,
+			Currency:         currency.Normalize(account.Currency),
+			ConvertedBalance: roundAmount(converted),
+			IsLiability:      account.IsLiability(),
+			Excluded:         settings.IsExcluded(account.ID),
+		})
+	}
+
+	assets, liabilities, err := h.zakatableWealth(&settings, accounts, balances, loans, now)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	calculation.TotalAssets = roundAmount(assets)
+	calculation.TotalLiabilities = roundAmount(liabilities)
+	calculation.ZakatableWealth = roundAmount(math.Max(0, assets+settings.AdditionalAssets-liabilities))
+
+	// Lowest wealth over the hawl so far, carrying each account's last snapshot forward
+	var snapshots []models.BankAccountSnapshot
+	if err := database.GetDB().
+		Where("user_id = ? AND snapshot_date <= ?", userID, now).
+		Order("snapshot_date ASC").
+		Find(&snapshots).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch balance history")
+		return
+	}
+
+	history := make(map[uint]models.BankAccountSnapshot)
+	minimum := math.Inf(1)
+	next := 0
+	for day := hawlStart; !day.After(now); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		for next < len(snapshots) && snapshots[next].SnapshotDate.Format("2006-01-02") <= key {
+			history[snapshots[next].BankAccountID] = snapshots[next]
+			next++
+		}
+
+		dayAssets, dayLiabilities, err := h.zakatableWealth(&settings, accounts, history, loans, day)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		minimum = math.Min(minimum, dayAssets+settings.AdditionalAssets-dayLiabilities)
+	}
+	calculation.MinimumDuringHawl = roundAmount(math.Max(0, math.Min(minimum, calculation.ZakatableWealth)))
+
+	calculation.AboveNisab = calculation.ZakatableWealth >= calculation.NisabValue
+	calculation.NisabMaintained = calculation.MinimumDuringHawl >= calculation.NisabValue
+	if calculation.AboveNisab {
+		calculation.ZakatDue = roundAmount(calculation.ZakatableWealth * models.ZakatRate)
+	}
+
+	var paid float64
+	database.GetDB().Model(&models.ZakatPayment{}).
+		Where("user_id = ? AND hawl_year = ?", userID, hawlYear).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&paid)
+	calculation.PaidThisHawl = roundAmount(paid)
+	calculation.RemainingDue = roundAmount(math.Max(0, calculation.ZakatDue-paid))
+
+	respondWithJSON(w, http.StatusOK, calculation)
+}
+
+// GetPayments returns the zakat payments of the authenticated user
+func (h *ZakatHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := database.GetDB().Where("user_id = ?", userID)
+	if hawlYear := r.URL.Query().Get("hawl_year"); hawlYear != "" {
+		query = query.Where("hawl_year = ?", hawlYear)
+	}
+
+	var payments []models.ZakatPayment
+	if err := query.Order("paid_date DESC").Find(&payments).Error; err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch zakat payments")
+		return
+	}
+
+	if payments == nil {
+		payments = []models.ZakatPayment{}
+	}
+
+	respondWithJSON(w, http.StatusOK, payments)
+}
+
+// CreatePayment records a zakat payment as an expense, optionally debiting a bank account
+func (h *ZakatHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req zakatPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be greater than 0")
+		return
+	}
+
+	paidDate := today()
+	if req.PaidDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.PaidDate, time.Local)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid paid date format. Use YYYY-MM-DD")
+			return
+		}
+		if parsed.After(paidDate) {
+			respondWithError(w, http.StatusBadRequest, "Paid date cannot be in the future")
+			return
+		}
+		paidDate = parsed
+	}
+
+	payment := models.ZakatPayment{
+		UserID:   userID,
+		HawlYear: req.HawlYear,
+		Amount:   req.Amount,
+		Currency: h.converter.Base(),
+		PaidDate: paidDate,
+		Notes:    req.Notes,
+	}
+
+	var settings models.ZakatSettings
+	hasSettings := database.GetDB().Where("user_id = ?", userID).First(&settings).Error == nil
+	if hasSettings {
+		payment.Currency = settings.Currency
+	}
+	if payment.HawlYear == 0 {
+		if hasSettings {
+			_, _, hawlYear, err := zakatHawl(settings.HawlStartDate, paidDate)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			payment.HawlYear = hawlYear
+		} else {
+			date, err := hijri.FromGregorian(paidDate)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			payment.HawlYear = date.Year
+		}
+	}
+
+	if err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		description := fmt.Sprintf("Zakat payment (%d AH)", payment.HawlYear)
+		expense, transaction, err := recordPaidExpense(tx, userID, req.Amount, description, paidDate, req.CategoryID, req.BankAccountID)
+		if err != nil {
+			return err
+		}
+		payment.ExpenseID = &expense.ID
+		if transaction != nil {
+			payment.BankAccountTransactionID = &transaction.ID
+		}
+		return tx.Create(&payment).Error
+	}); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			respondWithError(w, http.StatusNotFound, "Bank account not found")
+		case errors.Is(err, errInsufficientFunds), errors.Is(err, errCreditLimitExceeded):
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Failed to record zakat payment")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, payment)
+}
+
+// zakatableWealth sums the non-excluded asset balances and, when deducted, the liabilities
+// owed on a day, in the settings currency
+func (h *ZakatHandler) zakatableWealth(settings *models.ZakatSettings, accounts []models.BankAccount, balances map[uint]models.BankAccountSnapshot, loans []models.Loan, day time.Time) (assets, liabilities float64, err error) {
+	for i := range accounts {
+		account := &accounts[i]
+		balance, exists := balances[account.ID]
+		if !exists || settings.IsExcluded(account.ID) {
+			continue
+		}
+
+		from := balance.Currency
+		if from == "" {
+			from = account.Currency
+		}
+		converted, err := h.converter.Convert(balance.Balance, from, settings.Currency)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// Liabilities are stored negative, like overdrawn accounts, so an overpaid credit card
+		// counts as an asset
+		if converted < 0 {
+			if settings.DeductLiabilities {
+				liabilities -= converted
+			}
+		} else {
+			assets += converted
+		}
+	}
+
+	for i := range loans {
+		owed, err := h.converter.Convert(loans[i].RemainingAt(day), loans[i].Currency, settings.Currency)
+		if err != nil {
+			return 0, 0, err
+		}
+		liabilities += owed
+	}
+
+	return assets, liabilities, nil
+}
+
+// zakatHawl returns the start and anniversary of the hawl year containing the given day,
+// counted in Hijri years from the first hawl start, and the Hijri year of the anniversary
+func zakatHawl(firstStart, day time.Time) (time.Time, time.Time, int, error) {
+	start, err := hijri.FromGregorian(firstStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+
+	previous := firstStart
+	for years := 1; ; years++ {
+		anniversaryDate := start.AddYears(years)
+		anniversary, err := anniversaryDate.ToGregorian()
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, err
+		}
+		if !anniversary.Before(day) {
+			return previous, anniversary, anniversaryDate.Year, nil
+		}
+		previous = anniversary
+	}
+}
+
+// zakatDate formats a day in both calendars
+func zakatDate(day time.Time) ZakatDate {
+	return ZakatDate{Gregorian: day.Format("2006-01-02"), Hijri: hijriDateString(day)}
+}
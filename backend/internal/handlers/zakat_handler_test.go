@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/currency"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+func TestZakatHawl(t *testing.T) {
+	// 1 Ramadan 1446 is 2025-03-01 and 1 Ramadan 1447 is 2026-02-18 in the Umm al-Qura calendar
+	for _, tc := range []struct {
+		day, start, anniversary string
+		year                    int
+	}{
+		{"2025-03-01", "2025-03-01", "2026-02-18", 1447},
+		{"2025-10-01", "2025-03-01", "2026-02-18", 1447},
+		{"2026-02-18", "2025-03-01", "2026-02-18", 1447},
+		{"2026-02-19", "2026-02-18", "2027-02-08", 1448},
+	} {
+		start, anniversary, year, err := zakatHawl(date("2025-03-01"), date(tc.day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start.Format("2006-01-02") != tc.start || anniversary.Format("2006-01-02") != tc.anniversary || year != tc.year {
+			t.Errorf("hawl on %s = %s to %s (%d), want %s to %s (%d)", tc.day, start.Format("2006-01-02"),
+				anniversary.Format("2006-01-02"), year, tc.start, tc.anniversary, tc.year)
+		}
+	}
+}
+
+func TestZakatableWealthCountsBalancesWithTheirSign(t *testing.T) {
+	accounts := []models.BankAccount{
+		{ID: 1, AccountType: models.AccountTypeChecking, Currency: "SAR"},
+		{ID: 2, AccountType: models.AccountTypeSavings, Currency: "USD"},
+		{ID: 3, AccountType: models.AccountTypeCreditCard, Currency: "SAR"},
+		{ID: 4, AccountType: models.AccountTypeCreditCard, Currency: "SAR"}, // Overpaid
+		{ID: 5, AccountType: models.AccountTypeChecking, Currency: "SAR"},   // Overdrawn
+		{ID: 6, AccountType: models.AccountTypeSavings, Currency: "SAR"},    // Excluded
+	}
+	balances := map[uint]models.BankAccountSnapshot{
+		1: {Balance: 1000}, 2: {Balance: 100}, 3: {Balance: -300}, 4: {Balance: 50}, 5: {Balance: -20}, 6: {Balance: 5000},
+	}
+	handler := NewZakatHandler(currency.NewConverter("SAR", map[string]float64{"USD": 3.75}))
+
+	settings := &models.ZakatSettings{Currency: "SAR", DeductLiabilities: true, ExcludedAccountIDs: []uint{6}}
+	assets, liabilities, err := handler.zakatableWealth(settings, accounts, balances, nil, date("2026-01-01"))
+	if err != nil || assets != 1425 || liabilities != 320 {
+		t.Errorf("zakatableWealth = %v, %v (%v), want 1425 and 320", assets, liabilities, err)
+	}
+
+	settings.DeductLiabilities = false
+	assets, liabilities, err = handler.zakatableWealth(settings, accounts, balances, nil, date("2026-01-01"))
+	if err != nil || assets != 1425 || liabilities != 0 {
+		t.Errorf("zakatableWealth without deductions = %v, %v (%v), want 1425 and 0", assets, liabilities, err)
+	}
+}
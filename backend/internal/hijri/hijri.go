@@ -0,0 +1,121 @@
+package hijri
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ummalqura "github.com/hablullah/go-hijri"
+)
+
+// The Umm al-Qura tables cover 1356 AH (1937) to 1500 AH (2077)
+const (
+	MinYear = 1356
+	MaxYear = 1500
+)
+
+var errOutOfRange = errors.New("date is outside the supported Umm al-Qura range")
+
+// Date is a day in the Umm al-Qura calendar used in Saudi Arabia
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+// FromGregorian converts the calendar day of t to its Umm al-Qura date
+func FromGregorian(t time.Time) (Date, error) {
+	// The converter works on UTC, so keep the calendar day rather than the instant
+	day := time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC)
+	converted, err := ummalqura.CreateUmmAlQuraDate(day)
+	if err != nil {
+		return Date{}, errOutOfRange
+	}
+
+	return Date{Year: int(converted.Year), Month: int(converted.Month), Day: int(converted.Day)}, nil
+}
+
+// Parse reads a YYYY-MM-DD Umm al-Qura date
+func Parse(value string) (Date, error) {
+	var d Date
+	if _, err := fmt.Sscanf(value, "%d-%d-%d", &d.Year, &d.Month, &d.Day); err != nil {
+		return Date{}, errors.New("invalid Hijri date format, use YYYY-MM-DD")
+	}
+	if err := d.Validate(); err != nil {
+		return Date{}, err
+	}
+	return d, nil
+}
+
+// MonthRange returns the Gregorian first day of a Hijri month and the first day after it
+func MonthRange(year, month int) (time.Time, time.Time, error) {
+	start, err := Date{Year: year, Month: month, Day: 1}.ToGregorian()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, DaysInMonth(year, month)), nil
+}
+
+// ToGregorian returns the Gregorian day as local midnight
+func (d Date) ToGregorian() (time.Time, error) {
+	if err := d.Validate(); err != nil {
+		return time.Time{}, err
+	}
+
+	converted := ummalqura.UmmAlQuraDate{Year: int64(d.Year), Month: int64(d.Month), Day: int64(d.Day)}.ToGregorian()
+	return time.Date(converted.Year(), converted.Month(), converted.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// Validate checks that the date exists in the supported range
+func (d Date) Validate() error {
+	if d.Year < MinYear || d.Year > MaxYear || d.Month < 1 || d.Month > 12 {
+		return errOutOfRange
+	}
+	if d.Day < 1 || d.Day > DaysInMonth(d.Year, d.Month) {
+		return fmt.Errorf("day %d does not exist in %s %d", d.Day, MonthName(d.Month), d.Year)
+	}
+	return nil
+}
+
+// AddYears moves the date by whole Hijri years, clamping the day to the target month length
+func (d Date) AddYears(years int) Date {
+	result := Date{Year: d.Year + years, Month: d.Month, Day: d.Day}
+	if result.Year >= MinYear && result.Year <= MaxYear {
+		if days := DaysInMonth(result.Year, result.Month); result.Day > days {
+			result.Day = days
+		}
+	}
+	return result
+}
+
+// String formats the date as YYYY-MM-DD
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// DaysInMonth returns 29 or 30, the length of a month in the Umm al-Qura calendar
+func DaysInMonth(year, month int) int {
+	first := ummalqura.UmmAlQuraDate{Year: int64(year), Month: int64(month), Day: 1}.ToGregorian()
+	nextYear, nextMonth := year, month+1
+	if nextMonth > 12 {
+		nextYear, nextMonth = year+1, 1
+	}
+	if nextYear > MaxYear {
+		return 30
+	}
+	next := ummalqura.UmmAlQuraDate{Year: int64(nextYear), Month: int64(nextMonth), Day: 1}.ToGregorian()
+	return int(next.Sub(first).Hours() / 24)
+}
+
+var monthNames = [...]string{
+	"Muharram", "Safar", "Rabi al-Awwal", "Rabi al-Thani", "Jumada al-Ula", "Jumada al-Akhirah",
+	"Rajab", "Shaban", "Ramadan", "Shawwal", "Dhu al-Qadah", "Dhu al-Hijjah",
+}
+
+// MonthName returns the English transliteration of a Hijri month
+func MonthName(month int) string {
+	if month < 1 || month > 12 {
+		return ""
+	}
+	return monthNames[month-1]
+}
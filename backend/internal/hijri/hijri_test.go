@@ -0,0 +1,119 @@
+package hijri
+
+import (
+	"testing"
+	"time"
+)
+
+func day(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestMonthRange(t *testing.T) {
+	tests := []struct {
+		year, month int
+		start, end  string
+		days        int
+	}{
+		{1446, 9, "2025-03-01", "2025-03-30", 29},
+		{1446, 10, "2025-03-30", "2025-04-29", 30},
+		{1446, 12, "2025-05-28", "2025-06-26", 29},
+		{1447, 1, "2025-06-26", "2025-07-26", 30},
+		{1447, 9, "2026-02-18", "2026-03-20", 30},
+		{1447, 12, "2026-05-18", "2026-06-16", 29},
+	}
+	for _, tt := range tests {
+		if got := DaysInMonth(tt.year, tt.month); got != tt.days {
+			t.Errorf("DaysInMonth(%d, %d) = %d, want %d", tt.year, tt.month, got, tt.days)
+		}
+		start, end, err := MonthRange(tt.year, tt.month)
+		if err != nil {
+			t.Fatalf("MonthRange(%d, %d): %v", tt.year, tt.month, err)
+		}
+		if !start.Equal(day(tt.start)) || !end.Equal(day(tt.end)) {
+			t.Errorf("MonthRange(%d, %d) = %s..%s, want %s..%s", tt.year, tt.month,
+				start.Format("2006-01-02"), end.Format("2006-01-02"), tt.start, tt.end)
+		}
+	}
+
+	if _, _, err := MonthRange(MaxYear+1, 1); err == nil {
+		t.Error("MonthRange accepted a year past the Umm al-Qura tables")
+	}
+	if _, _, err := MonthRange(1447, 13); err == nil {
+		t.Error("MonthRange accepted month 13")
+	}
+}
+
+func TestMonthsFollowEachOther(t *testing.T) {
+	for year := 1440; year <= 1460; year++ {
+		days := 0
+		for month := 1; month <= 12; month++ {
+			length := DaysInMonth(year, month)
+			if length != 29 && length != 30 {
+				t.Fatalf("DaysInMonth(%d, %d) = %d", year, month, length)
+			}
+			days += length
+
+			_, end, err := MonthRange(year, month)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nextYear, nextMonth := year, month+1
+			if nextMonth > 12 {
+				nextYear, nextMonth = year+1, 1
+			}
+			next, _, err := MonthRange(nextYear, nextMonth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !end.Equal(next) {
+				t.Errorf("%d-%02d ends on %s but the next month starts on %s", year, month,
+					end.Format("2006-01-02"), next.Format("2006-01-02"))
+			}
+		}
+		if days != 354 && days != 355 {
+			t.Errorf("year %d has %d days", year, days)
+		}
+	}
+}
+
+func TestFromGregorianRoundTrips(t *testing.T) {
+	for current := day("2025-01-01"); current.Before(day("2027-01-01")); current = current.AddDate(0, 0, 1) {
+		d, err := FromGregorian(current)
+		if err != nil {
+			t.Fatalf("FromGregorian(%s): %v", current.Format("2006-01-02"), err)
+		}
+		back, err := d.ToGregorian()
+		if err != nil || !back.Equal(current) {
+			t.Errorf("%s -> %s -> %s, %v", current.Format("2006-01-02"), d, back.Format("2006-01-02"), err)
+		}
+	}
+
+	if d, err := FromGregorian(day("2026-02-18")); err != nil || d != (Date{Year: 1447, Month: 9, Day: 1}) {
+		t.Errorf("FromGregorian(2026-02-18) = %s, %v, want 1447-09-01", d, err)
+	}
+}
+
+func TestParseAndValidate(t *testing.T) {
+	if d, err := Parse("1447-09-30"); err != nil || d != (Date{Year: 1447, Month: 9, Day: 30}) {
+		t.Errorf("Parse(1447-09-30) = %s, %v", d, err)
+	}
+	for _, value := range []string{"1446-09-30", "1447-13-01", "1447-00-10", "1200-01-01", "1447/09/01", "soon"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) succeeded", value)
+		}
+	}
+}
+
+func TestAddYearsClampsTheDay(t *testing.T) {
+	if got := (Date{Year: 1447, Month: 9, Day: 30}).AddYears(-1); got != (Date{Year: 1446, Month: 9, Day: 29}) {
+		t.Errorf("1447-09-30 minus a year = %s, want 1446-09-29", got)
+	}
+	if got := (Date{Year: 1446, Month: 9, Day: 29}).AddYears(1); got != (Date{Year: 1447, Month: 9, Day: 29}) {
+		t.Errorf("1446-09-29 plus a year = %s, want 1447-09-29", got)
+	}
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"gorm.io/gorm"
+)
+
+// LoginAttemptRetention is how long sign-in attempts are kept for the audit trail
+const LoginAttemptRetention = 90 * 24 * time.Hour
+
+// StartAuthCleanup deletes expired sign-in records immediately and then once a day
+func StartAuthCleanup(db *gorm.DB) {
+	go func() {
+		for {
+			if err := CleanupAuthRecords(db); err != nil {
+				log.Printf("Auth cleanup job failed: %v", err)
+			}
+			time.Sleep(untilNextRun(time.Now()))
+		}
+	}()
+}
+
+// CleanupAuthRecords deletes login attempts and failure counts past their retention and
+// finished or abandoned OpenID Connect sign-ins
+func CleanupAuthRecords(db *gorm.DB) error {
+	result := db.Where("created_at < ?", time.Now().Add(-LoginAttemptRetention)).Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("last_failure_at < ?", time.Now().Add(-LoginAttemptRetention)).
+		Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Deleted %d old login attempts", result.RowsAffected)
+	return nil
+}
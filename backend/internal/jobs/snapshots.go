@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"gorm.io/gorm"
+)
+
+// StartBalanceSnapshots records a balance snapshot for every active bank account
+// immediately and then once a day shortly after midnight
+func StartBalanceSnapshots(db *gorm.DB) {
+	go func() {
+		for {
+			if err := SnapshotAllAccounts(db); err != nil {
+				log.Printf("Balance snapshot job failed: %v", err)
+			}
+			time.Sleep(untilNextRun(time.Now()))
+		}
+	}()
+}
+
+// SnapshotAllAccounts records today's balance for every active bank account
+func SnapshotAllAccounts(db *gorm.DB) error {
+	var accounts []models.BankAccount
+	if err := db.Where("is_active = ?", true).Find(&accounts).Error; err != nil {
+		return err
+	}
+
+	for i := range accounts {
+		if err := models.RecordBalanceSnapshot(db, &accounts[i]); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Recorded balance snapshots for %d accounts", len(accounts))
+	return nil
+}
+
+// untilNextRun returns the time left until five minutes past the next midnight
+func untilNextRun(now time.Time) time.Duration {
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 5, 0, 0, now.Location())
+	return next.Sub(now)
+}
@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers plain-text emails
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// NewSender returns an SMTP sender when a host is configured, and a log-only sender otherwise
+func NewSender(host, port, username, password, from string) Sender {
+	if host == "" {
+		return LogSender{}
+	}
+	return &SMTPSender{Host: host, Port: port, Username: username, Password: password, From: from}
+}
+
+// SMTPSender sends emails through an SMTP server, authenticating when a username is set
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers an email through the SMTP server
+func (s *SMTPSender) Send(to, subject, body string) error {
+	// The envelope takes the bare address of a "Name <address>" sender
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", s.From, err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, from.Address, []string{to}, message(s.From, to, subject, body))
+}
+
+// LogSender writes emails to the log instead of sending them, for development
+type LogSender struct{}
+
+// Send logs the email
+func (LogSender) Send(to, subject, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// headerValue drops line breaks so a value cannot end its header and start another
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// message formats an RFC 5322 plain-text message
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue.Replace(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
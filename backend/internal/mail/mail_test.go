@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+)
+
+func TestMessageKeepsLineBreaksOutOfHeaders(t *testing.T) {
+	data := string(message("App <app@example.com>", "victim@example.com\r\nBcc: attacker@example.com",
+		"Hello\nX-Injected: yes", "Body"))
+
+	headers, _, _ := strings.Cut(data, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") || strings.HasPrefix(line, "X-Injected:") {
+			t.Errorf("header injected: %q", line)
+		}
+	}
+	if !strings.Contains(headers, "To: victim@example.comBcc: attacker@example.com\r\n") {
+		t.Errorf("To header not kept on one line:\n%s", headers)
+	}
+}
+
+func TestSMTPSenderDelivers(t *testing.T) {
+	server := testutil.StartSMTP(t)
+	sender := NewSender(server.Host, server.Port, "", "", "App <app@example.com>")
+
+	if err := sender.Send("user@example.com", "Subject line", "First line\nSecond line\n"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := server.Next(t)
+	if got.From != "app@example.com" || len(got.To) != 1 || got.To[0] != "user@example.com" {
+		t.Errorf("envelope from %q to %v", got.From, got.To)
+	}
+	for _, want := range []string{"From: App <app@example.com>\n", "To: user@example.com\n", "Subject: Subject line\n", "First line\nSecond line\n"} {
+		if !strings.Contains(got.Data, want) {
+			t.Errorf("message is missing %q:\n%s", want, got.Data)
+		}
+	}
+}
+
+func TestSMTPSenderRefusesLineBreaksInRecipient(t *testing.T) {
+	server := testutil.StartSMTP(t)
+	sender := NewSender(server.Host, server.Port, "", "", "app@example.com")
+
+	if err := sender.Send("user@example.com\r\nRCPT TO:<other@example.com>", "Subject", "Body"); err == nil {
+		t.Error("Send accepted a recipient with a line break")
+	}
+}
@@ -2,17 +2,28 @@ package middleware
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
 	"github.com/abdelrahman/expense-manager/internal/utils"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey    contextKey = "userID"
+	SessionIDKey contextKey = "sessionID"
+	ScopesKey    contextKey = "scopes"
+)
 
-// Auth middleware validates JWT tokens and adds user ID to context
+// Auth middleware validates JWT tokens or API tokens and adds user ID to context
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -29,20 +40,153 @@ func Auth(next http.Handler) http.Handler {
 		}
 
 		tokenString := parts[1]
+		if strings.HasPrefix(tokenString, utils.APITokenPrefix) {
+			authenticateAPIToken(w, r, next, tokenString)
+			return
+		}
+
 		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
 			http.Error(w, `{"error":"Invalid or expired token"}`, http.StatusUnauthorized)
 			return
 		}
 
-		// Add user ID to request context
+		// Signing out revokes the session before its access tokens expire
+		var session models.Session
+		if err := database.GetDB().Select("id", "user_id", "last_seen_at", "revoked_at").First(&session, claims.SessionID).Error; err != nil ||
+			session.UserID != claims.UserID || session.RevokedAt != nil {
+			http.Error(w, `{"error":"Session has been revoked"}`, http.StatusUnauthorized)
+			return
+		}
+		if time.Since(session.LastSeenAt) > models.SessionSeenInterval {
+			if err := database.GetDB().Model(&session).Updates(map[string]interface{}{
+				"last_seen_at": time.Now(),
+				"ip_address":   ClientIP(r),
+			}).Error; err != nil {
+				// Only the session list shows it, so a failed update should not fail the request
+				log.Printf("Failed to update session %d last seen: %v", session.ID, err)
+			}
+		}
+
+		// Add user and session IDs to request context
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticateAPIToken serves a request made with a personal access token, adding the
+// token's scopes to the context for RequireScope
+func authenticateAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, tokenString string) {
+	var token models.APIToken
+	if err := database.GetDB().Where("token_hash = ?", utils.HashToken(tokenString)).First(&token).Error; err != nil ||
+		token.IsExpired() {
+		http.Error(w, `{"error":"Invalid or expired token"}`, http.StatusUnauthorized)
+		return
+	}
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > models.APITokenUsedInterval {
+		database.GetDB().Model(&token).Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"last_used_ip": ClientIP(r),
+		})
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, token.UserID)
+	ctx = context.WithValue(ctx, ScopesKey, token.GetScopes())
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetUserID extracts the user ID from the request context
 func GetUserID(r *http.Request) (uint, bool) {
 	userID, ok := r.Context().Value(UserIDKey).(uint)
 	return userID, ok
 }
+
+// GetSessionID extracts the session ID from the request context
+func GetSessionID(r *http.Request) (uint, bool) {
+	sessionID, ok := r.Context().Value(SessionIDKey).(uint)
+	return sessionID, ok
+}
+
+// GetScopes returns the scopes of the API token a request was made with; ok is false for
+// requests signed in with a JWT, which are not limited by scopes
+func GetScopes(r *http.Request) ([]string, bool) {
+	scopes, ok := r.Context().Value(ScopesKey).([]string)
+	return scopes, ok
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header is believed
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the reverse proxies, as IP addresses or CIDR ranges, whose
+// X-Forwarded-For header names the client. Without them every client behind a proxy has
+// the proxy's address, and sign-in throttling by IP address locks all of them out together.
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	for _, network := range trustedProxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address a request came from, without the port. Behind trusted proxies
+// it is the nearest address in X-Forwarded-For that is not one of them; addresses further
+// along could have been made up by the client.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(address) == nil {
+			break
+		}
+		host = address
+		if !isTrustedProxy(address) {
+			break
+		}
+	}
+	return host
+}
+
+// ClientUserAgent returns the request's user agent cut to the 255 bytes sessions and sign-in
+// attempts store, without splitting a character
+func ClientUserAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) <= 255 {
+		return userAgent
+	}
+	cut := 255
+	for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+		cut--
+	}
+	return userAgent[:cut]
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestClientUserAgentCutsOnCharacterBoundary(t *testing.T) {
+	for _, userAgent := range []string{
+		strings.Repeat("a", 300),
+		strings.Repeat("a", 254) + "é" + "tail",
+		strings.Repeat("日", 100),
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", userAgent)
+		got := ClientUserAgent(r)
+		if len(got) > 255 || !utf8.ValidString(got) || !strings.HasPrefix(userAgent, got) {
+			t.Errorf("ClientUserAgent cut %q to %q (%d bytes)", userAgent[:20], got, len(got))
+		}
+		if len(got) < 253 {
+			t.Errorf("ClientUserAgent cut %d bytes, want at most 3 dropped", len(userAgent)-len(got))
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "short")
+	if got := ClientUserAgent(r); got != "short" {
+		t.Errorf("ClientUserAgent = %q, want short", got)
+	}
+}
+
+func TestClientIPBehindTrustedProxies(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+
+	for _, tc := range []struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"203.0.113.5:4000", nil, "203.0.113.5"},
+		{"203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"}, // Not a proxy, so not believed
+		{"10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1, 192.0.2.7"}, "198.51.100.1"}, // Made-up hops are skipped
+		{"10.1.2.3:4000", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"10.1.2.3:4000", []string{"not-an-ip"}, "10.1.2.3"},
+		{"10.1.2.3:4000", nil, "10.1.2.3"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, value := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := ClientIP(r); got != tc.want {
+			t.Errorf("ClientIP(%s, %v) = %s, want %s", tc.remoteAddr, tc.forwarded, got, tc.want)
+		}
+	}
+
+	if err := SetTrustedProxies([]string{"not-a-network"}); err == nil {
+		t.Error("SetTrustedProxies accepted an invalid network")
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+// scopeAreas maps the protected routes, by path prefix, to the API token area they belong to.
+// Routes missing here, such as the account routes under /api/auth, refuse API tokens.
+var scopeAreas = []struct {
+	prefix string
+	area   string
+}{
+	{"/api/expenses", "expenses"},
+	{"/api/categories", "categories"},
+	{"/api/monthly-plans", "plans"},
+	{"/api/budget-period", "plans"},
+	{"/api/bank-accounts", "accounts"},
+	{"/api/loans", "loans"},
+	{"/api/recurring-items", "recurring"},
+	{"/api/zakat", "zakat"},
+	{"/api/notifications", "notifications"},
+	{"/api/reports", "reports"},
+	{"/api/analytics", "reports"},
+	{"/api/anomalies", "reports"},
+}
+
+// RequireScope checks requests made with an API token against the token's scopes: reads
+// need read access to the route's area and anything else needs write access. Requests
+// signed in with a JWT have full access. It must run after Auth.
+func RequireScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, isAPIToken := GetScopes(r)
+		if !isAPIToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		area := routeArea(r.URL.Path)
+		if area == "" {
+			http.Error(w, `{"error":"This endpoint cannot be used with an API token"}`, http.StatusForbidden)
+			return
+		}
+
+		action := "write"
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			action = "read"
+		}
+		if !models.ScopesAllow(scopes, area, action) {
+			http.Error(w, `{"error":"API token is missing the `+area+`:`+action+` scope"}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeArea returns the API token area of a path, or an empty string when it has none
+func routeArea(path string) string {
+	for _, entry := range scopeAreas {
+		if path == entry.prefix || strings.HasPrefix(path, entry.prefix+"/") {
+			return entry.area
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package middleware_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"github.com/abdelrahman/expense-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+// createAPIToken stores an API token with the given scopes and returns the token itself
+func createAPIToken(t *testing.T, db *gorm.DB, expiresAt *time.Time, scopes ...string) string {
+	t.Helper()
+	token, hash, err := utils.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.APIToken{
+		UserID:      1,
+		Name:        strings.Join(scopes, " "),
+		TokenPrefix: token[:12],
+		TokenHash:   hash,
+		Scopes:      strings.Join(scopes, ","),
+		ExpiresAt:   expiresAt,
+	}).Error; err != nil {
+		t.Fatalf("creating API token: %v", err)
+	}
+	return token
+}
+
+func TestRequireScope(t *testing.T) {
+	db := testutil.OpenDB(t)
+	utils.InitJWT("test-secret", 0)
+	expired := time.Now().Add(-time.Minute)
+	tokens := map[string]string{
+		"read":           createAPIToken(t, db, nil, models.ScopeRead),
+		"expenses:read":  createAPIToken(t, db, nil, "expenses:read"),
+		"expenses:write": createAPIToken(t, db, nil, "expenses:write"),
+		"expired":        createAPIToken(t, db, &expired, "expenses:write"),
+	}
+
+	session := models.Session{UserID: 1, LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+	jwt, err := utils.GenerateToken(1, "user@example.com", session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens["jwt"] = jwt
+
+	handler := middleware.Auth(middleware.RequireScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"read", http.MethodGet, "/api/expenses", http.StatusOK},
+		{"read", http.MethodGet, "/api/reports/trends/2026", http.StatusOK},
+		{"read", http.MethodPost, "/api/expenses", http.StatusForbidden},
+		{"read", http.MethodDelete, "/api/bank-accounts/1", http.StatusForbidden},
+		{"expenses:read", http.MethodGet, "/api/expenses/5", http.StatusOK},
+		{"expenses:read", http.MethodHead, "/api/expenses", http.StatusOK},
+		{"expenses:read", http.MethodPut, "/api/expenses/5", http.StatusForbidden},
+		{"expenses:read", http.MethodGet, "/api/categories", http.StatusForbidden},
+		{"expenses:read", http.MethodGet, "/api/expenses-export", http.StatusForbidden},
+		{"expenses:write", http.MethodPost, "/api/expenses", http.StatusOK},
+		{"expenses:write", http.MethodGet, "/api/expenses", http.StatusOK},
+		{"expenses:write", http.MethodPost, "/api/loans", http.StatusForbidden},
+		{"read", http.MethodGet, "/api/auth/me", http.StatusForbidden},
+		{"expenses:write", http.MethodPost, "/api/auth/change-password", http.StatusForbidden},
+		{"expenses:write", http.MethodPost, "/api/auth/api-tokens", http.StatusForbidden},
+		{"expired", http.MethodGet, "/api/expenses", http.StatusUnauthorized},
+		{"expired", http.MethodPost, "/api/expenses", http.StatusUnauthorized},
+		{"jwt", http.MethodPost, "/api/expenses", http.StatusOK},
+		{"jwt", http.MethodPost, "/api/auth/change-password", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := testutil.Request(t, tt.method, tt.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tokens[tt.token])
+		if got := testutil.Serve(handler.ServeHTTP, r).Code; got != tt.want {
+			t.Errorf("%s token: %s %s = %d, want %d", tt.token, tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	r := testutil.Request(t, http.MethodGet, "/api/expenses", nil)
+	r.Header.Set("Authorization", "Bearer "+utils.APITokenPrefix+"unknown")
+	if got := testutil.Serve(handler.ServeHTTP, r).Code; got != http.StatusUnauthorized {
+		t.Errorf("unknown API token: status %d, want 401", got)
+	}
+}
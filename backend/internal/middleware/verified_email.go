@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+// VerifiedEmail rejects requests that change data from users who have not verified their
+// email address. Reads and the account routes under /api/auth stay open so the user can
+// still look around, verify or fix their address. It must run after Auth.
+func VerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+			strings.HasPrefix(r.URL.Path, "/api/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, ok := GetUserID(r)
+		if !ok {
+			http.Error(w, `{"error":"User not authenticated"}`, http.StatusUnauthorized)
+			return
+		}
+
+		var user models.User
+		if err := database.GetDB().Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+			http.Error(w, `{"error":"User not found"}`, http.StatusUnauthorized)
+			return
+		}
+		if !user.IsEmailVerified() {
+			http.Error(w, `{"error":"Verify your email address to make changes"}`, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ScopeRead gives an API token read-only access to every area
+const ScopeRead = "read"
+
+// APITokenAreas are the parts of the API a token can be scoped to, as "<area>:read" or
+// "<area>:write". Write access to an area includes reading it.
+var APITokenAreas = []string{
+	"expenses",
+	"categories",
+	"plans",
+	"accounts",
+	"loans",
+	"recurring",
+	"zakat",
+	"notifications",
+	"reports",
+}
+
+// APITokenUsedInterval is how stale a token's last used time may get before a request refreshes it
+const APITokenUsedInterval = time.Minute
+
+// APIToken is a long-lived token a user creates for scripts and integrations. It is limited
+// to its scopes and never reaches the account routes. Only the hash of the token is stored.
+type APIToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	TokenPrefix string     `json:"token_prefix" gorm:"size:16;not null"` // Start of the token, to tell tokens apart
+	TokenHash   string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes      string     `json:"-" gorm:"size:500;not null"` // Comma-separated
+	ScopeList   []string   `json:"scopes" gorm:"-"`            // Scopes split for responses
+	ExpiresAt   *time.Time `json:"expires_at"`                 // Nil for a token that does not expire
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip" gorm:"size:45"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// GetScopes returns the scopes of the token
+func (t *APIToken) GetScopes() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// IsExpired reports whether the token has passed its expiry
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && !time.Now().Before(*t.ExpiresAt)
+}
+
+// IsValidScope reports whether a scope is one a token can be given
+func IsValidScope(scope string) bool {
+	if scope == ScopeRead {
+		return true
+	}
+	area, action, found := strings.Cut(scope, ":")
+	if !found || (action != "read" && action != "write") {
+		return false
+	}
+	for _, known := range APITokenAreas {
+		if area == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopesAllow reports whether a set of scopes covers an action ("read" or "write") on an area
+func ScopesAllow(scopes []string, area, action string) bool {
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeRead:
+			if action == "read" {
+				return true
+			}
+		case area + ":write":
+			return true
+		case area + ":" + action:
+			return true
+		}
+	}
+	return false
+}
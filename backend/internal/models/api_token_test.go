@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+func TestScopesAllow(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		area   string
+		action string
+		want   bool
+	}{
+		{[]string{"read"}, "expenses", "read", true},
+		{[]string{"read"}, "zakat", "read", true},
+		{[]string{"read"}, "expenses", "write", false},
+		{[]string{"expenses:read"}, "expenses", "read", true},
+		{[]string{"expenses:read"}, "expenses", "write", false},
+		{[]string{"expenses:read"}, "categories", "read", false},
+		{[]string{"expenses:write"}, "expenses", "write", true},
+		{[]string{"expenses:write"}, "expenses", "read", true},
+		{[]string{"expenses:write"}, "loans", "write", false},
+		{[]string{"read", "loans:write"}, "loans", "write", true},
+		{[]string{"read", "loans:write"}, "expenses", "write", false},
+		{[]string{}, "expenses", "read", false},
+		{nil, "reports", "read", false},
+	}
+	for _, tt := range tests {
+		if got := models.ScopesAllow(tt.scopes, tt.area, tt.action); got != tt.want {
+			t.Errorf("ScopesAllow(%v, %s, %s) = %v, want %v", tt.scopes, tt.area, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidScope(t *testing.T) {
+	for scope, want := range map[string]bool{
+		"read":            true,
+		"expenses:read":   true,
+		"reports:write":   true,
+		"write":           false,
+		"expenses":        false,
+		"expenses:delete": false,
+		"auth:read":       false,
+		"":                false,
+	} {
+		if got := models.IsValidScope(scope); got != want {
+			t.Errorf("IsValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestAPITokenIsExpired(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	for name, tt := range map[string]struct {
+		expiresAt *time.Time
+		want      bool
+	}{
+		"no expiry": {nil, false},
+		"expired":   {&past, true},
+		"unexpired": {&future, false},
+	} {
+		token := models.APIToken{ExpiresAt: tt.expiresAt}
+		if got := token.IsExpired(); got != tt.want {
+			t.Errorf("%s: IsExpired() = %v, want %v", name, got, tt.want)
+		}
+	}
+}
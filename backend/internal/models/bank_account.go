@@ -1,26 +1,137 @@
 package models
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Account types
+const (
+	AccountTypeChecking     = "Checking"
+	AccountTypeSavings      = "Savings"
+	AccountTypeCreditCard   = "Credit Card"
+	AccountTypeInvestment   = "Investment"
+	AccountTypeMoneyMarket  = "Money Market"
+	AccountTypeCD           = "CD"
+	AccountTypeCash         = "Cash"
+	AccountTypeLoan         = "Loan"
+	AccountTypeMortgage     = "Mortgage"
+	AccountTypeLineOfCredit = "Line of Credit"
 )
 
+// accountTypeAliases maps lower-cased spellings to their canonical account type
+var accountTypeAliases = map[string]string{
+	"checking":       AccountTypeChecking,
+	"current":        AccountTypeChecking,
+	"savings":        AccountTypeSavings,
+	"saving":         AccountTypeSavings,
+	"credit card":    AccountTypeCreditCard,
+	"credit_card":    AccountTypeCreditCard,
+	"credit":         AccountTypeCreditCard,
+	"investment":     AccountTypeInvestment,
+	"money market":   AccountTypeMoneyMarket,
+	"money_market":   AccountTypeMoneyMarket,
+	"cd":             AccountTypeCD,
+	"cash":           AccountTypeCash,
+	"loan":           AccountTypeLoan,
+	"mortgage":       AccountTypeMortgage,
+	"line of credit": AccountTypeLineOfCredit,
+	"line_of_credit": AccountTypeLineOfCredit,
+}
+
+// liabilityAccountTypes lists account types whose balance is money owed
+var liabilityAccountTypes = map[string]bool{
+	AccountTypeCreditCard:   true,
+	AccountTypeLoan:         true,
+	AccountTypeMortgage:     true,
+	AccountTypeLineOfCredit: true,
+}
+
 type BankAccount struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	UserID        uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
-	AccountName   string    `json:"account_name" gorm:"size:100;not null"`
-	BankName      string    `json:"bank_name" gorm:"size:100;not null"`
-	AccountType   string    `json:"account_type" gorm:"size:50;not null"` // Checking, Savings, Credit Card, etc.
-	Balance       float64   `json:"balance" gorm:"type:decimal(10,2);default:0"`
-	Currency      string    `json:"currency" gorm:"size:3;default:ِSAR"`    // ISO currency code
-	AccountNumber string    `json:"account_number" gorm:"size:20;not null"` // Last 4 digits recommended
-	IsActive      bool      `json:"is_active" gorm:"default:true"`
-	Color         string    `json:"color" gorm:"size:7;default:#3B82F6"`
-	Icon          string    `json:"icon" gorm:"size:50;default:bank"`
-	Notes         string    `json:"notes" gorm:"type:text"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint    `json:"id" gorm:"primaryKey"`
+	UserID        uint    `json:"user_id" gorm:"not null;index:idx_user_id"`
+	AccountName   string  `json:"account_name" gorm:"size:100;not null"`
+	BankName      string  `json:"bank_name" gorm:"size:100;not null"`
+	AccountType   string  `json:"account_type" gorm:"size:50;not null"` // One of the AccountType constants
+	Balance       float64 `json:"balance" gorm:"type:decimal(10,2);default:0"`
+	Currency      string  `json:"currency" gorm:"size:3;default:ِSAR"`    // ISO currency code
+	AccountNumber string  `json:"account_number" gorm:"size:20;not null"` // Last 4 digits recommended
+	IsActive      bool    `json:"is_active" gorm:"default:true"`
+	Color         string  `json:"color" gorm:"size:7;default:#3B82F6"`
+	Icon          string  `json:"icon" gorm:"size:50;default:bank"`
+	Notes         string  `json:"notes" gorm:"type:text"`
+
+	// Credit cards and lines of credit may go negative down to their credit limit,
+	// other accounts down to their overdraft allowance
+	CreditLimit    float64 `json:"credit_limit" gorm:"type:decimal(10,2);default:0"`
+	OverdraftLimit float64 `json:"overdraft_limit" gorm:"type:decimal(10,2);default:0"`
+
+	// Credit card statement cycle
+	StatementClosingDay   int     `json:"statement_closing_day" gorm:"default:0"` // 1-31, clamped to the month length
+	PaymentDueDay         int     `json:"payment_due_day" gorm:"default:0"`       // 1-31, first occurrence after closing
+	MinimumPaymentPercent float64 `json:"minimum_payment_percent" gorm:"type:decimal(5,2);default:5"`
+	MinimumPaymentAmount  float64 `json:"minimum_payment_amount" gorm:"type:decimal(10,2);default:0"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"` // Deleted accounts are kept for their balance history
 }
 
 func (BankAccount) TableName() string {
 	return "bank_accounts"
 }
+
+// NormalizeAccountType returns the canonical account type for a user supplied value
+func NormalizeAccountType(input string) (string, error) {
+	if accountType, ok := accountTypeAliases[strings.ToLower(strings.TrimSpace(input))]; ok {
+		return accountType, nil
+	}
+	return "", errors.New("Account type must be one of Checking, Savings, Credit Card, Investment, Money Market, CD, Cash, Loan, Mortgage or Line of Credit")
+}
+
+// AccountTypeAliases returns every accepted spelling with its canonical account type
+func AccountTypeAliases() map[string]string {
+	aliases := make(map[string]string, len(accountTypeAliases))
+	for alias, accountType := range accountTypeAliases {
+		aliases[alias] = accountType
+	}
+	return aliases
+}
+
+// IsLiability reports whether the account represents money owed rather than held
+func (a *BankAccount) IsLiability() bool {
+	accountType, err := NormalizeAccountType(a.AccountType)
+	return err == nil && liabilityAccountTypes[accountType]
+}
+
+// IsCreditCard reports whether the account is a credit card
+func (a *BankAccount) IsCreditCard() bool {
+	accountType, err := NormalizeAccountType(a.AccountType)
+	return err == nil && accountType == AccountTypeCreditCard
+}
+
+// HasStatementCycle reports whether the account has statement closing and due days configured
+func (a *BankAccount) HasStatementCycle() bool {
+	return a.StatementClosingDay > 0 && a.PaymentDueDay > 0
+}
+
+// MinimumAllowedBalance returns the lowest balance a debit may leave the account at
+func (a *BankAccount) MinimumAllowedBalance() float64 {
+	accountType, _ := NormalizeAccountType(a.AccountType)
+	switch accountType {
+	case AccountTypeCreditCard, AccountTypeLineOfCredit:
+		// A card without a configured limit is not capped
+		if a.CreditLimit <= 0 {
+			return math.Inf(-1)
+		}
+		return -a.CreditLimit
+	case AccountTypeLoan, AccountTypeMortgage:
+		return math.Inf(-1)
+	default:
+		return -a.OverdraftLimit
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ReconciliationStatusInProgress = "in_progress"
+	ReconciliationStatusCompleted  = "completed"
+)
+
+// BankAccountReconciliation matches an account's cleared transactions against a bank statement
+type BankAccountReconciliation struct {
+	ID                      uint       `json:"id" gorm:"primaryKey"`
+	UserID                  uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	BankAccountID           uint       `json:"bank_account_id" gorm:"not null;index:idx_bank_account_id"`
+	StatementDate           time.Time  `json:"statement_date" gorm:"type:date;not null"`
+	StatementBalance        float64    `json:"statement_balance" gorm:"type:decimal(10,2);not null"`
+	Status                  string     `json:"status" gorm:"size:20;not null;default:in_progress"`
+	AdjustmentAmount        float64    `json:"adjustment_amount" gorm:"type:decimal(10,2);default:0"`
+	AdjustmentTransactionID *uint      `json:"adjustment_transaction_id"`
+	ClearedCount            int64      `json:"cleared_count" gorm:"default:0"`
+	CompletedAt             *time.Time `json:"completed_at"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+func (BankAccountReconciliation) TableName() string {
+	return "bank_account_reconciliations"
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BankAccountSnapshot records the balance of a bank account at the end of a day
+type BankAccountSnapshot struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
+	BankAccountID uint      `json:"bank_account_id" gorm:"not null;uniqueIndex:idx_account_snapshot_date"`
+	SnapshotDate  time.Time `json:"snapshot_date" gorm:"type:date;not null;uniqueIndex:idx_account_snapshot_date"`
+	Balance       float64   `json:"balance" gorm:"type:decimal(10,2);not null"`
+	Currency      string    `json:"currency" gorm:"size:3"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (BankAccountSnapshot) TableName() string {
+	return "bank_account_snapshots"
+}
+
+// RecordBalanceSnapshot stores the account's current balance as today's snapshot,
+// replacing any snapshot already taken for the same day
+func RecordBalanceSnapshot(db *gorm.DB, account *BankAccount) error {
+	now := time.Now()
+	snapshot := BankAccountSnapshot{
+		UserID:        account.UserID,
+		BankAccountID: account.ID,
+		SnapshotDate:  time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local),
+		Balance:       account.Balance,
+		Currency:      account.Currency,
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bank_account_id"}, {Name: "snapshot_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"balance", "currency", "updated_at"}),
+	}).Create(&snapshot).Error
+}
+
+// AdjustSnapshotsSince shifts the stored balances of snapshots taken on or after
+// the given date, used when a back-dated transaction changes past balances
+func AdjustSnapshotsSince(db *gorm.DB, bankAccountID uint, since time.Time, delta float64) error {
+	return db.Model(&BankAccountSnapshot{}).
+		Where("bank_account_id = ? AND snapshot_date >= ?", bankAccountID, since).
+		Update("balance", gorm.Expr("balance + ?", delta)).Error
+}
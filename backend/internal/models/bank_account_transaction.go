@@ -3,15 +3,34 @@ package models
 import "time"
 
 type BankAccountTransaction struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	UserID        uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
-	BankAccountID uint      `json:"bank_account_id" gorm:"not null;index:idx_bank_account_id"`
-	Type          string    `json:"type" gorm:"size:10;not null"` // credit or debit
-	Amount        float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
-	Description   string    `json:"description" gorm:"type:text"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	UserID           uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
+	BankAccountID    uint      `json:"bank_account_id" gorm:"not null;index:idx_bank_account_id"`
+	Type             string    `json:"type" gorm:"size:10;not null"` // credit or debit
+	Amount           float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
+	Description      string    `json:"description" gorm:"type:text"`
+	ValueDate        time.Time `json:"value_date" gorm:"type:date;index:idx_value_date"`     // Date the money moved; CreatedAt is the booking date
+	Cleared          bool      `json:"cleared" gorm:"default:false"`                         // Ticked off against a bank statement
+	ReconciliationID *uint     `json:"reconciliation_id" gorm:"index:idx_reconciliation_id"` // Set once locked by a completed reconciliation
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 func (BankAccountTransaction) TableName() string {
 	return "bank_account_transactions"
 }
+
+// SignedAmountSQL is the SQL expression for a transaction's effect on the balance
+const SignedAmountSQL = "CASE WHEN type = 'credit' THEN amount ELSE -amount END"
+
+// IsLocked reports whether a completed reconciliation has locked the transaction
+func (t *BankAccountTransaction) IsLocked() bool {
+	return t.ReconciliationID != nil
+}
+
+// SignedAmount returns the transaction's effect on the account balance
+func (t *BankAccountTransaction) SignedAmount() float64 {
+	if t.Type == "credit" {
+		return t.Amount
+	}
+	return -t.Amount
+}
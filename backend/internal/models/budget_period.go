@@ -0,0 +1,178 @@
+package models
+
+import (
+	"time"
+)
+
+// Budget period types
+const (
+	BudgetPeriodMonthly  = "monthly"
+	BudgetPeriodWeekly   = "weekly"
+	BudgetPeriodBiweekly = "biweekly"
+)
+
+// Adjustments for a monthly period start that falls on a weekend or holiday
+const (
+	PeriodAdjustNone     = "none"
+	PeriodAdjustPrevious = "previous" // Earlier business day, how Saudi salaries are paid
+	PeriodAdjustNext     = "next"
+)
+
+// BudgetPeriod defines how a user's budget periods are cut, e.g. from one salary day to the next
+type BudgetPeriod struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Type        string     `json:"type" gorm:"size:10;not null;default:monthly"` // monthly, weekly or biweekly
+	StartDay    int        `json:"start_day" gorm:"not null;default:1"`          // Monthly: 1-31, clamped to the month length
+	Adjustment  string     `json:"adjustment" gorm:"size:10;not null;default:none"`
+	WeekendDays []int      `json:"weekend_days" gorm:"serializer:json;type:text"` // 0 = Sunday; Friday and Saturday when empty
+	Holidays    []string   `json:"holidays" gorm:"serializer:json;type:text"`     // YYYY-MM-DD
+	AnchorDate  *time.Time `json:"anchor_date" gorm:"type:date"`                  // Weekly and bi-weekly: any day a period starts on
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (BudgetPeriod) TableName() string {
+	return "budget_periods"
+}
+
+// Period is one budget period covering [Start, End). Monthly periods carry the month
+// whose plans they are budgeted against; weekly periods leave Year and Month zero.
+type Period struct {
+	Start time.Time
+	End   time.Time
+	Year  int
+	Month int
+}
+
+// CalendarMonth returns the calendar month as a period
+func CalendarMonth(year, month int) Period {
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.Local)
+	return Period{Start: start, End: start.AddDate(0, 1, 0), Year: year, Month: month}
+}
+
+// IsMonthly reports whether periods are labelled by month
+func (p *BudgetPeriod) IsMonthly() bool {
+	return p.Type == "" || p.Type == BudgetPeriodMonthly
+}
+
+// IsCalendarMonth reports whether the periods are plain calendar months
+func (p *BudgetPeriod) IsCalendarMonth() bool {
+	return p.IsMonthly() && p.StartDay <= 1 && (p.Adjustment == "" || p.Adjustment == PeriodAdjustNone)
+}
+
+// Length returns the number of days of a weekly or bi-weekly period
+func (p *BudgetPeriod) Length() int {
+	if p.Type == BudgetPeriodBiweekly {
+		return 14
+	}
+	return 7
+}
+
+// MonthPeriod returns the monthly period budgeted against a month. A period starting
+// on day 15 or earlier belongs to the month it starts in, a later one to the next month,
+// so a period from the 27th of January to the 26th of February is February's.
+func (p *BudgetPeriod) MonthPeriod(year, month int) Period {
+	if p.IsCalendarMonth() {
+		return CalendarMonth(year, month)
+	}
+
+	startMonth := time.Month(month)
+	if p.StartDay > 15 {
+		startMonth--
+	}
+	return Period{
+		Start: p.monthStart(year, startMonth),
+		End:   p.monthStart(year, startMonth+1),
+		Year:  year,
+		Month: month,
+	}
+}
+
+// Containing returns the period the given day falls in
+func (p *BudgetPeriod) Containing(day time.Time) Period {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+
+	if !p.IsMonthly() {
+		anchor := day
+		if p.AnchorDate != nil {
+			anchor = time.Date(p.AnchorDate.Year(), p.AnchorDate.Month(), p.AnchorDate.Day(), 0, 0, 0, 0, time.Local)
+		}
+		length := p.Length()
+		offset := DaysBetween(anchor, day) % length
+		if offset < 0 {
+			offset += length
+		}
+		start := day.AddDate(0, 0, -offset)
+		return Period{Start: start, End: start.AddDate(0, 0, length)}
+	}
+
+	// Adjusted starts move by a few days at most, so the period is labelled by a neighbouring month
+	for offset := -1; offset <= 1; offset++ {
+		month := time.Date(day.Year(), day.Month()+time.Month(offset), 1, 0, 0, 0, 0, time.Local)
+		period := p.MonthPeriod(month.Year(), int(month.Month()))
+		if !day.Before(period.Start) && day.Before(period.End) {
+			return period
+		}
+	}
+	return CalendarMonth(day.Year(), int(day.Month()))
+}
+
+// IsWeekend reports whether a day falls on one of the weekend days
+func (p *BudgetPeriod) IsWeekend(day time.Time) bool {
+	weekend := p.WeekendDays
+	if len(weekend) == 0 {
+		weekend = []int{int(time.Friday), int(time.Saturday)}
+	}
+	for _, weekday := range weekend {
+		if int(day.Weekday()) == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBusinessDay reports whether a day is neither a weekend day nor a holiday
+func (p *BudgetPeriod) IsBusinessDay(day time.Time) bool {
+	if p.IsWeekend(day) {
+		return false
+	}
+
+	key := day.Format("2006-01-02")
+	for _, holiday := range p.Holidays {
+		if holiday == key {
+			return false
+		}
+	}
+	return true
+}
+
+// monthStart returns the day a period starts in the given month after the weekend and holiday adjustment
+func (p *BudgetPeriod) monthStart(year int, month time.Month) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	day := p.StartDay
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	start := first.AddDate(0, 0, day-1)
+
+	step := 0
+	switch p.Adjustment {
+	case PeriodAdjustPrevious:
+		step = -1
+	case PeriodAdjustNext:
+		step = 1
+	}
+	// Give up after two weeks so a misconfigured weekend cannot loop forever
+	for i := 0; step != 0 && i < 14 && !p.IsBusinessDay(start); i++ {
+		start = start.AddDate(0, 0, step)
+	}
+	return start
+}
+
+// DaysBetween returns the number of calendar days from a to b
+func DaysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
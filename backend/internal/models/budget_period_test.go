@@ -0,0 +1,109 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+)
+
+// day parses a YYYY-MM-DD date as local midnight, as periods are
+func day(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func checkPeriod(t *testing.T, name string, got models.Period, start, end string) {
+	t.Helper()
+	if !got.Start.Equal(day(start)) || !got.End.Equal(day(end)) {
+		t.Errorf("%s = %s..%s, want %s..%s", name,
+			got.Start.Format("2006-01-02"), got.End.Format("2006-01-02"), start, end)
+	}
+}
+
+func TestMonthPeriod(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    models.BudgetPeriod
+		year, month int
+		start, end  string
+	}{
+		{"calendar", models.BudgetPeriod{StartDay: 1}, 2026, 2, "2026-02-01", "2026-03-01"},
+		{"early start day", models.BudgetPeriod{StartDay: 10}, 2026, 2, "2026-02-10", "2026-03-10"},
+		{"late start day", models.BudgetPeriod{StartDay: 27}, 2026, 2, "2026-01-27", "2026-02-27"},
+		{"start day 15", models.BudgetPeriod{StartDay: 15}, 2026, 12, "2026-12-15", "2027-01-15"},
+		{"late start across a year", models.BudgetPeriod{StartDay: 25}, 2026, 1, "2025-12-25", "2026-01-25"},
+		{"clamped to the month", models.BudgetPeriod{StartDay: 31}, 2026, 3, "2026-02-28", "2026-03-31"},
+		// The 27th of February and March 2026 are Fridays
+		{"weekend moves back", models.BudgetPeriod{StartDay: 27, Adjustment: models.PeriodAdjustPrevious}, 2026, 3, "2026-02-26", "2026-03-26"},
+		{"weekend moves forward", models.BudgetPeriod{StartDay: 27, Adjustment: models.PeriodAdjustNext}, 2026, 3, "2026-03-01", "2026-03-29"},
+		{"custom weekend", models.BudgetPeriod{StartDay: 27, Adjustment: models.PeriodAdjustPrevious, WeekendDays: []int{0, 6}}, 2026, 3, "2026-02-27", "2026-03-27"},
+		{"holiday", models.BudgetPeriod{StartDay: 26, Adjustment: models.PeriodAdjustPrevious, Holidays: []string{"2026-02-26"}}, 2026, 3, "2026-02-25", "2026-03-26"},
+	}
+	for _, tt := range tests {
+		period := tt.settings.MonthPeriod(tt.year, tt.month)
+		checkPeriod(t, tt.name, period, tt.start, tt.end)
+		if period.Year != tt.year || period.Month != tt.month {
+			t.Errorf("%s: labelled %d-%02d, want %d-%02d", tt.name, period.Year, period.Month, tt.year, tt.month)
+		}
+	}
+}
+
+func TestContainingMonthly(t *testing.T) {
+	settings := models.BudgetPeriod{StartDay: 27, Adjustment: models.PeriodAdjustNext}
+	tests := []struct {
+		day        string
+		start, end string
+		month      int
+	}{
+		{"2026-01-26", "2025-12-28", "2026-01-27", 1},
+		{"2026-01-27", "2026-01-27", "2026-03-01", 2},
+		// Moved past the end of February, so still February's period
+		{"2026-02-28", "2026-01-27", "2026-03-01", 2},
+		{"2026-03-01", "2026-03-01", "2026-03-29", 3},
+	}
+	for _, tt := range tests {
+		period := settings.Containing(day(tt.day))
+		checkPeriod(t, "period containing "+tt.day, period, tt.start, tt.end)
+		if period.Month != tt.month {
+			t.Errorf("period containing %s is labelled month %d, want %d", tt.day, period.Month, tt.month)
+		}
+	}
+
+	calendar := models.BudgetPeriod{}
+	checkPeriod(t, "calendar month containing 2026-02-28 15:00",
+		calendar.Containing(day("2026-02-28").Add(15*time.Hour)), "2026-02-01", "2026-03-01")
+}
+
+func TestContainingWeekly(t *testing.T) {
+	anchor := day("2026-01-05")
+	weekly := models.BudgetPeriod{Type: models.BudgetPeriodWeekly, AnchorDate: &anchor}
+	biweekly := models.BudgetPeriod{Type: models.BudgetPeriodBiweekly, AnchorDate: &anchor}
+	tests := []struct {
+		name       string
+		settings   models.BudgetPeriod
+		day        string
+		start, end string
+	}{
+		{"weekly on the anchor", weekly, "2026-01-05", "2026-01-05", "2026-01-12"},
+		{"weekly after the anchor", weekly, "2026-01-14", "2026-01-12", "2026-01-19"},
+		{"weekly before the anchor", weekly, "2026-01-01", "2025-12-29", "2026-01-05"},
+		{"bi-weekly", biweekly, "2026-01-14", "2026-01-05", "2026-01-19"},
+		{"bi-weekly next period", biweekly, "2026-01-19", "2026-01-19", "2026-02-02"},
+		{"bi-weekly before the anchor", biweekly, "2026-01-04", "2025-12-22", "2026-01-05"},
+	}
+	for _, tt := range tests {
+		period := tt.settings.Containing(day(tt.day))
+		checkPeriod(t, tt.name, period, tt.start, tt.end)
+		if period.Year != 0 || period.Month != 0 {
+			t.Errorf("%s: labelled %d-%02d, want no month", tt.name, period.Year, period.Month)
+		}
+	}
+
+	// Without an anchor, a week starts on the day asked about
+	unanchored := models.BudgetPeriod{Type: models.BudgetPeriodWeekly}
+	checkPeriod(t, "unanchored week", unanchored.Containing(day("2026-01-14")), "2026-01-14", "2026-01-21")
+}
@@ -5,14 +5,19 @@ import (
 )
 
 type Category struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	UserID      uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
-	Name        string    `json:"name" gorm:"size:100;not null"`
-	Description string    `json:"description" gorm:"type:text"`
-	Color       string    `json:"color" gorm:"size:7;default:#3B82F6"`
-	Icon        string    `json:"icon" gorm:"size:50;default:receipt"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	UserID      uint   `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Name        string `json:"name" gorm:"size:100;not null"`
+	Description string `json:"description" gorm:"type:text"`
+	Color       string `json:"color" gorm:"size:7;default:#3B82F6"`
+	Icon        string `json:"icon" gorm:"size:50;default:receipt"`
+
+	// Default VAT applied to expenses in this category
+	TaxRate        *float64 `json:"tax_rate" gorm:"type:decimal(5,2)"` // Percent, nil when no VAT applies
+	TaxReclaimable bool     `json:"tax_reclaimable" gorm:"default:false"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (Category) TableName() string {
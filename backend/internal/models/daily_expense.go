@@ -9,11 +9,24 @@ type DailyExpense struct {
 	UserID      uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
 	Amount      float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
 	Description string    `json:"description" gorm:"type:text"`
+	Merchant    string    `json:"merchant" gorm:"size:100;index:idx_merchant"`
 	ExpenseDate time.Time `json:"expense_date" gorm:"type:date;not null;index:idx_expense_date"`
+	HijriDate   string    `json:"expense_date_hijri,omitempty" gorm:"-"` // Set when the user displays Hijri dates
 	CategoryID  *uint     `json:"category_id" gorm:"index:idx_category_id"`
 	Category    *Category `json:"category,omitempty" gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+
+	Tags []ExpenseTag `json:"tags" gorm:"foreignKey:ExpenseID;constraint:OnDelete:CASCADE"`
+
+	// Account the expense was debited from, set when a payment was posted to one
+	BankAccountID *uint `json:"bank_account_id" gorm:"index:idx_expense_bank_account_id"`
+
+	// VAT included in Amount, which is always the gross amount paid
+	TaxRate        *float64 `json:"tax_rate" gorm:"type:decimal(5,2)"` // Percent, nil when no VAT applies
+	TaxAmount      float64  `json:"tax_amount" gorm:"type:decimal(10,2);default:0"`
+	TaxReclaimable bool     `json:"tax_reclaimable" gorm:"default:false"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (DailyExpense) TableName() string {
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailVerificationToken confirms that a user controls an email address. When Email differs
+// from the user's current address, using the token switches the account to it.
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Email     string     `json:"email" gorm:"size:255;not null"` // Address the token was sent to
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (EmailVerificationToken) TableName() string {
+	return "email_verification_tokens"
+}
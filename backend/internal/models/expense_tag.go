@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// MaxExpenseTags limits how many tags one expense can carry
+const MaxExpenseTags = 10
+
+// ExpenseTag labels an expense with a free-form tag, such as a trip or a project. It is
+// sent and received in JSON as just its name.
+type ExpenseTag struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index:idx_user_tag"`
+	ExpenseID uint   `gorm:"not null;uniqueIndex:idx_expense_tag"`
+	Name      string `gorm:"size:50;not null;uniqueIndex:idx_expense_tag;index:idx_user_tag"`
+}
+
+func (ExpenseTag) TableName() string {
+	return "expense_tags"
+}
+
+func (t ExpenseTag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+func (t *ExpenseTag) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Name)
+}
+
+// NormalizeTags trims and lower-cases tag names and drops duplicates and empty names
+func NormalizeTags(tags []ExpenseTag) ([]string, error) {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		name := strings.ToLower(strings.TrimSpace(tag.Name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > 50 {
+			return nil, errors.New("Tags must be at most 50 characters")
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) > MaxExpenseTags {
+		return nil, fmt.Errorf("An expense can have at most %d tags", MaxExpenseTags)
+	}
+	return names, nil
+}
+
+// ReplaceExpenseTags sets the tags of an expense to the given names
+func ReplaceExpenseTags(db *gorm.DB, expense *DailyExpense, names []string) error {
+	if err := db.Where("expense_id = ?", expense.ID).Delete(&ExpenseTag{}).Error; err != nil {
+		return err
+	}
+
+	expense.Tags = make([]ExpenseTag, 0, len(names))
+	for _, name := range names {
+		expense.Tags = append(expense.Tags, ExpenseTag{UserID: expense.UserID, ExpenseID: expense.ID, Name: name})
+	}
+	if len(expense.Tags) == 0 {
+		return nil
+	}
+	return db.Create(&expense.Tags).Error
+}
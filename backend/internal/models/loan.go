@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+)
+
+// Loan statuses
+const (
+	LoanStatusActive  = "active"
+	LoanStatusPaidOff = "paid_off"
+)
+
+// Installment statuses
+const (
+	InstallmentStatusPending = "pending"
+	InstallmentStatusPaid    = "paid"
+)
+
+// Loan is a purchase or financing repaid in scheduled installments, such as a
+// personal loan or a buy-now-pay-later plan (Tabby, Tamara)
+type Loan struct {
+	ID               uint              `json:"id" gorm:"primaryKey"`
+	UserID           uint              `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Name             string            `json:"name" gorm:"size:100;not null"`
+	Provider         string            `json:"provider" gorm:"size:100"`
+	Principal        float64           `json:"principal" gorm:"type:decimal(10,2);not null"`
+	ProfitRate       float64           `json:"profit_rate" gorm:"type:decimal(6,3);default:0"` // Flat annual rate in percent
+	TotalAmount      float64           `json:"total_amount" gorm:"type:decimal(10,2);not null"`
+	Currency         string            `json:"currency" gorm:"size:3;default:SAR"`
+	InstallmentCount int               `json:"installment_count" gorm:"not null"`
+	Frequency        string            `json:"frequency" gorm:"size:10;not null;default:monthly"` // weekly, biweekly or monthly
+	StartDate        time.Time         `json:"start_date" gorm:"type:date;not null"`
+	FirstDueDate     time.Time         `json:"first_due_date" gorm:"type:date;not null"`
+	BankAccountID    *uint             `json:"bank_account_id" gorm:"index:idx_bank_account_id"`
+	CategoryID       *uint             `json:"category_id" gorm:"index:idx_category_id"`
+	Category         *Category         `json:"category,omitempty" gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
+	Status           string            `json:"status" gorm:"size:20;not null;default:active"`
+	Notes            string            `json:"notes" gorm:"type:text"`
+	Installments     []LoanInstallment `json:"installments,omitempty" gorm:"foreignKey:LoanID;constraint:OnDelete:CASCADE"`
+	RemainingAmount  float64           `json:"remaining_amount" gorm:"-"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+func (Loan) TableName() string {
+	return "loans"
+}
+
+// LoanInstallment is one scheduled repayment of a loan
+type LoanInstallment struct {
+	ID                       uint       `json:"id" gorm:"primaryKey"`
+	UserID                   uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	LoanID                   uint       `json:"loan_id" gorm:"not null;index:idx_loan_id"`
+	Sequence                 int        `json:"sequence" gorm:"not null"`
+	DueDate                  time.Time  `json:"due_date" gorm:"type:date;not null;index:idx_due_date"`
+	Amount                   float64    `json:"amount" gorm:"type:decimal(10,2);not null"`
+	PrincipalPortion         float64    `json:"principal_portion" gorm:"type:decimal(10,2);not null"`
+	ProfitPortion            float64    `json:"profit_portion" gorm:"type:decimal(10,2);not null"`
+	Status                   string     `json:"status" gorm:"size:20;not null;default:pending"`
+	PaidAt                   *time.Time `json:"paid_at" gorm:"type:date"`
+	ExpenseID                *uint      `json:"expense_id"`
+	BankAccountTransactionID *uint      `json:"bank_account_transaction_id"`
+	CreatedAt                time.Time  `json:"created_at"`
+	UpdatedAt                time.Time  `json:"updated_at"`
+}
+
+func (LoanInstallment) TableName() string {
+	return "loan_installments"
+}
+
+// IsPaid reports whether the installment has been paid
+func (i *LoanInstallment) IsPaid() bool {
+	return i.Status == InstallmentStatusPaid
+}
+
+// RemainingAt returns what is still owed on the loan at the end of a day, or zero
+// if the loan had not started yet. Installments must be loaded.
+func (l *Loan) RemainingAt(day time.Time) float64 {
+	key := day.Format("2006-01-02")
+	if l.StartDate.Format("2006-01-02") > key {
+		return 0
+	}
+
+	remaining := 0.0
+	for i := range l.Installments {
+		installment := &l.Installments[i]
+		if !installment.IsPaid() || installment.PaidAt == nil || installment.PaidAt.Format("2006-01-02") > key {
+			remaining += installment.Amount
+		}
+	}
+	return remaining
+}
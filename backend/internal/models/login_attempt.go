@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Outcomes of a sign-in attempt, kept for the audit trail. Throttling counts failures in
+// LoginThrottle instead.
+const (
+	LoginSucceeded          = "succeeded"
+	LoginMFARequired        = "mfa_required" // Password accepted, second factor still to come
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginInvalidMFACode     = "invalid_mfa_code"
+	LoginThrottled          = "throttled"
+)
+
+// LoginAttempt records a sign-in attempt for throttling and as an audit trail. Attempts are
+// keyed by the email typed in, whether or not an account has it, so throttling behaves the
+// same for unknown addresses.
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"size:255;not null;index:idx_email_created"`
+	UserID    *uint     `json:"user_id" gorm:"index:idx_user_id"` // Nil when no account has the email
+	IPAddress string    `json:"ip_address" gorm:"size:45;not null;index:idx_ip_created"`
+	UserAgent string    `json:"user_agent" gorm:"size:255"`
+	Outcome   string    `json:"outcome" gorm:"size:30;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_email_created;index:idx_ip_created"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
+
+// LoginThrottle counts the recent failed sign-ins of an email or an IP address. An attempt is
+// checked and counted under the row's lock, before its password is, so parallel guesses
+// cannot all pass the check before any of them counts.
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"column:throttle_key;primaryKey;size:300"` // "email:<address>" or "ip:<address>"
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
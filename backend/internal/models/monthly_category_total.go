@@ -0,0 +1,195 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MonthlyCategoryTotal is the rollup of a user's expenses in one calendar month and category,
+// kept up to date as expenses change so long-range reports need not scan every expense
+type MonthlyCategoryTotal struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_monthly_category_total"`
+	Year         int       `json:"year" gorm:"not null;uniqueIndex:idx_monthly_category_total"`
+	Month        int       `json:"month" gorm:"not null;uniqueIndex:idx_monthly_category_total"`
+	CategoryID   uint      `json:"category_id" gorm:"not null;default:0;uniqueIndex:idx_monthly_category_total"` // 0 for uncategorized expenses
+	TotalAmount  float64   `json:"total_amount" gorm:"type:decimal(14,2);not null;default:0"`
+	ExpenseCount int64     `json:"expense_count" gorm:"not null;default:0"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (MonthlyCategoryTotal) TableName() string {
+	return "monthly_category_totals"
+}
+
+// MonthlyCategoryTotalMismatch is a rollup that disagrees with the expenses it summarizes
+type MonthlyCategoryTotalMismatch struct {
+	UserID       uint    `json:"user_id"`
+	Year         int     `json:"year"`
+	Month        int     `json:"month"`
+	CategoryID   uint    `json:"category_id"`
+	RollupAmount float64 `json:"rollup_amount"`
+	ActualAmount float64 `json:"actual_amount"`
+	RollupCount  int64   `json:"rollup_count"`
+	ActualCount  int64   `json:"actual_count"`
+}
+
+// monthlyCategoryTotalsSQL groups expenses the way the rollup stores them
+const monthlyCategoryTotalsSQL = "SELECT user_id, YEAR(expense_date) AS year, MONTH(expense_date) AS month, COALESCE(category_id, 0) AS category_id, " +
+	"SUM(amount) AS total_amount, COUNT(*) AS expense_count FROM daily_expenses"
+
+// AddExpenseToTotals adds an expense to the rollup of its month and category, or removes
+// it with sign -1. Call it in the transaction that writes the expense.
+func AddExpenseToTotals(db *gorm.DB, expense *DailyExpense, sign int) error {
+	total := MonthlyCategoryTotal{
+		UserID:       expense.UserID,
+		Year:         expense.ExpenseDate.Year(),
+		Month:        int(expense.ExpenseDate.Month()),
+		TotalAmount:  expense.Amount * float64(sign),
+		ExpenseCount: int64(sign),
+	}
+	if expense.CategoryID != nil {
+		total.CategoryID = *expense.CategoryID
+	}
+
+	if err := addToTotal(db, &total); err != nil {
+		return err
+	}
+
+	if sign < 0 {
+		return db.Where("user_id = ? AND year = ? AND month = ? AND category_id = ? AND expense_count <= 0",
+			total.UserID, total.Year, total.Month, total.CategoryID).
+			Delete(&MonthlyCategoryTotal{}).Error
+	}
+	return nil
+}
+
+// UncategorizeTotals moves the rollups of a category into the uncategorized rollups of the
+// same months, as deleting the category does with its expenses. Call it in the transaction
+// that deletes the category.
+func UncategorizeTotals(db *gorm.DB, userID, categoryID uint) error {
+	var totals []MonthlyCategoryTotal
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND category_id = ?", userID, categoryID).Find(&totals).Error; err != nil {
+		return err
+	}
+	for _, total := range totals {
+		if err := addToTotal(db, &MonthlyCategoryTotal{
+			UserID:       userID,
+			Year:         total.Year,
+			Month:        total.Month,
+			TotalAmount:  total.TotalAmount,
+			ExpenseCount: total.ExpenseCount,
+		}); err != nil {
+			return err
+		}
+	}
+	return db.Where("user_id = ? AND category_id = ?", userID, categoryID).Delete(&MonthlyCategoryTotal{}).Error
+}
+
+// addToTotal adds an amount and count to a rollup, creating it when missing
+func addToTotal(db *gorm.DB, total *MonthlyCategoryTotal) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "year"}, {Name: "month"}, {Name: "category_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"total_amount":  gorm.Expr("total_amount + ?", total.TotalAmount),
+			"expense_count": gorm.Expr("expense_count + ?", total.ExpenseCount),
+			"updated_at":    time.Now(),
+		}),
+	}).Create(total).Error
+}
+
+// RebuildMonthlyCategoryTotals recomputes the rollups of a user from their expenses,
+// or of every user when userID is 0
+func RebuildMonthlyCategoryTotals(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		deleteQuery := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		insertSQL := "INSERT INTO monthly_category_totals (user_id, year, month, category_id, total_amount, expense_count, updated_at) " +
+			"SELECT user_id, year, month, category_id, total_amount, expense_count, NOW() FROM (" + monthlyCategoryTotalsSQL
+		var args []interface{}
+		if userID != 0 {
+			deleteQuery = deleteQuery.Where("user_id = ?", userID)
+			insertSQL += " WHERE user_id = ?"
+			args = append(args, userID)
+		}
+		insertSQL += " GROUP BY user_id, YEAR(expense_date), MONTH(expense_date), COALESCE(category_id, 0)) AS grouped"
+
+		if err := deleteQuery.Delete(&MonthlyCategoryTotal{}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(insertSQL, args...).Error
+	})
+}
+
+// CheckMonthlyCategoryTotals compares the rollups of a user, or of every user when userID is 0,
+// with their expenses and returns the months and categories that disagree
+func CheckMonthlyCategoryTotals(db *gorm.DB, userID uint) ([]MonthlyCategoryTotalMismatch, error) {
+	actualSQL := monthlyCategoryTotalsSQL
+	rollupQuery := db.Model(&MonthlyCategoryTotal{})
+	var args []interface{}
+	if userID != 0 {
+		actualSQL += " WHERE user_id = ?"
+		rollupQuery = rollupQuery.Where("user_id = ?", userID)
+		args = append(args, userID)
+	}
+	actualSQL += " GROUP BY user_id, YEAR(expense_date), MONTH(expense_date), COALESCE(category_id, 0)"
+
+	var actual, rollups []MonthlyCategoryTotal
+	if err := db.Raw(actualSQL, args...).Scan(&actual).Error; err != nil {
+		return nil, err
+	}
+	if err := rollupQuery.Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		userID     uint
+		year       int
+		month      int
+		categoryID uint
+	}
+	mismatches := make(map[key]*MonthlyCategoryTotalMismatch)
+	entry := func(total *MonthlyCategoryTotal) *MonthlyCategoryTotalMismatch {
+		k := key{total.UserID, total.Year, total.Month, total.CategoryID}
+		if mismatches[k] == nil {
+			mismatches[k] = &MonthlyCategoryTotalMismatch{UserID: total.UserID, Year: total.Year, Month: total.Month, CategoryID: total.CategoryID}
+		}
+		return mismatches[k]
+	}
+	for i := range actual {
+		m := entry(&actual[i])
+		m.ActualAmount = actual[i].TotalAmount
+		m.ActualCount = actual[i].ExpenseCount
+	}
+	for i := range rollups {
+		m := entry(&rollups[i])
+		m.RollupAmount = rollups[i].TotalAmount
+		m.RollupCount = rollups[i].ExpenseCount
+	}
+
+	var result []MonthlyCategoryTotalMismatch
+	for _, m := range mismatches {
+		// Amounts are stored with two decimals, so anything under half a cent is rounding
+		if m.RollupCount != m.ActualCount || math.Abs(m.RollupAmount-m.ActualAmount) >= 0.005 {
+			result = append(result, *m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		return a.CategoryID < b.CategoryID
+	})
+	return result, nil
+}
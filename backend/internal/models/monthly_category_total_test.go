@@ -0,0 +1,156 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/abdelrahman/expense-manager/internal/testutil"
+	"gorm.io/gorm"
+)
+
+func addExpense(t *testing.T, db *gorm.DB, userID uint, categoryID *uint, date string, amount float64) models.DailyExpense {
+	t.Helper()
+	expenseDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense := models.DailyExpense{UserID: userID, CategoryID: categoryID, ExpenseDate: expenseDate, Amount: amount}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&expense).Error; err != nil {
+			return err
+		}
+		return models.AddExpenseToTotals(tx, &expense, 1)
+	}); err != nil {
+		t.Fatalf("adding expense: %v", err)
+	}
+	return expense
+}
+
+func checkTotals(t *testing.T, db *gorm.DB, userID uint) []models.MonthlyCategoryTotalMismatch {
+	t.Helper()
+	mismatches, err := models.CheckMonthlyCategoryTotals(db, userID)
+	if err != nil {
+		t.Fatalf("checking totals: %v", err)
+	}
+	return mismatches
+}
+
+func TestCheckMonthlyCategoryTotalsMatchesKeptTotals(t *testing.T) {
+	db := testutil.OpenDB(t)
+	food := uint(7)
+	addExpense(t, db, 1, &food, "2026-01-05", 10)
+	addExpense(t, db, 1, &food, "2026-01-20", 15.5)
+	addExpense(t, db, 1, nil, "2026-02-01", 4)
+	removed := addExpense(t, db, 1, &food, "2026-02-03", 9)
+	addExpense(t, db, 2, &food, "2026-01-05", 100)
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&removed).Error; err != nil {
+			return err
+		}
+		return models.AddExpenseToTotals(tx, &removed, -1)
+	}); err != nil {
+		t.Fatalf("removing expense: %v", err)
+	}
+
+	if mismatches := checkTotals(t, db, 0); len(mismatches) != 0 {
+		t.Errorf("mismatches = %+v, want none", mismatches)
+	}
+
+	var emptied int64
+	db.Model(&models.MonthlyCategoryTotal{}).Where("user_id = 1 AND year = 2026 AND month = 2 AND category_id = ?", food).Count(&emptied)
+	if emptied != 0 {
+		t.Error("the rollup of a month whose last expense was removed was kept")
+	}
+}
+
+func TestCheckMonthlyCategoryTotalsReportsDrift(t *testing.T) {
+	db := testutil.OpenDB(t)
+	food := uint(7)
+	addExpense(t, db, 1, &food, "2026-01-05", 10)
+	addExpense(t, db, 1, nil, "2026-02-01", 4)
+	addExpense(t, db, 2, &food, "2026-01-05", 100)
+
+	// A changed amount, a missing rollup and a rollup with no expenses behind it
+	db.Model(&models.MonthlyCategoryTotal{}).Where("user_id = 1 AND month = 1").Update("total_amount", 12)
+	db.Where("user_id = 1 AND month = 2").Delete(&models.MonthlyCategoryTotal{})
+	db.Create(&models.MonthlyCategoryTotal{UserID: 1, Year: 2026, Month: 3, CategoryID: food, TotalAmount: 5, ExpenseCount: 1})
+
+	want := []models.MonthlyCategoryTotalMismatch{
+		{UserID: 1, Year: 2026, Month: 1, CategoryID: food, RollupAmount: 12, ActualAmount: 10, RollupCount: 1, ActualCount: 1},
+		{UserID: 1, Year: 2026, Month: 2, CategoryID: 0, ActualAmount: 4, ActualCount: 1},
+		{UserID: 1, Year: 2026, Month: 3, CategoryID: food, RollupAmount: 5, RollupCount: 1},
+	}
+	got := checkTotals(t, db, 0)
+	if len(got) != len(want) {
+		t.Fatalf("mismatches = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mismatch %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if mismatches := checkTotals(t, db, 2); len(mismatches) != 0 {
+		t.Errorf("mismatches for another user = %+v, want none", mismatches)
+	}
+}
+
+func TestRebuildMonthlyCategoryTotalsFixesDrift(t *testing.T) {
+	db := testutil.OpenDB(t)
+	food := uint(7)
+	addExpense(t, db, 1, &food, "2026-01-05", 10)
+	addExpense(t, db, 1, nil, "2026-02-01", 4)
+	addExpense(t, db, 2, &food, "2026-01-05", 100)
+	db.Model(&models.MonthlyCategoryTotal{}).Where("user_id IN (1, 2)").Update("total_amount", 1)
+
+	if err := models.RebuildMonthlyCategoryTotals(db, 1); err != nil {
+		t.Fatalf("rebuilding: %v", err)
+	}
+	if mismatches := checkTotals(t, db, 1); len(mismatches) != 0 {
+		t.Errorf("mismatches after rebuild = %+v, want none", mismatches)
+	}
+	if mismatches := checkTotals(t, db, 2); len(mismatches) != 1 {
+		t.Errorf("rebuilding one user touched another: mismatches = %+v", mismatches)
+	}
+
+	if err := models.RebuildMonthlyCategoryTotals(db, 0); err != nil {
+		t.Fatalf("rebuilding: %v", err)
+	}
+	if mismatches := checkTotals(t, db, 0); len(mismatches) != 0 {
+		t.Errorf("mismatches after rebuilding everyone = %+v, want none", mismatches)
+	}
+}
+
+func TestUncategorizeTotalsMovesOnlyTheCategory(t *testing.T) {
+	db := testutil.OpenDB(t)
+	food, rent := uint(7), uint(8)
+	addExpense(t, db, 1, &food, "2026-01-05", 10)
+	addExpense(t, db, 1, nil, "2026-01-06", 4)
+	addExpense(t, db, 1, &food, "2026-02-05", 6)
+	addExpense(t, db, 1, &rent, "2026-02-01", 500)
+	addExpense(t, db, 2, &food, "2026-01-05", 100)
+
+	// What the category's foreign key does to its expenses when it is deleted
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DailyExpense{}).Where("user_id = 1 AND category_id = ?", food).
+			Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return models.UncategorizeTotals(tx, 1, food)
+	}); err != nil {
+		t.Fatalf("uncategorizing: %v", err)
+	}
+
+	if mismatches := checkTotals(t, db, 0); len(mismatches) != 0 {
+		t.Errorf("mismatches = %+v, want none", mismatches)
+	}
+	var january models.MonthlyCategoryTotal
+	if err := db.Where("user_id = 1 AND year = 2026 AND month = 1 AND category_id = 0").First(&january).Error; err != nil {
+		t.Fatalf("loading uncategorized total: %v", err)
+	}
+	if january.TotalAmount != 14 || january.ExpenseCount != 2 {
+		t.Errorf("uncategorized January = %v over %d expenses, want 14 over 2", january.TotalAmount, january.ExpenseCount)
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification types
+const (
+	NotificationSpendingAnomaly = "spending_anomaly"
+)
+
+// Notification is a message shown to a user in the app
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Type      string     `json:"type" gorm:"size:50;not null"`
+	Title     string     `json:"title" gorm:"size:255;not null"`
+	Message   string     `json:"message" gorm:"type:text"`
+	ExpenseID *uint      `json:"expense_id"` // Expense the notification is about, if any
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time code that replaces an authenticator code, for users who lose
+// their device. Only its hash is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time
+const RecoveryCodeCount = 10
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Recurring item types
+const (
+	RecurringIncome  = "income"
+	RecurringExpense = "expense"
+)
+
+// RecurringItem is an income or expense expected on a fixed schedule, such as a salary,
+// rent or a subscription, used to forecast balances
+type RecurringItem struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Name          string     `json:"name" gorm:"size:100;not null"`
+	Type          string     `json:"type" gorm:"size:10;not null"` // income or expense
+	Amount        float64    `json:"amount" gorm:"type:decimal(10,2);not null"`
+	Frequency     string     `json:"frequency" gorm:"size:10;not null;default:monthly"` // weekly, biweekly, monthly or yearly
+	StartDate     time.Time  `json:"start_date" gorm:"type:date;not null"`              // First occurrence
+	EndDate       *time.Time `json:"end_date" gorm:"type:date"`                         // Last possible occurrence, open-ended when nil
+	BankAccountID *uint      `json:"bank_account_id" gorm:"index:idx_bank_account_id"`
+	CategoryID    *uint      `json:"category_id" gorm:"index:idx_category_id"`
+	Category      *Category  `json:"category,omitempty" gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
+	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	Notes         string     `json:"notes" gorm:"type:text"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (RecurringItem) TableName() string {
+	return "recurring_items"
+}
+
+// SignedAmount returns the amount as it affects a balance
+func (i *RecurringItem) SignedAmount() float64 {
+	if i.Type == RecurringIncome {
+		return i.Amount
+	}
+	return -i.Amount
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a signed-in device. Its refresh tokens form one family: each refresh replaces
+// the token with a new one, and presenting a replaced token again revokes the whole session.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	UserAgent  string     `json:"user_agent" gorm:"size:255"` // Device or browser that signed in
+	IPAddress  string     `json:"ip_address" gorm:"size:45"`  // Last address the session was used from
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // When the latest refresh token expires
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Current    bool       `json:"current" gorm:"-"` // Set when listing the sessions of the requesting session's user
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SessionSeenInterval is how stale a session's last seen time may get before a request refreshes it
+const SessionSeenInterval = 5 * time.Minute
+
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken is one refresh token of a session, stored as a hash
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID uint       `json:"session_id" gorm:"not null;index:idx_session_id"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"` // Set once exchanged for a new token
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -6,6 +6,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Calendars a user can display dates in and plans can be keyed by
+const (
+	CalendarGregorian = "gregorian"
+	CalendarHijri     = "hijri"
+)
+
 type User struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	Email     string    `json:"email" gorm:"size:255;not null;uniqueIndex"`
@@ -13,12 +19,34 @@ type User struct {
 	Name      string    `json:"name" gorm:"size:100;not null"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // Set once the user opens a verification link sent to Email
+
+	// Two-factor authentication
+	TOTPSecret        string     `json:"-" gorm:"column:totp_secret;size:64"`         // Secret of the enabled authenticator
+	TOTPPendingSecret string     `json:"-" gorm:"column:totp_pending_secret;size:64"` // Secret being enrolled, until confirmed with a code
+	TOTPLastStep      int64      `json:"-" gorm:"column:totp_last_step;default:0"`    // Time step of the last accepted code, refused from then on
+	TOTPEnabledAt     *time.Time `json:"totp_enabled_at" gorm:"column:totp_enabled_at"`
+
+	// Preferences
+	Calendar             string `json:"calendar" gorm:"size:10;not null;default:gregorian"` // Calendar dates are displayed in
+	AnomalyNotifications bool   `json:"anomaly_notifications" gorm:"default:false"`         // Notify about unusual new expenses
 }
 
 func (User) TableName() string {
 	return "users"
 }
 
+// IsEmailVerified reports whether the user has confirmed their current email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// HasTOTP reports whether signing in needs an authenticator code
+func (u *User) HasTOTP() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != ""
+}
+
 // HashPassword hashes the user's password using bcrypt
 func (u *User) HashPassword(password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an OpenID Connect provider, found again by the
+// provider's subject ID on later sign-ins even if the email there changes
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index:idx_user_id"`
+	Provider    string     `json:"provider" gorm:"size:50;not null;uniqueIndex:idx_provider_subject"`
+	Subject     string     `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_provider_subject"`
+	Email       string     `json:"email" gorm:"size:255"` // Email at the provider when last signed in
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCLoginStateTTL is how long a user has to finish signing in at the provider
+const OIDCLoginStateTTL = 10 * time.Minute
+
+// OIDCLoginState remembers a sign-in sent to a provider until it comes back, with the
+// nonce and PKCE verifier that bind the returned code and ID token to it, and the cookie
+// that binds it to the browser that started it. The state parameter and the cookie are
+// only stored as hashes.
+type OIDCLoginState struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Provider     string     `json:"provider" gorm:"size:50;not null"`
+	StateHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	BrowserHash  string     `json:"-" gorm:"size:64;not null;default:''"`
+	Nonce        string     `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string     `json:"-" gorm:"size:128;not null"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+// Nisab thresholds in grams and the zakat rate on wealth
+const (
+	NisabGoldGrams   = 85.0
+	NisabSilverGrams = 595.0
+	ZakatRate        = 0.025
+)
+
+// ZakatSettings holds a user's hawl start date, nisab prices and exclusions
+type ZakatSettings struct {
+	ID                 uint      `json:"id" gorm:"primaryKey"`
+	UserID             uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	HawlStartDate      time.Time `json:"hawl_start_date" gorm:"type:date;not null"`          // Day wealth first reached the nisab
+	NisabBasis         string    `json:"nisab_basis" gorm:"size:10;not null;default:silver"` // gold or silver
+	GoldPricePerGram   float64   `json:"gold_price_per_gram" gorm:"type:decimal(10,2);default:0"`
+	SilverPricePerGram float64   `json:"silver_price_per_gram" gorm:"type:decimal(10,2);default:0"`
+	Currency           string    `json:"currency" gorm:"size:3;default:SAR"`
+	ExcludedAccountIDs []uint    `json:"excluded_account_ids" gorm:"serializer:json;type:text"`
+	DeductLiabilities  bool      `json:"deduct_liabilities" gorm:"default:true"`
+	AdditionalAssets   float64   `json:"additional_assets" gorm:"type:decimal(12,2);default:0"` // Gold, shares or cash held outside tracked accounts
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+func (ZakatSettings) TableName() string {
+	return "zakat_settings"
+}
+
+// IsExcluded reports whether a bank account is left out of the zakat calculation
+func (s *ZakatSettings) IsExcluded(bankAccountID uint) bool {
+	for _, id := range s.ExcludedAccountIDs {
+		if id == bankAccountID {
+			return true
+		}
+	}
+	return false
+}
+
+// ZakatPayment records zakat paid towards a hawl year
+type ZakatPayment struct {
+	ID                       uint      `json:"id" gorm:"primaryKey"`
+	UserID                   uint      `json:"user_id" gorm:"not null;index:idx_user_id"`
+	HawlYear                 int       `json:"hawl_year" gorm:"not null"` // Hijri year of the anniversary the payment is for
+	Amount                   float64   `json:"amount" gorm:"type:decimal(10,2);not null"`
+	Currency                 string    `json:"currency" gorm:"size:3"`
+	PaidDate                 time.Time `json:"paid_date" gorm:"type:date;not null"`
+	Notes                    string    `json:"notes" gorm:"type:text"`
+	ExpenseID                *uint     `json:"expense_id"`
+	BankAccountTransactionID *uint     `json:"bank_account_transaction_id"`
+	CreatedAt                time.Time `json:"created_at"`
+}
+
+func (ZakatPayment) TableName() string {
+	return "zakat_payments"
+}
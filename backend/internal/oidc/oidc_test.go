@@ -0,0 +1,111 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/oidc/oidctest"
+)
+
+// slowKeysProvider starts a mock provider whose key set is only served once release is closed
+func slowKeysProvider(t *testing.T) (*Provider, chan struct{}, *atomic.Int64) {
+	t.Helper()
+	release := make(chan struct{})
+	var fetches atomic.Int64
+
+	var mock *oidctest.Provider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			fetches.Add(1)
+			<-release
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+
+	mock, err := oidctest.NewProvider(server.URL, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProvider(Config{IssuerURL: server.URL, ClientID: "client"}), release, &fetches
+}
+
+func TestKeyFetchDoesNotBlockOtherCalls(t *testing.T) {
+	p, release, fetches := slowKeysProvider(t)
+	ctx := context.Background()
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.getKey(ctx, d, "mock-key")
+			errs <- err
+		}()
+	}
+
+	// The key fetch is stuck at the provider; the cached discovery document is still served
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		p.getDiscovery(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("getDiscovery waited for the key fetch")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("getKey: %v", err)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("keys fetched %d times, want once for the concurrent sign-ins", got)
+	}
+}
+
+func TestKeyFetchWaitStopsWithContext(t *testing.T) {
+	p, _, fetches := slowKeysProvider(t)
+	d, err := p.getDiscovery(context.Background())
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+
+	go p.getKey(context.Background(), d, "mock-key")
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.getKey(ctx, d, "mock-key"); err == nil {
+		t.Error("getKey returned a key while the fetch was still stuck")
+	}
+}
@@ -0,0 +1,164 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is the length of the SHA-1 prefix ranges are keyed by, as in the
+// Pwned Passwords range API
+const prefixLength = 5
+
+// BreachedList looks passwords up in a local copy of a breached password hash list. It uses
+// the k-anonymity range layout: a password's SHA-1 is split into a 5-character prefix, which
+// picks a range, and a suffix looked up within it, so a lookup only reads one small range.
+//
+// The list is either a directory with one file per prefix (named "ABCDE" or "ABCDE.txt",
+// lines of "SUFFIX:COUNT", as produced by the Pwned Passwords downloader), or a single file of
+// full "HASH:COUNT" or "HASH" lines, loaded into memory, for small lists.
+type BreachedList struct {
+	dir    string
+	ranges map[string]map[string]int // Prefix to suffix to count, for a single-file list
+}
+
+// LoadBreachedList opens the list at path. A directory must hold at least one range file,
+// so a wrong or unreadable path stops startup instead of letting every password through.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if isRangeFile(entry.Name()) {
+				return &BreachedList{dir: path}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no breached password range files", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{ranges: make(map[string]map[string]int)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, count, ok := parseLine(scanner.Text())
+		if !ok || len(hash) != sha1.Size*2 {
+			continue
+		}
+		prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = make(map[string]int)
+		}
+		list.ranges[prefix][suffix] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Count returns how many times a password appears in the list, 0 when it does not
+func (b *BreachedList) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	if b.ranges != nil {
+		return b.ranges[prefix][suffix], nil
+	}
+
+	file, err := b.openRange(prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		// A missing range only means no hash has that prefix while the directory itself is there
+		if _, statErr := os.Stat(b.dir); statErr != nil {
+			return 0, statErr
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return findSuffix(file, suffix)
+}
+
+// Check makes the list a Rule. A password that cannot be looked up is refused, since it may
+// well be in the list, and the error is logged.
+func (b *BreachedList) Check(password string, _ Account) string {
+	count, err := b.Count(password)
+	if err != nil {
+		log.Printf("Breached password check failed: %v", err)
+		return "Password could not be checked against known breaches, please try again later"
+	}
+	if count > 0 {
+		return "This password has appeared in a data breach, please choose another"
+	}
+	return ""
+}
+
+func (b *BreachedList) openRange(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.dir, prefix))
+	}
+	return file, err
+}
+
+// isRangeFile reports whether a file name is a range prefix, with or without ".txt"
+func isRangeFile(name string) bool {
+	name = strings.TrimSuffix(name, ".txt")
+	if len(name) != prefixLength {
+		return false
+	}
+	_, err := hex.DecodeString(name + "0")
+	return err == nil
+}
+
+// findSuffix scans a range for a hash suffix and returns its count
+func findSuffix(r io.Reader, suffix string) (int, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineSuffix, count, ok := parseLine(scanner.Text())
+		if ok && lineSuffix == suffix {
+			return count, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("reading breached password range: %w", err)
+	}
+	return 0, nil
+}
+
+// parseLine splits a "HASH:COUNT" or "HASH" line; a missing count counts as one
+func parseLine(line string) (string, int, bool) {
+	hash, countText, hasCount := strings.Cut(strings.TrimSpace(line), ":")
+	if hash == "" {
+		return "", 0, false
+	}
+	count := 1
+	if hasCount {
+		var err error
+		if count, err = strconv.Atoi(strings.TrimSpace(countText)); err != nil {
+			return "", 0, false
+		}
+	}
+	return strings.ToUpper(hash), count, true
+}
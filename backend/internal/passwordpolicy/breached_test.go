@@ -0,0 +1,92 @@
+package passwordpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+const passwordSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectCount(t *testing.T, list *BreachedList, password string, want int) {
+	t.Helper()
+	count, err := list.Count(password)
+	if err != nil || count != want {
+		t.Errorf("Count(%q) = %d, %v, want %d", password, count, err, want)
+	}
+}
+
+func TestBreachedListSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	writeFile(t, path, "5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:42\n"+
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B\n"+ // "123456", no count
+		"not a hash\n")
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectCount(t, list, "password", 42)
+	expectCount(t, list, "123456", 1)
+	expectCount(t, list, "correct horse battery staple", 0)
+	if got := list.Check("password", Account{}); got != "This password has appeared in a data breach, please choose another" {
+		t.Errorf("Check = %q, want the breach message", got)
+	}
+}
+
+func TestBreachedListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "5BAA6.txt"), "0000000000000000000000000000000000A:3\r\n"+passwordSuffix+":9\r\n")
+	writeFile(t, filepath.Join(dir, "7C4A8"), "D09CA3762AF61E59520943DC26494F8941B:5\n") // "123456"
+	list, err := LoadBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectCount(t, list, "password", 9)
+	expectCount(t, list, "123456", 5)
+	expectCount(t, list, "correct horse battery staple", 0) // Its range is not in the directory
+	if got := list.Check("correct horse battery staple", Account{}); got != "" {
+		t.Errorf("Check = %q, want a pass", got)
+	}
+}
+
+func TestBreachedListRefusesWhatItCannotRead(t *testing.T) {
+	if _, err := LoadBreachedList(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadBreachedList accepted a missing path")
+	}
+	if _, err := LoadBreachedList(t.TempDir()); err == nil {
+		t.Error("LoadBreachedList accepted a directory without range files")
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "7C4A8"), "D09CA3762AF61E59520943DC26494F8941B:5\n")
+	if err := os.Mkdir(filepath.Join(dir, "5BAA6.txt"), 0o700); err != nil { // A range that cannot be read
+		t.Fatal(err)
+	}
+	list, err := LoadBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := list.Count("password"); err == nil {
+		t.Error("Count read a range that is a directory")
+	}
+	if got := list.Check("password", Account{}); got != "Password could not be checked against known breaches, please try again later" {
+		t.Errorf("Check = %q, want a refusal", got)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := list.Check("correct horse battery staple", Account{}); got == "" {
+		t.Error("Check passed a password after the list was removed")
+	}
+}
@@ -0,0 +1,131 @@
+// Package passwordpolicy decides whether a new password is acceptable. A Policy is a list
+// of rules checked in order; rules are plain values, so deployments can add their own.
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Account is what rules may know about the user a password is for
+type Account struct {
+	Email string
+	Name  string
+}
+
+// Rule checks one requirement and returns why a password fails it, or an empty string
+type Rule interface {
+	Check(password string, account Account) string
+}
+
+// RuleFunc turns a function into a Rule
+type RuleFunc func(password string, account Account) string
+
+func (f RuleFunc) Check(password string, account Account) string {
+	return f(password, account)
+}
+
+// Policy is an ordered list of rules a password must pass
+type Policy struct {
+	rules []Rule
+}
+
+// New returns a policy made of rules
+func New(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Add appends a rule to the policy
+func (p *Policy) Add(rule Rule) {
+	p.rules = append(p.rules, rule)
+}
+
+// Check returns why a password is not acceptable for an account, from the first rule it
+// fails, or an empty string when it passes them all
+func (p *Policy) Check(password string, account Account) string {
+	for _, rule := range p.rules {
+		if message := rule.Check(password, account); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// MinLength requires at least n characters
+func MinLength(n int) Rule {
+	return RuleFunc(func(password string, _ Account) string {
+		if utf8.RuneCountInString(password) < n {
+			return fmt.Sprintf("Password must be at least %d characters", n)
+		}
+		return ""
+	})
+}
+
+// MaxBytes limits a password's length in bytes; bcrypt only reads the first 72
+func MaxBytes(n int) Rule {
+	return RuleFunc(func(password string, _ Account) string {
+		if len(password) > n {
+			return fmt.Sprintf("Password must be at most %d bytes", n)
+		}
+		return ""
+	})
+}
+
+// CharacterClasses requires characters from at least n of lowercase letters, uppercase
+// letters, digits and other characters
+func CharacterClasses(n int) Rule {
+	return RuleFunc(func(password string, _ Account) string {
+		var lower, upper, digit, other bool
+		for _, r := range password {
+			switch {
+			case unicode.IsLower(r):
+				lower = true
+			case unicode.IsUpper(r):
+				upper = true
+			case unicode.IsDigit(r):
+				digit = true
+			default:
+				other = true
+			}
+		}
+
+		classes := 0
+		for _, present := range []bool{lower, upper, digit, other} {
+			if present {
+				classes++
+			}
+		}
+		if classes < n {
+			return fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", n)
+		}
+		return ""
+	})
+}
+
+// minPersonalPart is the shortest part of an email or name that a password may not contain,
+// so short names like "Al" do not rule out common passwords
+const minPersonalPart = 3
+
+// NoPersonalInfo rejects passwords containing the account's email, the part of the email
+// before the @, or any word of the user's name, ignoring case
+func NoPersonalInfo() Rule {
+	return RuleFunc(func(password string, account Account) string {
+		lowered := strings.ToLower(password)
+
+		email := strings.ToLower(strings.TrimSpace(account.Email))
+		parts := []string{email}
+		if at := strings.LastIndex(email, "@"); at > 0 {
+			parts = append(parts, email[:at])
+		}
+		parts = append(parts, strings.Fields(strings.ToLower(account.Name))...)
+
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) >= minPersonalPart && strings.Contains(lowered, part) {
+				return "Password must not contain your email or name"
+			}
+		}
+		return ""
+	})
+}
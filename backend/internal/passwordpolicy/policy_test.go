@@ -0,0 +1,57 @@
+package passwordpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	account := Account{Email: "jane.doe@example.com", Name: "Jane Al Doe"}
+	for _, tc := range []struct {
+		name     string
+		rule     Rule
+		password string
+		want     string
+	}{
+		{"min length", MinLength(8), "short", "Password must be at least 8 characters"},
+		{"min length counts characters", MinLength(4), "日本語で", ""},
+		{"max bytes", MaxBytes(72), strings.Repeat("a", 73), "Password must be at most 72 bytes"},
+		{"max bytes counts bytes", MaxBytes(72), strings.Repeat("日", 25), "Password must be at most 72 bytes"},
+		{"max bytes at the limit", MaxBytes(72), strings.Repeat("a", 72), ""},
+		{"one class", CharacterClasses(2), "lowercaseonly", "Password must mix at least 2 of lowercase letters, uppercase letters, digits and symbols"},
+		{"two classes", CharacterClasses(2), "lower1234", ""},
+		{"all classes", CharacterClasses(4), "aB3$", ""},
+		{"email", NoPersonalInfo(), "my JANE.DOE@example.com pw", "Password must not contain your email or name"},
+		{"email local part", NoPersonalInfo(), "xxjane.doexx", "Password must not contain your email or name"},
+		{"name word", NoPersonalInfo(), "iamdoe123", "Password must not contain your email or name"},
+		{"short name word", NoPersonalInfo(), "alpaca horse", ""},
+		{"unrelated", NoPersonalInfo(), "correct horse battery", ""},
+	} {
+		if got := tc.rule.Check(tc.password, account); got != tc.want {
+			t.Errorf("%s: Check(%q) = %q, want %q", tc.name, tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyReturnsTheFirstFailure(t *testing.T) {
+	policy := New(MinLength(8), CharacterClasses(2))
+	if got := policy.Check("abc", Account{}); got != "Password must be at least 8 characters" {
+		t.Errorf("Check = %q, want the length message first", got)
+	}
+	if got := policy.Check("abcdefgh", Account{}); !strings.HasPrefix(got, "Password must mix") {
+		t.Errorf("Check = %q, want the character class message", got)
+	}
+
+	policy.Add(RuleFunc(func(password string, _ Account) string {
+		if password == "abcdefg1" {
+			return "Custom rule"
+		}
+		return ""
+	}))
+	if got := policy.Check("abcdefg1", Account{}); got != "Custom rule" {
+		t.Errorf("Check = %q, want the added rule's message", got)
+	}
+	if got := policy.Check("abcdefg2", Account{}); got != "" {
+		t.Errorf("Check = %q, want a pass", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package testutil sets up an in-memory database for tests. It uses SQLite with the few
+// MySQL functions the queries rely on registered as SQLite functions.
+package testutil
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abdelrahman/expense-manager/internal/database"
+	"github.com/abdelrahman/expense-manager/internal/models"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const driverName = "sqlite3_mysql"
+
+var (
+	registerOnce sync.Once
+	databaseSeq  atomic.Int64
+)
+
+// registerDriver registers SQLite with YEAR, MONTH and NOW as in MySQL
+func registerDriver() {
+	registerOnce.Do(func() {
+		sql.Register(driverName, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.RegisterFunc("YEAR", func(value string) (int, error) {
+					return datePart(value, 0, 4)
+				}, true); err != nil {
+					return err
+				}
+				if err := conn.RegisterFunc("MONTH", func(value string) (int, error) {
+					return datePart(value, 5, 7)
+				}, true); err != nil {
+					return err
+				}
+				return conn.RegisterFunc("NOW", func() string {
+					return time.Now().Format("2006-01-02 15:04:05")
+				}, false)
+			},
+		})
+	})
+}
+
+// datePart reads a number out of a stored date, which SQLite keeps as text
+func datePart(value string, from, to int) (int, error) {
+	if len(value) < to {
+		return 0, fmt.Errorf("not a date: %q", value)
+	}
+	return strconv.Atoi(value[from:to])
+}
+
+// OpenDB opens a new empty database with every model migrated and makes it the one
+// database.GetDB returns for the rest of the test
+func OpenDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	registerDriver()
+
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared&_loc=auto", databaseSeq.Add(1))
+	db, err := gorm.Open(sqlite.Dialector{DriverName: driverName, DSN: dsn}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+
+	// One connection keeps the in-memory database alive and serializes writers
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	migrated := []interface{}{
+		&models.User{},
+		&models.Category{},
+		&models.DailyExpense{},
+		&models.ExpenseTag{},
+		&models.MonthlyPlan{},
+		&models.BankAccount{},
+		&models.BankAccountTransaction{},
+		&models.BankAccountSnapshot{},
+		&models.BankAccountReconciliation{},
+		&models.Loan{},
+		&models.LoanInstallment{},
+		&models.ZakatSettings{},
+		&models.ZakatPayment{},
+		&models.BudgetPeriod{},
+		&models.RecurringItem{},
+		&models.Notification{},
+		&models.MonthlyCategoryTotal{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.APIToken{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.LoginAttempt{},
+		&models.LoginThrottle{},
+	}
+	for _, model := range migrated {
+		if err := scopeIndexNames(db, model); err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+	}
+	if err := db.AutoMigrate(migrated...); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// scopeIndexNames prefixes the model's named indexes with its table name. MySQL scopes index
+// names to a table, so several models share names such as idx_user_id, while SQLite needs
+// them unique across the database.
+func scopeIndexNames(db *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	table := stmt.Schema.Table
+	for _, field := range stmt.Schema.Fields {
+		parts := strings.Split(field.Tag.Get("gorm"), ";")
+		changed := false
+		for i, part := range parts {
+			key, value, found := strings.Cut(part, ":")
+			key = strings.ToUpper(strings.TrimSpace(key))
+			if !found || (key != "INDEX" && key != "UNIQUEINDEX") || value == "" || value[0] == ',' {
+				continue
+			}
+			if strings.HasPrefix(value, table+"_") {
+				continue // Already scoped by an earlier test on the same cached schema
+			}
+			parts[i] = key + ":" + table + "_" + value
+			changed = true
+		}
+		if changed {
+			field.Tag = reflect.StructTag(strings.Replace(string(field.Tag),
+				strconv.Quote(field.Tag.Get("gorm")), strconv.Quote(strings.Join(parts, ";")), 1))
+		}
+	}
+	return nil
+}
+
+// QueryCounter counts the statements run through a database
+type QueryCounter struct {
+	count atomic.Int64
+}
+
+// CountQueries starts counting the statements run through db
+func CountQueries(t testing.TB, db *gorm.DB) *QueryCounter {
+	t.Helper()
+	counter := &QueryCounter{}
+	count := func(*gorm.DB) { counter.count.Add(1) }
+
+	callbacks := db.Callback()
+	name := fmt.Sprintf("testutil:count_queries_%p", counter)
+	for _, err := range []error{
+		callbacks.Query().After("gorm:query").Register(name, count),
+		callbacks.Row().After("gorm:row").Register(name, count),
+		callbacks.Raw().After("gorm:raw").Register(name, count),
+		callbacks.Create().After("gorm:create").Register(name, count),
+		callbacks.Update().After("gorm:update").Register(name, count),
+		callbacks.Delete().After("gorm:delete").Register(name, count),
+	} {
+		if err != nil {
+			t.Fatalf("counting queries: %v", err)
+		}
+	}
+	return counter
+}
+
+// Count returns the number of statements run since the counter started or was last reset
+func (c *QueryCounter) Count() int64 {
+	return c.count.Load()
+}
+
+// Reset starts counting from zero again
+func (c *QueryCounter) Reset() {
+	c.count.Store(0)
+}
@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abdelrahman/expense-manager/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+// Request builds a request with a JSON body, or none when body is nil
+func Request(t testing.TB, method, target string, body interface{}) *http.Request {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+	r := httptest.NewRequest(method, target, &payload)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// AsUser returns the request as the auth middleware passes it on for a signed-in user
+func AsUser(r *http.Request, userID uint) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, userID))
+}
+
+// WithVars sets the route variables a handler reads with mux.Vars
+func WithVars(r *http.Request, vars map[string]string) *http.Request {
+	return mux.SetURLVars(r, vars)
+}
+
+// Serve runs a handler and returns the recorded response
+func Serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// DecodeJSON decodes a recorded JSON response
+func DecodeJSON(t testing.TB, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+}
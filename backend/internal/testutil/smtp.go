@@ -0,0 +1,119 @@
+package testutil
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SMTPMessage is an email an SMTPServer received
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string // Headers and body as sent, with the closing dot removed
+}
+
+// SMTPServer is a local stand-in for an SMTP server that accepts every email
+type SMTPServer struct {
+	Host     string
+	Port     string
+	messages chan SMTPMessage
+}
+
+// StartSMTP starts an SMTP stand-in that runs until the test ends
+func StartSMTP(t testing.TB) *SMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting SMTP server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	server := &SMTPServer{Host: host, Port: port, messages: make(chan SMTPMessage, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// Next waits for the next email, failing the test when none arrives in time
+func (s *SMTPServer) Next(t testing.TB) SMTPMessage {
+	t.Helper()
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+		return SMTPMessage{}
+	}
+}
+
+// ExpectNone fails the test when an email arrives within wait
+func (s *SMTPServer) ExpectNone(t testing.TB, wait time.Duration) {
+	t.Helper()
+	select {
+	case message := <-s.messages:
+		t.Fatalf("unexpected email to %v: %q", message.To, message.Data)
+	case <-time.After(wait):
+	}
+}
+
+func (s *SMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(line string) bool { return text.PrintfLine("%s", line) == nil }
+
+	if !reply("220 localhost ESMTP test") {
+		return
+	}
+	var message SMTPMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			message = SMTPMessage{From: addressArg(arg)}
+			reply("250 OK")
+		case "RCPT":
+			message.To = append(message.To, addressArg(arg))
+			reply("250 OK")
+		case "DATA":
+			if !reply("354 Send the message") {
+				return
+			}
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.Data = string(data)
+			s.messages <- message
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// addressArg reads the address out of a "FROM:<address>" or "TO:<address>" argument
+func addressArg(arg string) string {
+	_, address, _ := strings.Cut(arg, ":")
+	address, _, _ = strings.Cut(address, " ")
+	return strings.Trim(address, "<>")
+}
@@ -7,30 +7,43 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
+var (
+	jwtSecret      []byte
+	accessTokenTTL = 15 * time.Minute
+)
 
-// InitJWT initializes the JWT secret
-func InitJWT(secret string) {
+// InitJWT initializes the JWT secret and the lifetime of access tokens
+func InitJWT(secret string, ttl time.Duration) {
 	jwtSecret = []byte(secret)
+	if ttl > 0 {
+		accessTokenTTL = ttl
+	}
+}
+
+// AccessTokenTTL returns how long an access token stays valid
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
 }
 
 // Claims represents the JWT claims
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID uint   `json:"sid"` // Session the token was issued for, checked for revocation
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uint, email string) (string, error) {
+// GenerateToken generates a short-lived access token for a user's session
+func GenerateToken(userID uint, email string, sessionID uint) (string, error) {
 	if len(jwtSecret) == 0 {
 		return "", errors.New("JWT secret not initialized")
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(accessTokenTTL)
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,6 +59,53 @@ func GenerateToken(userID uint, email string) (string, error) {
 	return tokenString, nil
 }
 
+// mfaAudience marks the challenge tokens of a sign-in waiting for its second factor
+const mfaAudience = "mfa"
+
+// GenerateMFAToken generates the challenge token of a sign-in that passed the password
+// check and still needs an authenticator or recovery code. It is not an access token.
+func GenerateMFAToken(userID uint, ttl time.Duration) (string, time.Time, error) {
+	if len(jwtSecret) == 0 {
+		return "", time.Time{}, errors.New("JWT secret not initialized")
+	}
+
+	expirationTime := time.Now().Add(ttl)
+	claims := &Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expirationTime, nil
+}
+
+// ValidateMFAToken validates a challenge token and returns the user it was issued for
+func ValidateMFAToken(tokenString string) (uint, error) {
+	if len(jwtSecret) == 0 {
+		return 0, errors.New("JWT secret not initialized")
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithAudience(mfaAudience))
+	if err != nil {
+		return 0, err
+	}
+	if !token.Valid {
+		return 0, errors.New("invalid token")
+	}
+	return claims.UserID, nil
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func ValidateToken(tokenString string) (*Claims, error) {
 	if len(jwtSecret) == 0 {
@@ -65,5 +125,10 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Challenge tokens are signed with the same secret but must not pass as access tokens
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("not an access token")
+	}
+
 	return claims, nil
 }
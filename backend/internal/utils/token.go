@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken returns a random URL-safe token and the hash to store in its place
+func GenerateOpaqueToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a token. Tokens are random and long,
+// so a fast unsalted hash is enough to keep a database leak from exposing them.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APITokenPrefix starts every personal access token, so it can be told apart from a JWT
+// and recognized if it leaks into logs or code
+const APITokenPrefix = "emp_"
+
+// GenerateAPIToken returns a new personal access token and the hash to store in its place
+func GenerateAPIToken() (string, string, error) {
+	token, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = APITokenPrefix + token
+	return token, HashToken(token), nil
+}
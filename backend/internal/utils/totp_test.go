@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890"
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// The RFC 6238 SHA-1 vectors, cut to the last six of their eight digits
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		code, err := TOTPCode(rfc6238Secret, vector.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", vector.unix, err)
+		}
+		if code != vector.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+
+	if code, err := TOTPCode(strings.ToLower(rfc6238Secret), 1); err != nil || code != rfc6238Vectors[0].code {
+		t.Errorf("TOTPCode with a lower-case secret = %q, %v", code, err)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted a secret that is not base32")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		at := time.Unix(vector.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, vector.code, at, 0)
+		if !ok || step != vector.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v, want step %d", vector.code, vector.unix, step, ok, vector.unix/totpPeriod)
+		}
+	}
+
+	at := time.Unix(1111111111, 0)
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{"spaced", "050 471", at, true},
+		{"previous step", "050471", at.Add(totpPeriod * time.Second), true},
+		{"next step", "050471", at.Add(-totpPeriod * time.Second), true},
+		{"two steps late", "050471", at.Add(2 * totpPeriod * time.Second), false},
+		{"wrong code", "050472", at, false},
+		{"too short", "05047", at, false},
+		{"too long", "0504711", at, false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(rfc6238Secret, tt.code, tt.at, 0); ok != tt.ok {
+			t.Errorf("%s: ValidateTOTP(%q) = %v, want %v", tt.name, tt.code, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPRefusesUsedSteps(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step, ok := ValidateTOTP(rfc6238Secret, "050471", at, 0)
+	if !ok {
+		t.Fatal("ValidateTOTP refused a valid code")
+	}
+
+	if _, ok := ValidateTOTP(rfc6238Secret, "050471", at, step); ok {
+		t.Error("ValidateTOTP accepted a code for the step already used")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "050471", at, step+1); ok {
+		t.Error("ValidateTOTP accepted a code for a step before the last one used")
+	}
+
+	// The next code is still accepted while the drift window overlaps the used step
+	next, err := TOTPCode(rfc6238Secret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ValidateTOTP(rfc6238Secret, next, at, step); !ok || got != step+1 {
+		t.Errorf("ValidateTOTP of the next code = %d, %v, want step %d", got, ok, step+1)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		code, err := GenerateRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("GenerateRecoveryCode() = %q, want xxxxx-xxxxx in lower case", code)
+		}
+		if seen[code] {
+			t.Errorf("GenerateRecoveryCode() repeated %q", code)
+		}
+		seen[code] = true
+	}
+
+	for _, typed := range []string{"k7q2m-x9d4w", " K7Q2M-X9D4W ", "k7q2m x9d4w", "K7Q2MX9D4W"} {
+		if got := NormalizeRecoveryCode(typed); got != "k7q2mx9d4w" {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want k7q2mx9d4w", typed, got)
+		}
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	InitJWT("test-secret", 0)
+
+	challenge, _, err := GenerateMFAToken(7, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(challenge); err == nil {
+		t.Error("ValidateToken accepted an MFA challenge token")
+	}
+	if userID, err := ValidateMFAToken(challenge); err != nil || userID != 7 {
+		t.Errorf("ValidateMFAToken = %d, %v, want user 7", userID, err)
+	}
+
+	access, err := GenerateToken(7, "user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateMFAToken(access); err == nil {
+		t.Error("ValidateMFAToken accepted an access token")
+	}
+	if claims, err := ValidateToken(access); err != nil || claims.UserID != 7 || claims.SessionID != 1 {
+		t.Errorf("ValidateToken = %+v, %v", claims, err)
+	}
+
+	expired, _, err := GenerateMFAToken(7, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateMFAToken(expired); err == nil {
+		t.Error("ValidateMFAToken accepted an expired challenge token")
+	}
+}